@@ -2,45 +2,170 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"strings"
+	"time"
+
 	"todo-go/identity"
+	"todo-go/pat"
 	"todo-go/server"
+	"todo-go/session"
+	"todo-go/store"
 
 	"github.com/gorilla/mux"
 	"github.com/lestrrat-go/jwx/v2/jwk"
 	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/pkg/errors"
 )
 
-func AuthenticationMiddleware(ctx context.Context, options *server.Options) mux.MiddlewareFunc {
-	cache := jwk.NewCache(ctx)
-	cache.Register(options.OidcJwksURL)
+// BearerAuthenticator verifies bearer tokens: JWTs issued by the configured OIDC provider and personal
+// access tokens.
+type BearerAuthenticator struct {
+	options     *server.Options
+	db          *store.Store
+	keys        *jwk.Cache
+	toPrincipal session.PrincipalFunc
+}
+
+// NewBearerAuthenticator returns an authenticator that looks up personal access tokens in db. Signing keys
+// are fetched from the OIDC provider's JWKS and refreshed until ctx is cancelled.
+func NewBearerAuthenticator(ctx context.Context, options *server.Options, db *store.Store) *BearerAuthenticator {
+	keys := jwk.NewCache(ctx)
+	keys.Register(options.OidcJwksURL)
+
+	return &BearerAuthenticator{options: options, db: db, keys: keys, toPrincipal: PrincipalFromClaims(options)}
+}
+
+// Authenticate returns the principal that tokenStr was issued to. On failure, it also returns the HTTP status
+// that reports the error.
+func (a *BearerAuthenticator) Authenticate(ctx context.Context, tokenStr string) (*identity.Principal, int, error) {
+	if pat.IsToken(tokenStr) {
+		return authenticateAccessToken(a.db, tokenStr)
+	}
+
+	keys, err := a.keys.Get(ctx, a.options.OidcJwksURL)
+	if err != nil || keys == nil {
+		log.Printf("Failed to fetch JWKs from [%s]: %+v", a.options.OidcJwksURL, err)
+		return nil, http.StatusUnauthorized, errors.Errorf("failed to fetch JWKs from [%s]", a.options.OidcJwksURL)
+	}
+
+	token, err := jwt.ParseString(tokenStr,
+		jwt.WithKeySet(keys),
+		jwt.WithAudience(a.options.OidcAudience),
+	)
+	if err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+
+	claims, err := token.AsMap(ctx)
+	if err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+
+	return a.toPrincipal(claims), http.StatusOK, nil
+}
 
+// AuthenticationMiddleware accepts a bearer token or, if sessions is not nil, a browser session cookie. It
+// stores the caller's principal in the request context. Bearer tokens take precedence over the session
+// cookie.
+func AuthenticationMiddleware(bearer *BearerAuthenticator, sessions *session.Manager) mux.MiddlewareFunc {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			keys, err := cache.Get(r.Context(), options.OidcJwksURL)
-			if err != nil || keys == nil {
-				log.Printf("Failed to fetch JWKs from [%s]: %+v", options.OidcJwksURL, err)
-				http.Error(w, err.Error(), http.StatusUnauthorized)
-				return
-			}
-
 			authorizationHeader := r.Header.Get("Authorization")
 			tokenStr, _ := strings.CutPrefix(authorizationHeader, "Bearer ")
 
-			token, err := jwt.ParseString(tokenStr,
-				jwt.WithKeySet(keys),
-				jwt.WithAudience(options.OidcAudience),
-			)
+			if authorizationHeader == "" && sessions != nil {
+				if s := sessions.FromRequest(r); s != nil {
+					// Cookies are sent automatically, so mutations must prove they come from our pages.
+					if !sessions.CheckCSRF(r, s) {
+						http.Error(w, "missing or invalid "+session.CSRFHeader+" header", http.StatusForbidden)
+						return
+					}
+
+					next.ServeHTTP(w, r.WithContext(identity.WithPrincipal(r.Context(), s.Principal)))
+					return
+				}
+			}
+
+			principal, status, err := bearer.Authenticate(r.Context(), tokenStr)
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusUnauthorized)
+				http.Error(w, err.Error(), status)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(identity.WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+// PrincipalFromClaims returns a function that maps verified token claims to a principal, using the
+// configured claim mapping.
+func PrincipalFromClaims(options *server.Options) session.PrincipalFunc {
+	return func(claims map[string]interface{}) *identity.Principal {
+		principal := options.OidcClaims.Principal(claims)
+		if principal.Scopes == nil && !options.OidcRequireScopes {
+			// First-party tokens without a scope claim may do anything the user may do.
+			principal.Scopes = identity.KnownScopes
+		}
+
+		return principal
+	}
+}
+
+// authenticateAccessToken resolves a personal access token to the principal it was issued to.
+func authenticateAccessToken(db *store.Store, tokenStr string) (*identity.Principal, int, error) {
+	token, err := db.GetAccessTokenByHash(pat.Hash(tokenStr))
+	if err != nil {
+		log.Printf("Failed to look up access token: %+v", err)
+		return nil, http.StatusInternalServerError, errAccessTokenLookup
+	}
+
+	now := time.Now()
+	if token == nil || !token.Active(now) {
+		return nil, http.StatusUnauthorized, errInvalidAccessToken
+	}
+
+	if err := db.TouchAccessToken(token.ID, now); err != nil {
+		log.Printf("Failed to record access token use: %+v", err)
+	}
+
+	principal := &identity.Principal{
+		Subject:    token.Subject,
+		Scopes:     token.ScopeList(),
+		AuthMethod: identity.AuthMethodPAT,
+	}
+
+	return principal, http.StatusOK, nil
+}
+
+var (
+	errAccessTokenLookup  = errors.New("failed to verify access token")
+	errInvalidAccessToken = errors.New("access token is invalid, expired or revoked")
+)
+
+// RequireScopes returns middleware that rejects callers whose token doesn't grant all of scopes.
+// It must run after AuthenticationMiddleware.
+func RequireScopes(scopes ...string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal := identity.FromContext(r.Context())
+			if principal == nil {
+				http.Error(w, "context does not contain a subject value", http.StatusUnauthorized)
 				return
 			}
 
-			ctxWithIdentity := identity.WithSubject(r.Context(), token.Subject())
+			if missing := principal.MissingScopes(scopes...); len(missing) > 0 {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+					`Bearer error="insufficient_scope", error_description="token lacks required scopes", scope="%s"`,
+					strings.Join(scopes, " "),
+				))
+				http.Error(w, "insufficient scope: requires "+strings.Join(missing, ", "), http.StatusForbidden)
+				return
+			}
 
-			next.ServeHTTP(w, r.WithContext(ctxWithIdentity))
+			next.ServeHTTP(w, r)
 		})
 	}
 }
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"todo-go/pat"
+	"todo-go/store"
+)
+
+func TestAuthenticateAccessToken(t *testing.T) {
+	db, err := store.NewMemoryStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	now := time.Now().UTC()
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+
+	tokens := map[string]*store.AccessToken{
+		"active":  {ExpiresAt: &future},
+		"expired": {ExpiresAt: &past},
+		"revoked": {},
+	}
+
+	secrets := map[string]string{}
+	for name, token := range tokens {
+		secret, hash, err := pat.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token.ID, token.Subject, token.Name, token.Hash = name, "rick@the-citadel.com", name, hash
+		token.Scopes, token.CreatedAt = "todos:read", now
+		if err := db.InsertAccessToken(token); err != nil {
+			t.Fatal(err)
+		}
+
+		secrets[name] = secret
+	}
+
+	if revoked, err := db.RevokeAccessToken("revoked", "rick@the-citadel.com", past); err != nil || !revoked {
+		t.Fatalf("revoke: got %t and error %v", revoked, err)
+	}
+
+	unknown, _, err := pat.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]int{
+		"active":  http.StatusOK,
+		"expired": http.StatusUnauthorized,
+		"revoked": http.StatusUnauthorized,
+		"unknown": http.StatusUnauthorized,
+	} {
+		secret, ok := secrets[name]
+		if !ok {
+			secret = unknown
+		}
+
+		principal, status, err := authenticateAccessToken(db, secret)
+		if status != want || (err == nil) != (want == http.StatusOK) {
+			t.Errorf("%s: got status %d and error %v, want status %d", name, status, err, want)
+			continue
+		}
+
+		if want == http.StatusOK && (principal.Subject != "rick@the-citadel.com" || len(principal.Scopes) != 1) {
+			t.Errorf("%s: got principal %+v", name, principal)
+		}
+	}
+
+	if token, err := db.GetAccessTokenByHash(pat.Hash(secrets["active"])); err != nil || token.LastUsedAt == nil {
+		t.Errorf("got token %+v and error %v, want its use recorded", token, err)
+	}
+}
@@ -1,15 +1,25 @@
 package main
 
 import (
+	"context"
 	"net/http"
+	"strings"
+
+	"todo-go/directory"
 	"todo-go/identity"
+	"todo-go/localauthz"
 	"todo-go/server"
+	"todo-go/webhooks"
 
 	"github.com/aserto-dev/go-aserto"
 	"github.com/aserto-dev/go-aserto/az"
 	"github.com/aserto-dev/go-aserto/middleware"
 	"github.com/aserto-dev/go-aserto/middleware/gorillaz"
+	authz "github.com/aserto-dev/go-authorizer/aserto/authorizer/v2"
+	"github.com/aserto-dev/go-authorizer/aserto/authorizer/v2/api"
 	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 func NewAuthorizerClient(cfg *aserto.Config) (*az.Client, error) {
@@ -21,18 +31,200 @@ func NewAuthorizerClient(cfg *aserto.Config) (*az.Client, error) {
 	return az.New(opts...)
 }
 
-func AuthorizationMiddleware(azClient *az.Client, options *server.Options) *gorillaz.Middleware {
+// authorizerClient is an authorizer that holds resources to release when the server stops.
+type authorizerClient interface {
+	gorillaz.AuthorizerClient
+	Close() error
+}
+
+// NewAuthorizer returns the authorizer selected by the authorizer mode: a client for the remote authorizer,
+// or a local, non-production evaluator that uses the directory.
+func NewAuthorizer(options *server.Options, dir localauthz.Directory) (authorizerClient, error) {
+	if options.AuthorizerMode == server.ModeLocal {
+		return localauthz.New(dir, options.PolicyRoot), nil
+	}
+
+	return NewAuthorizerClient(options.Authorizer)
+}
+
+func AuthorizationMiddleware(azClient gorillaz.AuthorizerClient, options *server.Options) *gorillaz.Middleware {
 	policy := &middleware.Policy{
 		Name:     options.PolicyName,
 		Decision: "allowed",
 	}
 	// Create authorization middleware
 	authz := gorillaz.New(azClient, policy).
-		WithPolicyFromURL(options.PolicyRoot).
+		WithPolicyPathMapper(policyPathFromRoute(options.PolicyRoot)).
 		WithResourceMapper(func(r *http.Request, resource map[string]interface{}) {
 			resource["object_id"] = mux.Vars(r)["id"]
+			addPrincipal(r.Context(), resource)
 		})
 	authz.Identity.Subject().FromContextValue(identity.SubjectKey)
 
 	return authz
 }
+
+// addPrincipal gives policies the caller's attributes, e.g. for domain-based access, and the scopes their
+// token grants.
+func addPrincipal(ctx context.Context, resource map[string]interface{}) {
+	if principal := identity.FromContext(ctx); principal != nil {
+		attributes := principal.AsMap()
+		resource["principal"] = attributes
+		resource["scopes"] = attributes["scopes"]
+	}
+}
+
+// policyPathFromRoute returns a mapper that derives the policy path from the method and the path template of
+// the matched route, without the API version. For example, PUT /v1/todos/{id} maps to
+// "<root>.PUT.todos.__id", so policies don't change when a new API version is added.
+func policyPathFromRoute(root string) func(r *http.Request) string {
+	root = strings.Trim(root, ".")
+
+	return func(r *http.Request) string {
+		template, err := mux.CurrentRoute(r).GetPathTemplate()
+		if err != nil {
+			template = r.URL.Path
+		}
+
+		template = strings.TrimPrefix(template, server.APIPrefix)
+
+		path := []string{r.Method}
+		if root != "" {
+			path = append([]string{root}, path...)
+		}
+
+		for _, segment := range strings.Split(strings.Trim(template, "/"), "/") {
+			if name, ok := strings.CutPrefix(segment, "{"); ok {
+				segment = "__" + strings.TrimSuffix(name, "}")
+			}
+
+			path = append(path, segment)
+		}
+
+		return strings.Join(path, ".")
+	}
+}
+
+// policyPath returns the path of a policy relative to the policy root.
+func policyPath(root, path string) string {
+	if root = strings.Trim(root, "."); root != "" {
+		return root + "." + path
+	}
+
+	return path
+}
+
+// routePolicy describes how an operation is authorized outside of the HTTP middleware: by the policy of the
+// HTTP route that performs it, so that all ways of performing it are subject to the same rules.
+type routePolicy struct {
+	// route is the HTTP route, such as "PUT /v1/todos/{id}", whose OAuth scopes the caller's token must grant.
+	route string
+	// policyPath is the policy path of the HTTP route, relative to the policy root.
+	policyPath string
+	// creator checks that the caller may create todos instead of evaluating policyPath.
+	creator bool
+}
+
+// isAllowed asks the authorizer whether subject may perform an operation governed by policy on the object
+// with the given ID, if any. The resource context is the same as for the HTTP route.
+func isAllowed(
+	ctx context.Context, azClient gorillaz.AuthorizerClient, options *server.Options, policy routePolicy,
+	subject, objectID string,
+) (bool, error) {
+	path := policyPath(options.PolicyRoot, policy.policyPath)
+
+	resource := map[string]interface{}{}
+
+	if policy.creator {
+		path = "rebac.check"
+		resource["object_type"] = directory.ResourceCreatorObjectType
+		resource["object_id"] = directory.ResourceCreatorsObjectID
+		resource["relation"] = directory.MemberRelation
+		resource["subject_type"] = directory.UserObjectType
+	} else {
+		if objectID != "" {
+			resource["object_id"] = objectID
+		}
+
+		addPrincipal(ctx, resource)
+	}
+
+	resourceContext, err := structpb.NewStruct(resource)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to build resource context")
+	}
+
+	resp, err := azClient.Is(ctx, &authz.IsRequest{
+		IdentityContext: &api.IdentityContext{Type: api.IdentityType_IDENTITY_TYPE_SUB, Identity: subject},
+		PolicyContext:   &api.PolicyContext{Path: path, Decisions: []string{"allowed"}},
+		ResourceContext: resourceContext,
+		PolicyInstance:  &api.PolicyInstance{Name: options.PolicyName, InstanceLabel: options.PolicyName},
+	})
+	switch {
+	case err != nil:
+		return false, err
+	case len(resp.GetDecisions()) != 1:
+		return false, errors.New("authorizer returned an invalid decision")
+	}
+
+	return resp.GetDecisions()[0].GetIs(), nil
+}
+
+// todoPolicies holds the policy of each action on a todo, which is the policy of the route that performs it.
+// Reading a todo is decided by the policy of listing todos, with the todo's ID.
+var todoPolicies = map[server.TodoAction]routePolicy{
+	server.TodoRead:   {route: "GET /v1/todos", policyPath: "GET.todos"},
+	server.TodoCreate: {route: "POST /v1/todos", creator: true},
+	server.TodoUpdate: {route: "PUT /v1/todos/{id}", policyPath: "PUT.todos.__id"},
+	server.TodoDelete: {route: "DELETE /v1/todos/{id}", policyPath: "DELETE.todos.__id"},
+}
+
+// todoAuthorizer returns an authorizer for actions on todos, such as the operations in a batch of todo
+// changes. Each action also requires the scopes of the route that performs it on its own.
+func todoAuthorizer(azClient gorillaz.AuthorizerClient, options *server.Options) server.TodoAuthorizer {
+	return func(ctx context.Context, action server.TodoAction, id string) (bool, error) {
+		policy, ok := todoPolicies[action]
+		if !ok {
+			return false, nil
+		}
+
+		principal := identity.FromContext(ctx)
+		if principal == nil || len(principal.MissingScopes(options.RouteScopes[policy.route]...)) > 0 {
+			return false, nil
+		}
+
+		return isAllowed(ctx, azClient, options, policy, principal.Subject, id)
+	}
+}
+
+// eventAccess returns a check of whether a user may receive an event about a todo, decided by the policy of
+// the event stream at "<root>.GET.events" and, like each event in a stream, by the policy of listing todos at
+// "<root>.GET.todos" with the todo's ID. Webhooks deliver events only to owners who could stream them.
+func eventAccess(azClient gorillaz.AuthorizerClient, options *server.Options) webhooks.AccessCheck {
+	stream := subjectAccess(azClient, options, routePolicy{policyPath: "GET.events"})
+	read := routePolicy{policyPath: "GET.todos"}
+
+	return func(ctx context.Context, subject, todoID string) (bool, error) {
+		if allowed, err := stream(ctx, subject); err != nil || !allowed {
+			return false, err
+		}
+
+		return isAllowed(ctx, azClient, options, read, subject, todoID)
+	}
+}
+
+// feedAccess returns a check of whether the owner of a calendar feed may list todos, decided by the policy at
+// "<root>.GET.todos". Feeds are only served to owners who could list their todos.
+func feedAccess(azClient gorillaz.AuthorizerClient, options *server.Options) server.FeedAccessCheck {
+	return subjectAccess(azClient, options, routePolicy{policyPath: "GET.todos"})
+}
+
+// subjectAccess returns a check of whether a user, who isn't making a request, is allowed by policy. Unlike
+// requests, the check carries no principal attributes or scopes.
+func subjectAccess(
+	azClient gorillaz.AuthorizerClient, options *server.Options, policy routePolicy,
+) func(ctx context.Context, subject string) (bool, error) {
+	return func(ctx context.Context, subject string) (bool, error) {
+		return isAllowed(ctx, azClient, options, policy, subject, "")
+	}
+}
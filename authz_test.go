@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestPolicyPathFromRoute(t *testing.T) {
+	mapper := policyPathFromRoute(".todoApp.")
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/todos/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(mapper(r)))
+	})
+
+	// Requests are served concurrently, so the mapper must not change shared state. Run with -race.
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("PUT", "/v1/todos/1", nil))
+
+			if got := w.Body.String(); got != "todoApp.PUT.todos.__id" {
+				t.Errorf("got policy path [%s], want todoApp.PUT.todos.__id", got)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"todo-go/directory"
+	"todo-go/server"
+
+	"github.com/aserto-dev/go-authorizer/aserto/authorizer/v2"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/pkg/errors"
+)
+
+const checkTimeout = 5 * time.Second
+
+// runCheck verifies that each external dependency is reachable and reports the result of every check.
+func runCheck(ctx context.Context, args []string) error {
+	options, err := loadOptions(server.NewOptionFlags("check"), args)
+	if err != nil {
+		return err
+	}
+
+	checks := []struct {
+		name string
+		run  func(context.Context, *server.Options) error
+	}{
+		{"directory", checkDirectory},
+		{"authorizer", checkAuthorizer},
+		{"jwks", checkJWKS},
+	}
+
+	failed := 0
+	for _, c := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+		err := c.run(checkCtx, options)
+		cancel()
+
+		if err != nil {
+			failed++
+			fmt.Printf("%-10s FAIL  %s\n", c.name, err)
+		} else {
+			fmt.Printf("%-10s OK\n", c.name)
+		}
+	}
+
+	for _, warning := range options.NonProduction() {
+		fmt.Printf("warning: NOT FOR PRODUCTION: %s\n", warning)
+	}
+
+	if failed > 0 {
+		return errors.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+
+	return nil
+}
+
+func checkDirectory(_ context.Context, options *server.Options) error {
+	if options.DirectoryMode == server.ModeMemory {
+		return nil
+	}
+
+	// NewDirectory issues a request to determine the directory's identity model.
+	dir, err := directory.NewDirectory(options.Directory, nil)
+	if err != nil {
+		return err
+	}
+
+	return dir.Close()
+}
+
+func checkAuthorizer(ctx context.Context, options *server.Options) error {
+	if options.AuthorizerMode == server.ModeLocal {
+		return nil
+	}
+
+	azClient, err := NewAuthorizerClient(options.Authorizer)
+	if err != nil {
+		return err
+	}
+	defer azClient.Close()
+
+	_, err = azClient.Info(ctx, &authorizer.InfoRequest{})
+
+	return err
+}
+
+func checkJWKS(ctx context.Context, options *server.Options) error {
+	_, err := jwk.Fetch(ctx, options.OidcJwksURL)
+	return err
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"todo-go/directory"
+	"todo-go/server"
+	"todo-go/store"
+
+	"github.com/pkg/errors"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, args []string) error
+}
+
+var commands = []*command{
+	{"serve", "start the todo API server (default)", runServe},
+	{"migrate", "apply pending database migrations", runMigrate},
+	{"seed", "create demo users and todos in the store and directory", runSeed},
+	{"export", "write all todos to a JSON file", runExport},
+	{"import", "load todos from a JSON file into the store and directory", runImport},
+	{"reconcile", "repair differences between the store and the directory", runReconcile},
+	{"check", "verify connectivity to the directory, authorizer and JWKS endpoint", runCheck},
+	{"token", "mint a development token (requires development auth)", runToken},
+	{"config", "'config print' shows the effective configuration with secrets redacted", runConfig},
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+
+	if name == "help" {
+		return &command{name: "help", run: func(context.Context, []string) error {
+			printUsage()
+			return nil
+		}}
+	}
+
+	return nil
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "usage: todo-go <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.usage)
+	}
+
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run 'todo-go <command> --help' to list the flags of a command.")
+}
+
+// loadOptions parses the command line and loads options.
+func loadOptions(flags *server.OptionFlags, args []string) (*server.Options, error) {
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	return server.LoadOptions(flags)
+}
+
+// openDeps opens the data store and connects to the directory.
+func openDeps(options *server.Options) (*store.Store, *directory.Directory, error) {
+	db, err := store.NewStore()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create store")
+	}
+
+	if options.DirectoryMode == server.ModeMemory {
+		dir, _ := directory.NewMemoryDirectory(options.IdentityCache)
+		return db, dir, nil
+	}
+
+	dir, err := directory.NewDirectory(options.Directory, options.IdentityCache)
+	if err != nil {
+		_ = db.Close()
+		return nil, nil, errors.Wrap(err, "failed to create directory connection")
+	}
+
+	return db, dir, nil
+}
+
+func runConfig(_ context.Context, args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return errors.New("usage: todo-go config print [flags]")
+	}
+
+	flags := server.NewOptionFlags("config print")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	options, err := server.ResolveOptions(flags)
+	if err != nil {
+		return err
+	}
+
+	if err := options.Print(os.Stdout); err != nil {
+		return err
+	}
+
+	return options.Validate()
+}
@@ -0,0 +1,233 @@
+// Package cors implements a CORS policy with an origin allowlist. Origins are either exact, such as
+// "https://app.example.com", or match any subdomain, such as "https://*.example.com".
+package cors
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AnyOrigin allows every origin. It can't be combined with credentials.
+const AnyOrigin = "*"
+
+// Config is a CORS policy.
+type Config struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache preflight results. Zero omits the header.
+	MaxAge time.Duration
+}
+
+// Validate returns a problem for each invalid setting.
+func (c *Config) Validate() []string {
+	var problems []string
+
+	for _, origin := range c.AllowedOrigins {
+		if origin == AnyOrigin {
+			if c.AllowCredentials {
+				problems = append(problems, `CORS origin "*" can't be allowed with credentials`)
+			}
+
+			continue
+		}
+
+		if _, err := parsePattern(origin); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if len(c.AllowedMethods) == 0 {
+		problems = append(problems, "CORS allowed methods must not be empty")
+	}
+
+	if c.MaxAge < 0 {
+		problems = append(problems, "CORS max age must not be negative")
+	}
+
+	return problems
+}
+
+// pattern is a parsed allowed origin.
+type pattern struct {
+	scheme string
+	// host includes the port, if any. For wildcard patterns it is the suffix that subdomains must end with,
+	// starting with a dot.
+	host     string
+	wildcard bool
+}
+
+func parsePattern(origin string) (*pattern, error) {
+	u, err := url.Parse(strings.ToLower(origin))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+		(u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.User != nil {
+		return nil, errors.Errorf("CORS origin [%s] must be a scheme and host, such as https://app.example.com", origin)
+	}
+
+	p := &pattern{scheme: u.Scheme, host: u.Host}
+
+	if strings.HasPrefix(u.Host, "*.") {
+		p.host = u.Host[1:]
+		p.wildcard = true
+	}
+
+	if strings.Contains(p.host, "*") {
+		return nil, errors.Errorf("CORS origin [%s] may only use a wildcard for the leftmost label", origin)
+	}
+
+	return p, nil
+}
+
+func (p *pattern) matches(scheme, host string) bool {
+	if scheme != p.scheme {
+		return false
+	}
+
+	if p.wildcard {
+		return len(host) > len(p.host) && strings.HasSuffix(host, p.host)
+	}
+
+	return host == p.host
+}
+
+// Policy applies a Config to requests.
+type Policy struct {
+	cfg       *Config
+	patterns  []*pattern
+	anyOrigin bool
+	methods   map[string]bool
+	headers   map[string]bool
+}
+
+// New returns the policy for cfg, which must be valid.
+func New(cfg *Config) *Policy {
+	p := &Policy{cfg: cfg, methods: map[string]bool{}, headers: map[string]bool{}}
+
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == AnyOrigin {
+			p.anyOrigin = true
+			continue
+		}
+
+		if pat, err := parsePattern(origin); err == nil {
+			p.patterns = append(p.patterns, pat)
+		}
+	}
+
+	for _, method := range cfg.AllowedMethods {
+		p.methods[strings.ToUpper(method)] = true
+	}
+
+	for _, header := range cfg.AllowedHeaders {
+		p.headers[http.CanonicalHeaderKey(header)] = true
+	}
+
+	return p
+}
+
+// AllowsOrigin reports whether requests from origin are allowed.
+func (p *Policy) AllowsOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+
+	u, err := url.Parse(strings.ToLower(origin))
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	for _, pat := range p.patterns {
+		if pat.matches(u.Scheme, u.Host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Handler applies the policy to requests before passing them to h. Preflight requests are answered
+// directly, and rejected with 403 if the origin, method or headers aren't allowed. Other requests from
+// disallowed origins are passed on without CORS headers, so browsers won't expose the response.
+func (p *Policy) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Responses differ by origin, so caches must not share them between origins.
+		w.Header().Add("Vary", "Origin")
+
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			p.preflight(w, r, origin)
+			return
+		}
+
+		if p.AllowsOrigin(origin) {
+			p.setOrigin(w, origin)
+
+			if len(p.cfg.ExposedHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(p.cfg.ExposedHeaders, ", "))
+			}
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (p *Policy) preflight(w http.ResponseWriter, r *http.Request, origin string) {
+	w.Header().Add("Vary", "Access-Control-Request-Method")
+	w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+	if !p.AllowsOrigin(origin) {
+		http.Error(w, "CORS origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	if method := r.Header.Get("Access-Control-Request-Method"); !p.methods[strings.ToUpper(method)] {
+		http.Error(w, "CORS method not allowed", http.StatusForbidden)
+		return
+	}
+
+	for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		header = strings.TrimSpace(header)
+		if header != "" && !p.headers[http.CanonicalHeaderKey(header)] {
+			http.Error(w, "CORS header not allowed: "+header, http.StatusForbidden)
+			return
+		}
+	}
+
+	p.setOrigin(w, origin)
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(p.cfg.AllowedMethods, ", "))
+
+	if len(p.cfg.AllowedHeaders) > 0 {
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(p.cfg.AllowedHeaders, ", "))
+	}
+
+	if p.cfg.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(p.cfg.MaxAge.Seconds())))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *Policy) setOrigin(w http.ResponseWriter, origin string) {
+	if p.anyOrigin && !p.cfg.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Origin", AnyOrigin)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+
+	if p.cfg.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
@@ -0,0 +1,154 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testConfig() *Config {
+	return &Config{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		ExposedHeaders:   []string{"Idempotent-Replayed"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+}
+
+func TestAllowsOrigin(t *testing.T) {
+	policy := New(testConfig())
+
+	for origin, want := range map[string]bool{
+		"https://app.example.com":      true,
+		"HTTPS://APP.EXAMPLE.COM":      true,
+		"https://a.example.org":        true,
+		"https://a.b.example.org":      true,
+		"https://example.org":          false,
+		"https://evil-example.org":     false,
+		"https://example.org.evil.com": false,
+		"https://.example.org":         false,
+		"http://app.example.com":       false,
+		"http://a.example.org":         false,
+		"https://app.example.com:8443": false,
+		"https://evil.com":             false,
+		"null":                         false,
+		"":                             false,
+	} {
+		if got := policy.AllowsOrigin(origin); got != want {
+			t.Errorf("%q: got %t, want %t", origin, got, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		change   func(c *Config)
+		problems int
+	}{
+		{"valid", func(*Config) {}, 0},
+		{"any origin with credentials", func(c *Config) { c.AllowedOrigins = []string{AnyOrigin} }, 1},
+		{"any origin without credentials", func(c *Config) {
+			c.AllowedOrigins = []string{AnyOrigin}
+			c.AllowCredentials = false
+		}, 0},
+		{"path", func(c *Config) { c.AllowedOrigins = []string{"https://app.example.com/todos"} }, 1},
+		{"no scheme", func(c *Config) { c.AllowedOrigins = []string{"app.example.com"} }, 1},
+		{"inner wildcard", func(c *Config) { c.AllowedOrigins = []string{"https://app.*.example.com"} }, 1},
+		{"no methods", func(c *Config) { c.AllowedMethods = nil }, 1},
+		{"negative max age", func(c *Config) { c.MaxAge = -time.Second }, 1},
+	} {
+		cfg := testConfig()
+		tc.change(cfg)
+
+		if problems := cfg.Validate(); len(problems) != tc.problems {
+			t.Errorf("%s: got problems %q, want %d", tc.name, problems, tc.problems)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	handler := New(testConfig()).Handler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, tc := range []struct {
+		name    string
+		method  string
+		origin  string
+		request map[string]string
+		status  int
+		allowed bool
+	}{
+		{"same origin", "GET", "", nil, http.StatusOK, false},
+		{"allowed origin", "GET", "https://app.example.com", nil, http.StatusOK, true},
+		// Browsers don't expose responses without CORS headers, so the request is still served.
+		{"disallowed origin", "GET", "https://evil.com", nil, http.StatusOK, false},
+		{
+			"preflight", "OPTIONS", "https://a.example.org",
+			map[string]string{"Access-Control-Request-Method": "PUT", "Access-Control-Request-Headers": "content-type, authorization"},
+			http.StatusNoContent, true,
+		},
+		{
+			"preflight from disallowed origin", "OPTIONS", "https://example.org",
+			map[string]string{"Access-Control-Request-Method": "GET"}, http.StatusForbidden, false,
+		},
+		{
+			"preflight with disallowed method", "OPTIONS", "https://app.example.com",
+			map[string]string{"Access-Control-Request-Method": "PATCH"}, http.StatusForbidden, false,
+		},
+		{
+			"preflight with disallowed header", "OPTIONS", "https://app.example.com",
+			map[string]string{"Access-Control-Request-Method": "POST", "Access-Control-Request-Headers": "Content-Type, X-Evil"},
+			http.StatusForbidden, false,
+		},
+	} {
+		r := httptest.NewRequest(tc.method, "/v1/todos", nil)
+		if tc.origin != "" {
+			r.Header.Set("Origin", tc.origin)
+		}
+
+		for name, value := range tc.request {
+			r.Header.Set(name, value)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		allowOrigin := w.Header().Get("Access-Control-Allow-Origin")
+
+		switch {
+		case w.Code != tc.status:
+			t.Errorf("%s: got status %d, want %d", tc.name, w.Code, tc.status)
+		case tc.allowed && (allowOrigin != tc.origin || w.Header().Get("Access-Control-Allow-Credentials") != "true"):
+			t.Errorf("%s: got headers %v, want the origin allowed with credentials", tc.name, w.Header())
+		case !tc.allowed && allowOrigin != "":
+			t.Errorf("%s: got Access-Control-Allow-Origin [%s], want none", tc.name, allowOrigin)
+		}
+
+		// Whether the origin is allowed or not, responses differ by origin.
+		if vary := strings.Join(w.Header().Values("Vary"), ", "); !strings.Contains(vary, "Origin") {
+			t.Errorf("%s: got Vary [%s], want Origin", tc.name, vary)
+		}
+	}
+}
+
+func TestAnyOriginWithoutCredentials(t *testing.T) {
+	cfg := testConfig()
+	cfg.AllowedOrigins = []string{AnyOrigin}
+	cfg.AllowCredentials = false
+
+	r := httptest.NewRequest("GET", "/v1/todos", nil)
+	r.Header.Set("Origin", "https://anywhere.example")
+
+	w := httptest.NewRecorder()
+	New(cfg).Handler(http.NotFoundHandler()).ServeHTTP(w, r)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != AnyOrigin {
+		t.Errorf("got Access-Control-Allow-Origin [%s], want *", got)
+	}
+}
@@ -0,0 +1,167 @@
+// Package decisioncache caches authorization decisions in-process for a short time.
+package decisioncache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	authz "github.com/aserto-dev/go-authorizer/aserto/authorizer/v2"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// Config determines how long decisions are cached and how many are kept.
+type Config struct {
+	// TTL is how long a decision is cached. Zero disables caching.
+	TTL time.Duration
+	// MaxEntries bounds the number of cached decisions.
+	MaxEntries int
+}
+
+type entry struct {
+	resp     *authz.IsResponse
+	objectID string
+	expires  time.Time
+}
+
+// Authorizer wraps an authorizer client and caches the responses to Is calls, keyed by identity, policy and
+// resource context. Cached decisions about an object are dropped when its relations change.
+type Authorizer struct {
+	authz.AuthorizerClient
+
+	cfg Config
+
+	mu       sync.Mutex
+	entries  map[string]*entry
+	byObject map[string]map[string]struct{}
+}
+
+func NewAuthorizer(client authz.AuthorizerClient, cfg *Config) *Authorizer {
+	return &Authorizer{
+		AuthorizerClient: client,
+		cfg:              *cfg,
+		entries:          map[string]*entry{},
+		byObject:         map[string]map[string]struct{}{},
+	}
+}
+
+func (a *Authorizer) Is(ctx context.Context, in *authz.IsRequest, opts ...grpc.CallOption) (*authz.IsResponse, error) {
+	if a.cfg.TTL <= 0 {
+		return a.AuthorizerClient.Is(ctx, in, opts...)
+	}
+
+	key, err := cacheKey(in)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to compute decision cache key")
+		return a.AuthorizerClient.Is(ctx, in, opts...)
+	}
+
+	if resp := a.get(key); resp != nil {
+		return resp, nil
+	}
+
+	resp, err := a.AuthorizerClient.Is(ctx, in, opts...)
+	if err != nil {
+		return resp, err
+	}
+
+	a.put(key, in.GetResourceContext().GetFields()["object_id"].GetStringValue(), resp)
+
+	return resp, nil
+}
+
+// InvalidateObject drops all cached decisions about the object with the given ID.
+// Its signature matches directory.RelationObserver.
+func (a *Authorizer) InvalidateObject(_, objectID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for key := range a.byObject[objectID] {
+		delete(a.entries, key)
+	}
+	delete(a.byObject, objectID)
+
+	// Decisions without an object (e.g. listing todos) may depend on any relation.
+	for key := range a.byObject[""] {
+		delete(a.entries, key)
+	}
+	delete(a.byObject, "")
+}
+
+// InvalidateAll drops all cached decisions.
+func (a *Authorizer) InvalidateAll() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.entries = map[string]*entry{}
+	a.byObject = map[string]map[string]struct{}{}
+}
+
+func (a *Authorizer) get(key string) *authz.IsResponse {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	e, ok := a.entries[key]
+	if !ok {
+		return nil
+	}
+
+	if time.Now().After(e.expires) {
+		a.remove(key, e)
+		return nil
+	}
+
+	return e.resp
+}
+
+func (a *Authorizer) put(key, objectID string, resp *authz.IsResponse) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.cfg.MaxEntries > 0 && len(a.entries) >= a.cfg.MaxEntries {
+		a.evictExpired()
+	}
+
+	if a.cfg.MaxEntries > 0 && len(a.entries) >= a.cfg.MaxEntries {
+		// Still full. Start over rather than tracking recency on every hit.
+		a.entries = map[string]*entry{}
+		a.byObject = map[string]map[string]struct{}{}
+	}
+
+	a.entries[key] = &entry{resp: resp, objectID: objectID, expires: time.Now().Add(a.cfg.TTL)}
+
+	keys, ok := a.byObject[objectID]
+	if !ok {
+		keys = map[string]struct{}{}
+		a.byObject[objectID] = keys
+	}
+	keys[key] = struct{}{}
+}
+
+func (a *Authorizer) evictExpired() {
+	now := time.Now()
+	for key, e := range a.entries {
+		if now.After(e.expires) {
+			a.remove(key, e)
+		}
+	}
+}
+
+func (a *Authorizer) remove(key string, e *entry) {
+	delete(a.entries, key)
+
+	if keys, ok := a.byObject[e.objectID]; ok {
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(a.byObject, e.objectID)
+		}
+	}
+}
+
+// cacheKey serializes the request, which holds everything that determines the decision.
+func cacheKey(in *authz.IsRequest) (string, error) {
+	key, err := proto.MarshalOptions{Deterministic: true}.Marshal(in)
+	return string(key), err
+}
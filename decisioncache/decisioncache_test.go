@@ -0,0 +1,123 @@
+package decisioncache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	authz "github.com/aserto-dev/go-authorizer/aserto/authorizer/v2"
+	api "github.com/aserto-dev/go-authorizer/aserto/authorizer/v2/api"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// countingClient allows everything and counts the decisions it makes, per object ID.
+type countingClient struct {
+	authz.AuthorizerClient
+	calls map[string]int
+}
+
+func (c *countingClient) Is(_ context.Context, in *authz.IsRequest, _ ...grpc.CallOption) (*authz.IsResponse, error) {
+	c.calls[in.GetResourceContext().GetFields()["object_id"].GetStringValue()]++
+	return &authz.IsResponse{Decisions: []*authz.Decision{{Decision: "allowed", Is: true}}}, nil
+}
+
+func newTestCache(cfg Config) (*Authorizer, *countingClient) {
+	client := &countingClient{calls: map[string]int{}}
+	return NewAuthorizer(client, &cfg), client
+}
+
+// ask makes a decision about the object with the given ID, or about no object if it is empty.
+func ask(t *testing.T, a *Authorizer, objectID string) {
+	t.Helper()
+
+	resource := map[string]interface{}{}
+	if objectID != "" {
+		resource["object_id"] = objectID
+	}
+
+	resourceContext, err := structpb.NewStruct(resource)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := a.Is(context.Background(), &authz.IsRequest{
+		IdentityContext: &api.IdentityContext{Type: api.IdentityType_IDENTITY_TYPE_SUB, Identity: "rick"},
+		PolicyContext:   &api.PolicyContext{Path: "todoApp.PUT.todos.__id", Decisions: []string{"allowed"}},
+		ResourceContext: resourceContext,
+	})
+	if err != nil || !resp.GetDecisions()[0].GetIs() {
+		t.Fatalf("got %v, %v, want allowed", resp, err)
+	}
+}
+
+func TestCache(t *testing.T) {
+	a, client := newTestCache(Config{TTL: time.Minute, MaxEntries: 100})
+
+	ask(t, a, "1")
+	ask(t, a, "1")
+
+	if client.calls["1"] != 1 {
+		t.Errorf("got %d decisions, want the second one cached", client.calls["1"])
+	}
+
+	disabled, client := newTestCache(Config{})
+	ask(t, disabled, "1")
+	ask(t, disabled, "1")
+
+	if client.calls["1"] != 2 {
+		t.Errorf("got %d decisions with a zero TTL, want none cached", client.calls["1"])
+	}
+}
+
+func TestInvalidateObject(t *testing.T) {
+	a, client := newTestCache(Config{TTL: time.Minute, MaxEntries: 100})
+
+	for _, id := range []string{"1", "2", ""} {
+		ask(t, a, id)
+	}
+
+	// The relations of todo 1 changed. Decisions without an object, such as listing todos, may depend on them.
+	a.InvalidateObject("todo", "1")
+
+	for _, id := range []string{"1", "2", ""} {
+		ask(t, a, id)
+	}
+
+	for id, want := range map[string]int{"1": 2, "2": 1, "": 2} {
+		if client.calls[id] != want {
+			t.Errorf("object [%s]: got %d decisions, want %d", id, client.calls[id], want)
+		}
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	a, client := newTestCache(Config{TTL: 20 * time.Millisecond, MaxEntries: 100})
+
+	ask(t, a, "1")
+	time.Sleep(30 * time.Millisecond)
+	ask(t, a, "1")
+
+	if client.calls["1"] != 2 {
+		t.Errorf("got %d decisions, want the expired one made again", client.calls["1"])
+	}
+}
+
+func TestFlushWhenFull(t *testing.T) {
+	a, client := newTestCache(Config{TTL: time.Minute, MaxEntries: 2})
+
+	// The third decision finds the cache full of live entries, and replaces them.
+	for _, id := range []string{"1", "2", "3", "3", "1"} {
+		ask(t, a, id)
+	}
+
+	for id, want := range map[string]int{"1": 2, "2": 1, "3": 1} {
+		if client.calls[id] != want {
+			t.Errorf("object [%s]: got %d decisions, want %d", id, client.calls[id], want)
+		}
+	}
+
+	if len(a.entries) > 2 {
+		t.Errorf("got %d cached decisions, want at most 2", len(a.entries))
+	}
+}
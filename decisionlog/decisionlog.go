@@ -0,0 +1,84 @@
+// Package decisionlog records the outcome of every authorization decision made by the authorizer.
+package decisionlog
+
+import (
+	"context"
+	"time"
+
+	authz "github.com/aserto-dev/go-authorizer/aserto/authorizer/v2"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+)
+
+// Decision is a single authorization decision.
+type Decision struct {
+	Time       time.Time `json:"time"`
+	Subject    string    `json:"subject"`
+	PolicyPath string    `json:"policy_path"`
+	ObjectType string    `json:"object_type,omitempty"`
+	ObjectID   string    `json:"object_id,omitempty"`
+	Relation   string    `json:"relation,omitempty"`
+	Allowed    bool      `json:"allowed"`
+	LatencyMS  float64   `json:"latency_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Sink receives decisions. Implementations must be safe for concurrent use.
+type Sink interface {
+	Write(ctx context.Context, decision *Decision) error
+	Close() error
+}
+
+// Authorizer wraps an authorizer client and writes each decision it makes to a sink.
+// Denied requests and errors are always recorded. Allowed requests are recorded only if includeAllowed is set.
+type Authorizer struct {
+	authz.AuthorizerClient
+
+	sink           Sink
+	includeAllowed bool
+}
+
+func NewAuthorizer(client authz.AuthorizerClient, sink Sink, includeAllowed bool) *Authorizer {
+	return &Authorizer{AuthorizerClient: client, sink: sink, includeAllowed: includeAllowed}
+}
+
+func (a *Authorizer) Is(ctx context.Context, in *authz.IsRequest, opts ...grpc.CallOption) (*authz.IsResponse, error) {
+	start := time.Now()
+	resp, err := a.AuthorizerClient.Is(ctx, in, opts...)
+	latency := time.Since(start)
+
+	decision := newDecision(in, start, latency)
+
+	switch {
+	case err != nil:
+		decision.Error = err.Error()
+	case len(resp.Decisions) > 0:
+		decision.Allowed = resp.Decisions[0].Is
+	}
+
+	if decision.Allowed && !a.includeAllowed {
+		return resp, err
+	}
+
+	if writeErr := a.sink.Write(ctx, decision); writeErr != nil {
+		log.Err(writeErr).Msg("failed to write decision log")
+	}
+
+	return resp, err
+}
+
+func newDecision(in *authz.IsRequest, start time.Time, latency time.Duration) *Decision {
+	decision := &Decision{
+		Time:       start.UTC(),
+		Subject:    in.GetIdentityContext().GetIdentity(),
+		PolicyPath: in.GetPolicyContext().GetPath(),
+		LatencyMS:  float64(latency.Microseconds()) / float64(time.Millisecond/time.Microsecond),
+	}
+
+	fields := in.GetResourceContext().GetFields()
+	decision.ObjectType = fields["object_type"].GetStringValue()
+	decision.ObjectID = fields["object_id"].GetStringValue()
+	decision.Relation = fields["relation"].GetStringValue()
+
+	return decision
+}
@@ -0,0 +1,132 @@
+package decisionlog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	authz "github.com/aserto-dev/go-authorizer/aserto/authorizer/v2"
+	api "github.com/aserto-dev/go-authorizer/aserto/authorizer/v2/api"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// stubClient allows the objects in allowed and fails decisions about "broken".
+type stubClient struct {
+	authz.AuthorizerClient
+	allowed map[string]bool
+}
+
+func (c *stubClient) Is(_ context.Context, in *authz.IsRequest, _ ...grpc.CallOption) (*authz.IsResponse, error) {
+	id := in.GetResourceContext().GetFields()["object_id"].GetStringValue()
+	if id == "broken" {
+		return nil, errors.New("authorizer unavailable")
+	}
+
+	return &authz.IsResponse{Decisions: []*authz.Decision{{Decision: "allowed", Is: c.allowed[id]}}}, nil
+}
+
+// memorySink keeps the decisions written to it.
+type memorySink struct {
+	mu        sync.Mutex
+	decisions []*Decision
+}
+
+func (s *memorySink) Write(_ context.Context, d *Decision) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.decisions = append(s.decisions, d)
+
+	return nil
+}
+
+func (s *memorySink) Close() error { return nil }
+
+func isRequest(t *testing.T, objectID string) *authz.IsRequest {
+	t.Helper()
+
+	resource, err := structpb.NewStruct(map[string]interface{}{"object_type": "todo", "object_id": objectID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &authz.IsRequest{
+		IdentityContext: &api.IdentityContext{Type: api.IdentityType_IDENTITY_TYPE_SUB, Identity: "rick"},
+		PolicyContext:   &api.PolicyContext{Path: "todoApp.DELETE.todos.__id", Decisions: []string{"allowed"}},
+		ResourceContext: resource,
+	}
+}
+
+func TestAuthorizerRecordsDecisions(t *testing.T) {
+	for _, includeAllowed := range []bool{false, true} {
+		sink := &memorySink{}
+		a := NewAuthorizer(&stubClient{allowed: map[string]bool{"mine": true}}, sink, includeAllowed)
+
+		for _, id := range []string{"mine", "theirs", "broken"} {
+			_, _ = a.Is(context.Background(), isRequest(t, id), nil...)
+		}
+
+		logged := map[string]*Decision{}
+		for _, d := range sink.decisions {
+			logged[d.ObjectID] = d
+		}
+
+		// Denied decisions and errors are always recorded.
+		switch theirs, broken := logged["theirs"], logged["broken"]; {
+		case theirs == nil || theirs.Allowed || theirs.Subject != "rick" || theirs.PolicyPath != "todoApp.DELETE.todos.__id" ||
+			theirs.ObjectType != "todo":
+			t.Errorf("include allowed %t: got denied decision %+v", includeAllowed, theirs)
+		case broken == nil || broken.Allowed || broken.Error != "authorizer unavailable":
+			t.Errorf("include allowed %t: got failed decision %+v", includeAllowed, broken)
+		}
+
+		if mine := logged["mine"]; (mine != nil) != includeAllowed || (mine != nil && !mine.Allowed) {
+			t.Errorf("include allowed %t: got allowed decision %+v", includeAllowed, mine)
+		}
+	}
+}
+
+func TestJSONLSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decisions.jsonl")
+
+	sink, err := NewSink(&Config{Sink: SinkJSONL, Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"1", "2"} {
+		if err := sink.Write(context.Background(), &Decision{Subject: "rick", ObjectID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var ids []string
+	for lines := bufio.NewScanner(file); lines.Scan(); {
+		var d Decision
+		if err := json.Unmarshal(lines.Bytes(), &d); err != nil {
+			t.Fatal(err)
+		}
+
+		ids = append(ids, d.ObjectID)
+	}
+
+	if len(ids) != 2 || ids[0] != "1" || ids[1] != "2" {
+		t.Errorf("got decisions about %v, want one line per decision", ids)
+	}
+}
@@ -0,0 +1,189 @@
+package decisionlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	SinkNone    = "none"
+	SinkLog     = "log"
+	SinkJSONL   = "jsonl"
+	SinkWebhook = "webhook"
+
+	webhookQueueSize = 1024
+	webhookTimeout   = 5 * time.Second
+)
+
+// Config determines where decisions are recorded.
+type Config struct {
+	// Sink is one of "none", "log", "jsonl" or "webhook".
+	Sink string
+	// Path is the file that decisions are appended to by the "jsonl" sink.
+	Path string
+	// URL is the endpoint that decisions are posted to by the "webhook" sink.
+	URL string
+	// IncludeAllowed records allowed decisions in addition to denied ones.
+	IncludeAllowed bool
+}
+
+// NewSink creates the sink described by cfg.
+func NewSink(cfg *Config) (Sink, error) {
+	switch cfg.Sink {
+	case SinkNone:
+		return nopSink{}, nil
+	case SinkLog, "":
+		return logSink{}, nil
+	case SinkJSONL:
+		return newJSONLSink(cfg.Path)
+	case SinkWebhook:
+		return newWebhookSink(cfg.URL), nil
+	default:
+		return nil, errors.Errorf("unknown decision log sink [%s]", cfg.Sink)
+	}
+}
+
+type nopSink struct{}
+
+func (nopSink) Write(context.Context, *Decision) error { return nil }
+func (nopSink) Close() error                           { return nil }
+
+// logSink writes decisions to the application log. Denied decisions are logged as warnings.
+type logSink struct{}
+
+func (logSink) Write(_ context.Context, d *Decision) error {
+	event := log.Info()
+	if !d.Allowed {
+		event = log.Warn()
+	}
+
+	event.
+		Str("subject", d.Subject).
+		Str("policy_path", d.PolicyPath).
+		Str("object_type", d.ObjectType).
+		Str("object_id", d.ObjectID).
+		Str("relation", d.Relation).
+		Bool("allowed", d.Allowed).
+		Float64("latency_ms", d.LatencyMS).
+		Str("error", d.Error).
+		Msg("authorization decision")
+
+	return nil
+}
+
+func (logSink) Close() error { return nil }
+
+// jsonlSink appends one JSON object per decision to a file.
+type jsonlSink struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+func newJSONLSink(path string) (*jsonlSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open decision log [%s]", path)
+	}
+
+	return &jsonlSink{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+func (s *jsonlSink) Write(_ context.Context, d *Decision) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.enc.Encode(d)
+}
+
+func (s *jsonlSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
+
+// webhookSink posts each decision as JSON to a URL. Decisions are delivered in the background so that
+// a slow endpoint doesn't delay requests. If the queue is full, decisions are dropped with a warning.
+type webhookSink struct {
+	url    string
+	client *http.Client
+	queue  chan *Decision
+	done   chan struct{}
+}
+
+func newWebhookSink(url string) *webhookSink {
+	s := &webhookSink{
+		url:    url,
+		client: &http.Client{Timeout: webhookTimeout},
+		queue:  make(chan *Decision, webhookQueueSize),
+		done:   make(chan struct{}),
+	}
+
+	go s.deliver()
+
+	return s
+}
+
+func (s *webhookSink) Write(_ context.Context, d *Decision) error {
+	select {
+	case s.queue <- d:
+		return nil
+	default:
+		return errors.New("decision log webhook queue is full")
+	}
+}
+
+// Close stops accepting decisions and waits for queued ones to be delivered.
+func (s *webhookSink) Close() error {
+	close(s.queue)
+	<-s.done
+
+	return nil
+}
+
+func (s *webhookSink) deliver() {
+	defer close(s.done)
+
+	for d := range s.queue {
+		if err := s.post(d); err != nil {
+			log.Warn().Err(err).Str("url", s.url).Msg("failed to deliver decision")
+		}
+	}
+}
+
+func (s *webhookSink) post(d *Decision) error {
+	body, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return errors.Errorf("webhook responded with %s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,221 @@
+// Package devauth implements a token issuer for local development. It signs tokens with a key kept in a local
+// file and publishes the public key as a JWKS, so the server's regular JWT validation can trust it.
+package devauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// JWKSPath and TokenPath are the routes served by the issuer.
+	JWKSPath  = "/dev/jwks.json"
+	TokenPath = "/dev/token"
+
+	// IssuerName is the "iss" claim of minted tokens.
+	IssuerName = "todo-go-dev"
+
+	signingAlgorithm = jwa.ES256
+	maxRequestSize   = 64 << 10
+)
+
+// Config enables the development token issuer.
+type Config struct {
+	Enabled bool
+	// KeyPath is the PEM file holding the signing key. It is created if it doesn't exist.
+	KeyPath string
+	// TokenTTL is the default lifetime of minted tokens.
+	TokenTTL time.Duration
+}
+
+// Issuer mints tokens signed with a local key.
+type Issuer struct {
+	key  jwk.Key
+	jwks jwk.Set
+	ttl  time.Duration
+	aud  string
+
+	mu    sync.Mutex
+	codes map[string]*authCode
+}
+
+// LoadOrCreate returns an issuer that signs with the key in cfg.KeyPath, generating and saving a new key
+// if the file doesn't exist. audience is the default "aud" claim of minted tokens.
+func LoadOrCreate(cfg *Config, audience string) (*Issuer, error) {
+	raw, err := loadKey(cfg.KeyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		raw, err = createKey(cfg.KeyPath)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := jwk.FromRaw(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid signing key")
+	}
+
+	if err := jwk.AssignKeyID(key); err != nil {
+		return nil, errors.Wrap(err, "failed to assign key ID")
+	}
+
+	if err := key.Set(jwk.AlgorithmKey, signingAlgorithm); err != nil {
+		return nil, err
+	}
+
+	pub, err := jwk.PublicKeyOf(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to derive public key")
+	}
+
+	jwks := jwk.NewSet()
+	if err := jwks.AddKey(pub); err != nil {
+		return nil, err
+	}
+
+	return &Issuer{key: key, jwks: jwks, ttl: cfg.TokenTTL, aud: audience, codes: map[string]*authCode{}}, nil
+}
+
+// TokenRequest describes a token to mint. Only the subject is required.
+type TokenRequest struct {
+	Subject  string         `json:"sub"`
+	Audience []string       `json:"aud,omitempty"`
+	TTL      string         `json:"ttl,omitempty"`
+	Claims   map[string]any `json:"claims,omitempty"`
+}
+
+// Mint returns a signed token for the request.
+func (i *Issuer) Mint(req *TokenRequest) (string, error) {
+	if req.Subject == "" {
+		return "", errors.New("subject is required")
+	}
+
+	ttl := i.ttl
+	if req.TTL != "" {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil || d <= 0 {
+			return "", errors.Errorf("invalid ttl [%s]", req.TTL)
+		}
+		ttl = d
+	}
+
+	audience := req.Audience
+	if len(audience) == 0 {
+		audience = []string{i.aud}
+	}
+
+	now := time.Now()
+	builder := jwt.NewBuilder().
+		Issuer(IssuerName).
+		Subject(req.Subject).
+		Audience(audience).
+		IssuedAt(now).
+		NotBefore(now).
+		Expiration(now.Add(ttl))
+
+	for name, value := range req.Claims {
+		builder = builder.Claim(name, value)
+	}
+
+	token, err := builder.Build()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to build token")
+	}
+
+	signed, err := jwt.Sign(token, jwt.WithKey(signingAlgorithm, i.key))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to sign token")
+	}
+
+	return string(signed), nil
+}
+
+// JWKS serves the issuer's public key set.
+func (i *Issuer) JWKS(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(i.jwks); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Token mints a token for the TokenRequest in the request body.
+func (i *Issuer) Token(w http.ResponseWriter, r *http.Request) {
+	var req TokenRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	token, err := i.Mint(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Info().Str("subject", req.Subject).Msg("issued development token")
+
+	w.Header().Add("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]string{"access_token": token, "token_type": "Bearer"}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func loadKey(path string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.Errorf("no PEM data in [%s]", path)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse signing key [%s]", path)
+	}
+
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.Errorf("signing key [%s] is not an ECDSA key", path)
+	}
+
+	return ecKey, nil
+}
+
+func createKey(path string) (*ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate signing key")
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return nil, errors.Wrapf(err, "failed to save signing key [%s]", path)
+	}
+
+	log.Info().Str("path", path).Msg("generated development signing key")
+
+	return key, nil
+}
@@ -0,0 +1,112 @@
+package devauth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"todo-go/devauth"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+const audience = "todo-go"
+
+func newIssuer(t *testing.T, keyPath string) *devauth.Issuer {
+	t.Helper()
+
+	issuer, err := devauth.LoadOrCreate(&devauth.Config{KeyPath: keyPath, TokenTTL: time.Hour}, audience)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return issuer
+}
+
+func mint(t *testing.T, issuer *devauth.Issuer, req *devauth.TokenRequest) string {
+	t.Helper()
+
+	token, err := issuer.Mint(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+// TestTokensValidateThroughJWKS validates minted tokens the way the server does: with keys fetched from the
+// issuer's JWKS through a jwk.Cache.
+func TestTokensValidateThroughJWKS(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "dev.pem")
+	issuer := newIssuer(t, keyPath)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(devauth.JWKSPath, issuer.JWKS)
+	jwksServer := httptest.NewServer(mux)
+	defer jwksServer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	jwksURL := jwksServer.URL + devauth.JWKSPath
+	cache := jwk.NewCache(ctx)
+	if err := cache.Register(jwksURL); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := cache.Get(ctx, jwksURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parse := func(token string) (jwt.Token, error) {
+		return jwt.ParseString(token, jwt.WithKeySet(keys), jwt.WithAudience(audience))
+	}
+
+	token, err := parse(mint(t, issuer, &devauth.TokenRequest{
+		Subject: "rick@the-citadel.com",
+		Claims:  map[string]any{"email": "rick@the-citadel.com"},
+	}))
+	if err != nil {
+		t.Fatalf("minted token: %v", err)
+	}
+
+	if email, _ := token.Get("email"); token.Subject() != "rick@the-citadel.com" || token.Issuer() != devauth.IssuerName ||
+		email != "rick@the-citadel.com" {
+		t.Errorf("got subject %q, issuer %q and email %v", token.Subject(), token.Issuer(), email)
+	}
+
+	// An issuer restarted with the same key file mints tokens that the cached keys still accept.
+	if _, err := parse(mint(t, newIssuer(t, keyPath), &devauth.TokenRequest{Subject: "morty@the-citadel.com"})); err != nil {
+		t.Errorf("token from reloaded key: %v", err)
+	}
+
+	rejected := map[string]string{
+		"other key":      mint(t, newIssuer(t, filepath.Join(t.TempDir(), "other.pem")), &devauth.TokenRequest{Subject: "rick"}),
+		"other audience": mint(t, issuer, &devauth.TokenRequest{Subject: "rick", Audience: []string{"other"}}),
+	}
+
+	for name, token := range rejected {
+		if _, err := parse(token); err == nil {
+			t.Errorf("%s: token was accepted", name)
+		}
+	}
+}
+
+func TestMintValidatesRequest(t *testing.T) {
+	issuer := newIssuer(t, filepath.Join(t.TempDir(), "dev.pem"))
+
+	for name, req := range map[string]*devauth.TokenRequest{
+		"no subject":   {},
+		"invalid ttl":  {Subject: "rick", TTL: "soon"},
+		"negative ttl": {Subject: "rick", TTL: "-1m"},
+	} {
+		if _, err := issuer.Mint(req); err == nil {
+			t.Errorf("%s: got a token, want an error", name)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package devauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// AuthorizePath and OAuthTokenPath are the endpoints of the mock OIDC provider used by the browser
+	// login flow.
+	AuthorizePath  = "/dev/authorize"
+	OAuthTokenPath = "/dev/oauth/token"
+
+	codeTTL = time.Minute
+)
+
+// authCode is an issued authorization code waiting to be exchanged.
+type authCode struct {
+	subject     string
+	clientID    string
+	redirectURI string
+	challenge   string
+	nonce       string
+	expires     time.Time
+}
+
+var loginForm = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Development login</title></head>
+<body>
+<h1>Development login</h1>
+<p>Not for production: any subject is accepted without a password.</p>
+<form method="GET" action="{{.Action}}">
+{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}<label>Subject <input name="login_hint" autofocus></label>
+<button type="submit">Sign in</button>
+</form>
+</body>
+</html>
+`))
+
+// Authorize is the authorization endpoint of the mock provider. It asks for a subject, or takes it from the
+// login_hint parameter, and redirects back to the client with an authorization code. Only the
+// authorization code flow with S256 PKCE is supported.
+func (i *Issuer) Authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	redirectURI, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || !redirectURI.IsAbs() {
+		http.Error(w, "redirect_uri must be an absolute URL", http.StatusBadRequest)
+		return
+	}
+
+	if q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" ||
+		q.Get("code_challenge") == "" || q.Get("client_id") == "" {
+		http.Error(w, "only the authorization code flow with S256 PKCE is supported", http.StatusBadRequest)
+		return
+	}
+
+	subject := q.Get("login_hint")
+	if subject == "" {
+		params := map[string]string{}
+		for name := range q {
+			params[name] = q.Get(name)
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := loginForm.Execute(w, map[string]interface{}{"Action": AuthorizePath, "Params": params}); err != nil {
+			log.Err(err).Msg("failed to render development login form")
+		}
+
+		return
+	}
+
+	code, err := randomString()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	i.mu.Lock()
+	i.removeExpiredCodes()
+	i.codes[code] = &authCode{
+		subject:     subject,
+		clientID:    q.Get("client_id"),
+		redirectURI: redirectURI.String(),
+		challenge:   q.Get("code_challenge"),
+		nonce:       q.Get("nonce"),
+		expires:     time.Now().Add(codeTTL),
+	}
+	i.mu.Unlock()
+
+	callback := redirectURI.Query()
+	callback.Set("code", code)
+	callback.Set("state", q.Get("state"))
+	redirectURI.RawQuery = callback.Encode()
+
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// OAuthToken is the token endpoint of the mock provider. It exchanges an authorization code for an ID token
+// addressed to the client and an access token for the API.
+func (i *Issuer) OAuthToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, "invalid_request", err.Error())
+		return
+	}
+
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		oauthError(w, "unsupported_grant_type", "only authorization_code is supported")
+		return
+	}
+
+	i.mu.Lock()
+	code, ok := i.codes[r.PostForm.Get("code")]
+	delete(i.codes, r.PostForm.Get("code"))
+	i.mu.Unlock()
+
+	clientID := r.PostForm.Get("client_id")
+	if id, _, ok := r.BasicAuth(); ok {
+		clientID, _ = url.QueryUnescape(id)
+	}
+
+	switch {
+	case !ok || time.Now().After(code.expires):
+		oauthError(w, "invalid_grant", "unknown or expired code")
+		return
+	case code.clientID != clientID || code.redirectURI != r.PostForm.Get("redirect_uri"):
+		oauthError(w, "invalid_grant", "client_id or redirect_uri doesn't match the authorization request")
+		return
+	case !verifyChallenge(code.challenge, r.PostForm.Get("code_verifier")):
+		oauthError(w, "invalid_grant", "code_verifier doesn't match the code challenge")
+		return
+	}
+
+	claims := map[string]any{}
+	if code.nonce != "" {
+		claims["nonce"] = code.nonce
+	}
+
+	if strings.Contains(code.subject, "@") {
+		claims["email"] = code.subject
+	}
+
+	idToken, err := i.Mint(&TokenRequest{Subject: code.subject, Audience: []string{clientID}, Claims: claims})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	accessToken, err := i.Mint(&TokenRequest{Subject: code.subject})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Info().Str("subject", code.subject).Str("client_id", clientID).Msg("issued development login tokens")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"id_token":     idToken,
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(i.ttl.Seconds()),
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// removeExpiredCodes drops codes that were never exchanged. The caller must hold i.mu.
+func (i *Issuer) removeExpiredCodes() {
+	now := time.Now()
+	for code, c := range i.codes {
+		if now.After(c.expires) {
+			delete(i.codes, code)
+		}
+	}
+}
+
+func verifyChallenge(challenge, verifier string) bool {
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return verifier != "" && subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+func oauthError(w http.ResponseWriter, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": code, "error_description": description})
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
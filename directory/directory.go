@@ -3,11 +3,14 @@ package directory
 import (
 	"context"
 	"fmt"
+	"io"
+	"strings"
 
 	"todo-go/store"
 
 	"github.com/aserto-dev/go-aserto/ds/v3"
 	dsc "github.com/aserto-dev/go-directory/aserto/directory/common/v3"
+	dsi "github.com/aserto-dev/go-directory/aserto/directory/importer/v3"
 	dsr "github.com/aserto-dev/go-directory/aserto/directory/reader/v3"
 	dsw "github.com/aserto-dev/go-directory/aserto/directory/writer/v3"
 	"github.com/pkg/errors"
@@ -19,9 +22,14 @@ import (
 var (
 	IdentityObjectType = "identity"
 	UserObjectType     = "user"
+	GroupObjectType    = "group"
 	ResourceObjectType = "resource"
 
-	OwnerRelation = "owner"
+	ResourceCreatorObjectType = "resource-creator"
+	ResourceCreatorsObjectID  = "resource-creators"
+
+	OwnerRelation  = "owner"
+	MemberRelation = "member"
 
 	IdentifierRelationType = "identifier"
 
@@ -30,12 +38,19 @@ var (
 
 type Todo = store.Todo
 
+// RelationObserver is called after the directory adds or removes relations on an object.
+type RelationObserver func(objectType, objectID string)
+
 type Directory struct {
 	*ds.Client
 	isLegacy bool
+
+	observers  []RelationObserver
+	identities *identityCache
 }
 
-func NewDirectory(cfg *ds.Config) (*Directory, error) {
+// NewDirectory connects to the directory. A nil or zero-sized cacheCfg disables the identity cache.
+func NewDirectory(cfg *ds.Config, cacheCfg *IdentityCacheConfig) (*Directory, error) {
 	client, err := cfg.Connect()
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create directory client")
@@ -47,22 +62,84 @@ func NewDirectory(cfg *ds.Config) (*Directory, error) {
 	}
 
 	return &Directory{
-		Client:   client,
-		isLegacy: isLegacy,
+		Client:     client,
+		isLegacy:   isLegacy,
+		identities: newIdentityCache(cacheCfg),
 	}, nil
 }
 
+// ObserveRelations registers an observer that is notified of relation changes made through this directory.
+func (d *Directory) ObserveRelations(observer RelationObserver) {
+	d.observers = append(d.observers, observer)
+}
+
+func (d *Directory) relationsChanged(objectType, objectID string) {
+	for _, observer := range d.observers {
+		observer(objectType, objectID)
+	}
+}
+
+// GetUser returns the user with the given ID, or ErrNotFound.
 func (d *Directory) GetUser(ctx context.Context, objID string) (*dsc.Object, error) {
 	resp, err := d.Reader.GetObject(ctx, &dsr.GetObjectRequest{ObjectType: "user", ObjectId: objID})
 	if err != nil {
 		log.Warn().Err(err).Msgf("failed to get user [%s]", objID)
+		if st, ok := status.FromError(err); ok && st.Code() == codes.NotFound {
+			return nil, ErrNotFound
+		}
+
 		return nil, err
 	}
 
 	return resp.Result, nil
 }
 
+// GetGroup returns the group with the given ID, or ErrNotFound.
+func (d *Directory) GetGroup(ctx context.Context, groupID string) (*dsc.Object, error) {
+	resp, err := d.Reader.GetObject(ctx, &dsr.GetObjectRequest{ObjectType: GroupObjectType, ObjectId: groupID})
+	if err != nil {
+		if st, ok := status.FromError(err); ok && st.Code() == codes.NotFound {
+			return nil, ErrNotFound
+		}
+
+		return nil, errors.Wrapf(err, "failed to get group [%s]", groupID)
+	}
+
+	return resp.Result, nil
+}
+
+// UserFromIdentity returns the user an identity belongs to, or ErrNotFound. Results, including
+// ErrNotFound, are cached if the identity cache is enabled.
 func (d *Directory) UserFromIdentity(ctx context.Context, identity string) (*dsc.Object, error) {
+	if user, found := d.identities.get(identity); found {
+		if user == nil {
+			return nil, ErrNotFound
+		}
+		return user, nil
+	}
+
+	user, err := d.lookupIdentity(ctx, identity)
+	switch {
+	case err == nil:
+		d.identities.put(identity, user)
+	case errors.Is(err, ErrNotFound):
+		d.identities.put(identity, nil)
+	}
+
+	return user, err
+}
+
+// IdentityCacheStats returns hit rate and size statistics of the identity cache.
+func (d *Directory) IdentityCacheStats() IdentityCacheStats {
+	return d.identities.snapshot()
+}
+
+// FlushIdentityCache drops all cached identities and returns the number of entries removed.
+func (d *Directory) FlushIdentityCache() int {
+	return d.identities.flush()
+}
+
+func (d *Directory) lookupIdentity(ctx context.Context, identity string) (*dsc.Object, error) {
 	user, err := d.resolveIdentity(ctx, identity)
 	if err != nil {
 		st, ok := status.FromError(err)
@@ -77,6 +154,23 @@ func (d *Directory) UserFromIdentity(ctx context.Context, identity string) (*dsc
 	return user, nil
 }
 
+// HasRelation reports whether the subject has the relation or permission to the object.
+func (d *Directory) HasRelation(ctx context.Context, objectType, objectID, relation, subjectType, subjectID string) (bool, error) {
+	resp, err := d.Reader.Check(ctx, &dsr.CheckRequest{
+		ObjectType:  objectType,
+		ObjectId:    objectID,
+		Relation:    relation,
+		SubjectType: subjectType,
+		SubjectId:   subjectID,
+	})
+	if err != nil {
+		log.Err(err).Msgf("failed to check relation [%s:%s#%s@%s:%s]", objectType, objectID, relation, subjectType, subjectID)
+		return false, err
+	}
+
+	return resp.Check, nil
+}
+
 func (d *Directory) AddTodo(ctx context.Context, todo *Todo) error {
 	if _, err := d.Writer.SetObject(ctx, &dsw.SetObjectRequest{
 		Object: &dsc.Object{
@@ -101,6 +195,8 @@ func (d *Directory) AddTodo(ctx context.Context, todo *Todo) error {
 		return err
 	}
 
+	d.relationsChanged(ResourceObjectType, todo.ID)
+
 	return nil
 }
 
@@ -114,6 +210,110 @@ func (d *Directory) DeleteTodo(ctx context.Context, id string) error {
 		return err
 	}
 
+	d.relationsChanged(ResourceObjectType, id)
+
+	return nil
+}
+
+// WriteTodos adds todos, with owner relations, and deletes the todos with the given IDs and their relations.
+// The changes are sent to the directory's importer in a single stream. They aren't atomic: if some fail, the
+// others are still made, and the error reports the failures.
+func (d *Directory) WriteTodos(ctx context.Context, added []*Todo, deleted []string) error {
+	if len(added) == 0 && len(deleted) == 0 {
+		return nil
+	}
+
+	defer func() {
+		for _, todo := range added {
+			d.relationsChanged(ResourceObjectType, todo.ID)
+		}
+
+		for _, id := range deleted {
+			d.relationsChanged(ResourceObjectType, id)
+		}
+	}()
+
+	stream, err := d.Importer.Import(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to start directory import")
+	}
+
+	var requests []*dsi.ImportRequest
+	for _, todo := range added {
+		requests = append(requests,
+			&dsi.ImportRequest{OpCode: dsi.Opcode_OPCODE_SET, Msg: &dsi.ImportRequest_Object{Object: &dsc.Object{
+				Id:          todo.ID,
+				Type:        ResourceObjectType,
+				DisplayName: todo.Title,
+			}}},
+			&dsi.ImportRequest{OpCode: dsi.Opcode_OPCODE_SET, Msg: &dsi.ImportRequest_Relation{Relation: &dsc.Relation{
+				SubjectType: UserObjectType,
+				SubjectId:   todo.OwnerID,
+				Relation:    OwnerRelation,
+				ObjectType:  ResourceObjectType,
+				ObjectId:    todo.ID,
+			}}},
+		)
+	}
+
+	for _, id := range deleted {
+		requests = append(requests, &dsi.ImportRequest{
+			OpCode: dsi.Opcode_OPCODE_DELETE_WITH_RELATIONS,
+			Msg:    &dsi.ImportRequest_Object{Object: &dsc.Object{Id: id, Type: ResourceObjectType}},
+		})
+	}
+
+	for _, req := range requests {
+		if err := stream.Send(req); err != nil {
+			return errors.Wrap(err, "failed to send directory import")
+		}
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		return errors.Wrap(err, "failed to send directory import")
+	}
+
+	var failures []string
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return errors.Wrap(err, "failed to import todos into the directory")
+		}
+
+		if st := resp.GetStatus(); st != nil && codes.Code(st.GetCode()) != codes.OK {
+			failures = append(failures, st.GetMsg())
+		}
+	}
+
+	if len(failures) > 0 {
+		log.Error().Strs("failures", failures).Msg("failed to import todos into the directory")
+		return errors.Errorf("%d of %d directory changes failed: %s", len(failures), len(requests), strings.Join(failures, "; "))
+	}
+
+	return nil
+}
+
+// ShareTodo makes the user an owner of the todo.
+func (d *Directory) ShareTodo(ctx context.Context, id, userID string) error {
+	if _, err := d.Writer.SetRelation(ctx, &dsw.SetRelationRequest{
+		Relation: &dsc.Relation{
+			SubjectType: UserObjectType,
+			SubjectId:   userID,
+			Relation:    OwnerRelation,
+			ObjectType:  ResourceObjectType,
+			ObjectId:    id,
+		},
+	}); err != nil {
+		log.Err(err).Msgf("failed to share todo [%s] with [%s]", id, userID)
+		return err
+	}
+
+	d.relationsChanged(ResourceObjectType, id)
+
 	return nil
 }
 
@@ -133,7 +333,7 @@ func (d *Directory) resolveIdentity(ctx context.Context, identity string) (*dsc.
 		return nil, err
 	}
 
-	user, ok := relResp.Objects[fmt.Sprintf("%s:%s", relResp.Result.ObjectType, relResp.Result.ObjectId)]
+	user, ok := relResp.Objects[objectKey(relResp.Result.ObjectType, relResp.Result.ObjectId)]
 	if !ok {
 		return nil, errors.Wrapf(ErrNotFound, "user not found for identity [%s]", identity)
 	}
@@ -153,7 +353,7 @@ func (d *Directory) resolveIdentityLegacy(ctx context.Context, identity string)
 		return nil, err
 	}
 
-	user, ok := relResp.Objects[fmt.Sprintf("%s:%s", relResp.Result.SubjectType, relResp.Result.SubjectId)]
+	user, ok := relResp.Objects[objectKey(relResp.Result.SubjectType, relResp.Result.SubjectId)]
 	if !ok {
 		return nil, errors.Wrapf(ErrNotFound, "user not found for identity [%s]", identity)
 	}
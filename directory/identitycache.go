@@ -0,0 +1,181 @@
+package directory
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	dsc "github.com/aserto-dev/go-directory/aserto/directory/common/v3"
+)
+
+// IdentityCacheConfig configures the cache of identity-to-user resolutions.
+type IdentityCacheConfig struct {
+	// Size is the maximum number of identities cached. Zero disables the cache.
+	Size int
+	// TTL is how long a resolved user is cached.
+	TTL time.Duration
+	// NegativeTTL is how long an identity that doesn't resolve to a user is cached.
+	NegativeTTL time.Duration
+}
+
+// IdentityCacheStats reports the effectiveness of the identity cache.
+type IdentityCacheStats struct {
+	Size         int     `json:"size"`
+	Capacity     int     `json:"capacity"`
+	Hits         uint64  `json:"hits"`
+	NegativeHits uint64  `json:"negativeHits"`
+	Misses       uint64  `json:"misses"`
+	Evictions    uint64  `json:"evictions"`
+	HitRate      float64 `json:"hitRate"`
+}
+
+type identityEntry struct {
+	identity string
+	user     *dsc.Object // nil for negative entries
+	expires  time.Time
+}
+
+// identityCache is a bounded LRU cache with per-entry expiration. A nil *identityCache is a valid,
+// disabled cache.
+type identityCache struct {
+	cfg IdentityCacheConfig
+
+	mu      sync.Mutex
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+	stats   IdentityCacheStats
+}
+
+func newIdentityCache(cfg *IdentityCacheConfig) *identityCache {
+	if cfg == nil || cfg.Size <= 0 {
+		return nil
+	}
+
+	return &identityCache{
+		cfg:     *cfg,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+// get returns the cached user for an identity. found is false on a cache miss. On a negative hit,
+// found is true and user is nil.
+func (c *identityCache) get(identity string) (user *dsc.Object, found bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[identity]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+
+	entry := elem.Value.(*identityEntry)
+	if time.Now().After(entry.expires) {
+		c.removeElement(elem)
+		c.stats.Misses++
+
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+
+	if entry.user == nil {
+		c.stats.NegativeHits++
+	} else {
+		c.stats.Hits++
+	}
+
+	return entry.user, true
+}
+
+// put caches the user an identity resolves to. A nil user records that the identity wasn't found.
+func (c *identityCache) put(identity string, user *dsc.Object) {
+	if c == nil {
+		return
+	}
+
+	ttl := c.cfg.TTL
+	if user == nil {
+		ttl = c.cfg.NegativeTTL
+	}
+
+	if ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &identityEntry{identity: identity, user: user, expires: time.Now().Add(ttl)}
+
+	if elem, ok := c.entries[identity]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+
+		return
+	}
+
+	c.entries[identity] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.cfg.Size {
+		c.removeElement(c.order.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *identityCache) remove(identity string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[identity]; ok {
+		c.removeElement(elem)
+	}
+}
+
+func (c *identityCache) flush() int {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := c.order.Len()
+	c.order.Init()
+	c.entries = map[string]*list.Element{}
+
+	return n
+}
+
+func (c *identityCache) snapshot() IdentityCacheStats {
+	if c == nil {
+		return IdentityCacheStats{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Size = c.order.Len()
+	stats.Capacity = c.cfg.Size
+
+	if lookups := stats.Hits + stats.NegativeHits + stats.Misses; lookups > 0 {
+		stats.HitRate = float64(stats.Hits+stats.NegativeHits) / float64(lookups)
+	}
+
+	return stats
+}
+
+func (c *identityCache) removeElement(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*identityEntry).identity)
+}
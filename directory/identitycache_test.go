@@ -0,0 +1,113 @@
+package directory_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"todo-go/directory"
+
+	dsc "github.com/aserto-dev/go-directory/aserto/directory/common/v3"
+	dsw "github.com/aserto-dev/go-directory/aserto/directory/writer/v3"
+	"github.com/pkg/errors"
+)
+
+// addUser adds a user and its identity to the memory store, behind the directory's back, so that the identity
+// cache isn't invalidated.
+func addUser(t *testing.T, mem *directory.Memory, id, identity string) {
+	t.Helper()
+
+	ctx := context.Background()
+	for _, obj := range []*dsc.Object{{Type: directory.UserObjectType, Id: id}, {Type: directory.IdentityObjectType, Id: identity}} {
+		if _, err := mem.SetObject(ctx, &dsw.SetObjectRequest{Object: obj}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := mem.SetRelation(ctx, &dsw.SetRelationRequest{Relation: &dsc.Relation{
+		SubjectType: directory.IdentityObjectType,
+		SubjectId:   identity,
+		Relation:    directory.IdentifierRelationType,
+		ObjectType:  directory.UserObjectType,
+		ObjectId:    id,
+	}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIdentityCacheNegativeTTL(t *testing.T) {
+	dir, mem := directory.NewMemoryDirectory(&directory.IdentityCacheConfig{
+		Size:        10,
+		TTL:         time.Hour,
+		NegativeTTL: 50 * time.Millisecond,
+	})
+
+	ctx := context.Background()
+	if _, err := dir.UserFromIdentity(ctx, "rick@the-citadel.com"); !errors.Is(err, directory.ErrNotFound) {
+		t.Fatalf("unknown identity: got error %v, want not found", err)
+	}
+
+	addUser(t, mem, "rick", "rick@the-citadel.com")
+
+	// The identity is remembered as unknown until the negative entry expires.
+	if _, err := dir.UserFromIdentity(ctx, "rick@the-citadel.com"); !errors.Is(err, directory.ErrNotFound) {
+		t.Errorf("cached unknown identity: got error %v, want not found", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	user, err := dir.UserFromIdentity(ctx, "rick@the-citadel.com")
+	if err != nil || user.GetId() != "rick" {
+		t.Fatalf("expired unknown identity: got user %v and error %v, want rick", user, err)
+	}
+
+	stats := dir.IdentityCacheStats()
+	if stats.NegativeHits != 1 || stats.Misses != 2 || stats.Size != 1 {
+		t.Errorf("got stats %+v, want 1 negative hit, 2 misses and 1 entry", stats)
+	}
+}
+
+func TestIdentityCacheEviction(t *testing.T) {
+	dir, mem := directory.NewMemoryDirectory(&directory.IdentityCacheConfig{Size: 2, TTL: time.Hour, NegativeTTL: time.Hour})
+
+	ctx := context.Background()
+	for _, id := range []string{"rick", "morty", "summer"} {
+		addUser(t, mem, id, id+"@the-citadel.com")
+	}
+
+	// rick is used again after morty, so morty is the least recently used entry when summer is added.
+	for _, id := range []string{"rick", "morty", "rick", "summer", "rick", "morty"} {
+		if user, err := dir.UserFromIdentity(ctx, id+"@the-citadel.com"); err != nil || user.GetId() != id {
+			t.Fatalf("%s: got user %v and error %v", id, user, err)
+		}
+	}
+
+	stats := dir.IdentityCacheStats()
+	want := directory.IdentityCacheStats{Size: 2, Capacity: 2, Hits: 2, Misses: 4, Evictions: 2, HitRate: 2.0 / 6}
+	if stats != want {
+		t.Errorf("got stats %+v, want %+v", stats, want)
+	}
+
+	if n := dir.FlushIdentityCache(); n != 2 {
+		t.Errorf("flush: got %d entries removed, want 2", n)
+	}
+
+	if stats := dir.IdentityCacheStats(); stats.Size != 0 || stats.Hits != 2 {
+		t.Errorf("after flush: got stats %+v, want no entries and the counters kept", stats)
+	}
+}
+
+func TestIdentityCacheDisabled(t *testing.T) {
+	dir, mem := directory.NewMemoryDirectory(&directory.IdentityCacheConfig{})
+	addUser(t, mem, "rick", "rick@the-citadel.com")
+
+	for i := 0; i < 2; i++ {
+		if _, err := dir.UserFromIdentity(context.Background(), "rick@the-citadel.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if stats := dir.IdentityCacheStats(); stats != (directory.IdentityCacheStats{}) {
+		t.Errorf("got stats %+v, want none", stats)
+	}
+}
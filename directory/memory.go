@@ -0,0 +1,556 @@
+package directory
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/aserto-dev/go-aserto/ds/v3"
+	dsc "github.com/aserto-dev/go-directory/aserto/directory/common/v3"
+	dsi "github.com/aserto-dev/go-directory/aserto/directory/importer/v3"
+	dsr "github.com/aserto-dev/go-directory/aserto/directory/reader/v3"
+	dsw "github.com/aserto-dev/go-directory/aserto/directory/writer/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Memory is an in-memory implementation of the directory reader, writer and importer services.
+// It stores objects and relations without a manifest: Check succeeds if the relation exists, either directly
+// or through a subject relation (e.g. group#member). Missing objects and relations are reported with
+// codes.NotFound, like the real directory.
+type Memory struct {
+	mu        sync.RWMutex
+	objects   map[string]*dsc.Object
+	relations []*dsc.Relation
+}
+
+var (
+	_ dsr.ReaderClient   = (*Memory)(nil)
+	_ dsw.WriterClient   = (*Memory)(nil)
+	_ dsi.ImporterClient = (*Memory)(nil)
+)
+
+func NewMemory() *Memory {
+	return &Memory{objects: map[string]*dsc.Object{}}
+}
+
+// NewMemoryDirectory returns a Directory backed by a new in-memory store. It requires no network access.
+func NewMemoryDirectory(cacheCfg *IdentityCacheConfig) (*Directory, *Memory) {
+	mem := NewMemory()
+
+	return &Directory{
+		Client:     &ds.Client{Reader: mem, Writer: mem, Importer: mem},
+		identities: newIdentityCache(cacheCfg),
+	}, mem
+}
+
+func (m *Memory) GetObject(_ context.Context, in *dsr.GetObjectRequest, _ ...grpc.CallOption) (*dsr.GetObjectResponse, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	obj, ok := m.objects[objectKey(in.ObjectType, in.ObjectId)]
+	if !ok {
+		return nil, notFound("object", objectKey(in.ObjectType, in.ObjectId))
+	}
+
+	resp := &dsr.GetObjectResponse{Result: clone(obj)}
+
+	if in.WithRelations {
+		for _, rel := range m.relations {
+			if (rel.ObjectType == in.ObjectType && rel.ObjectId == in.ObjectId) ||
+				(rel.SubjectType == in.ObjectType && rel.SubjectId == in.ObjectId) {
+				resp.Relations = append(resp.Relations, clone(rel))
+			}
+		}
+	}
+
+	return resp, nil
+}
+
+func (m *Memory) GetObjectMany(
+	_ context.Context, in *dsr.GetObjectManyRequest, _ ...grpc.CallOption,
+) (*dsr.GetObjectManyResponse, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	resp := &dsr.GetObjectManyResponse{}
+
+	for _, id := range in.Param {
+		obj, ok := m.objects[objectKey(id.ObjectType, id.ObjectId)]
+		if !ok {
+			return nil, notFound("object", objectKey(id.ObjectType, id.ObjectId))
+		}
+
+		resp.Results = append(resp.Results, clone(obj))
+	}
+
+	return resp, nil
+}
+
+func (m *Memory) GetObjects(_ context.Context, in *dsr.GetObjectsRequest, _ ...grpc.CallOption) (*dsr.GetObjectsResponse, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var matches []*dsc.Object
+
+	for _, obj := range m.objects {
+		if in.ObjectType == "" || obj.Type == in.ObjectType {
+			matches = append(matches, obj)
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return objectKey(matches[i].Type, matches[i].Id) < objectKey(matches[j].Type, matches[j].Id)
+	})
+
+	page, next, err := paginate(matches, in.Page)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &dsr.GetObjectsResponse{Page: &dsc.PaginationResponse{NextToken: next}}
+	for _, obj := range page {
+		resp.Results = append(resp.Results, clone(obj))
+	}
+
+	return resp, nil
+}
+
+func (m *Memory) GetRelation(_ context.Context, in *dsr.GetRelationRequest, _ ...grpc.CallOption) (*dsr.GetRelationResponse, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	filter := &dsc.Relation{
+		ObjectType:      in.ObjectType,
+		ObjectId:        in.ObjectId,
+		Relation:        in.Relation,
+		SubjectType:     in.SubjectType,
+		SubjectId:       in.SubjectId,
+		SubjectRelation: in.SubjectRelation,
+	}
+
+	for _, rel := range m.sortedRelations() {
+		if !matchRelation(filter, rel) {
+			continue
+		}
+
+		resp := &dsr.GetRelationResponse{Result: clone(rel)}
+		if in.WithObjects {
+			resp.Objects = m.relationObjects(rel)
+		}
+
+		return resp, nil
+	}
+
+	return nil, notFound("relation", relationKey(filter))
+}
+
+func (m *Memory) GetRelations(
+	_ context.Context, in *dsr.GetRelationsRequest, _ ...grpc.CallOption,
+) (*dsr.GetRelationsResponse, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	filter := &dsc.Relation{
+		ObjectType:      in.ObjectType,
+		ObjectId:        in.ObjectId,
+		Relation:        in.Relation,
+		SubjectType:     in.SubjectType,
+		SubjectId:       in.SubjectId,
+		SubjectRelation: in.SubjectRelation,
+	}
+
+	var matches []*dsc.Relation
+
+	for _, rel := range m.sortedRelations() {
+		if !matchRelation(filter, rel) {
+			continue
+		}
+
+		if in.WithEmptySubjectRelation && rel.SubjectRelation != "" {
+			continue
+		}
+
+		matches = append(matches, rel)
+	}
+
+	page, next, err := paginate(matches, in.Page)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &dsr.GetRelationsResponse{Page: &dsc.PaginationResponse{NextToken: next}}
+	if in.WithObjects {
+		resp.Objects = map[string]*dsc.Object{}
+	}
+
+	for _, rel := range page {
+		resp.Results = append(resp.Results, clone(rel))
+
+		if in.WithObjects {
+			for k, v := range m.relationObjects(rel) {
+				resp.Objects[k] = v
+			}
+		}
+	}
+
+	return resp, nil
+}
+
+func (m *Memory) Check(_ context.Context, in *dsr.CheckRequest, _ ...grpc.CallOption) (*dsr.CheckResponse, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return &dsr.CheckResponse{Check: m.check(in, map[string]bool{})}, nil
+}
+
+func (m *Memory) Checks(ctx context.Context, in *dsr.ChecksRequest, _ ...grpc.CallOption) (*dsr.ChecksResponse, error) {
+	resp := &dsr.ChecksResponse{}
+
+	for _, c := range in.Checks {
+		req := clone(c)
+		if d := in.Default; d != nil {
+			req.ObjectType = valueOr(req.ObjectType, d.ObjectType)
+			req.ObjectId = valueOr(req.ObjectId, d.ObjectId)
+			req.Relation = valueOr(req.Relation, d.Relation)
+			req.SubjectType = valueOr(req.SubjectType, d.SubjectType)
+			req.SubjectId = valueOr(req.SubjectId, d.SubjectId)
+		}
+
+		checkResp, err := m.Check(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		resp.Checks = append(resp.Checks, checkResp)
+	}
+
+	return resp, nil
+}
+
+func (m *Memory) CheckPermission(
+	context.Context, *dsr.CheckPermissionRequest, ...grpc.CallOption,
+) (*dsr.CheckPermissionResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "CheckPermission is deprecated, use Check")
+}
+
+func (m *Memory) CheckRelation(context.Context, *dsr.CheckRelationRequest, ...grpc.CallOption) (*dsr.CheckRelationResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "CheckRelation is deprecated, use Check")
+}
+
+func (m *Memory) GetGraph(context.Context, *dsr.GetGraphRequest, ...grpc.CallOption) (*dsr.GetGraphResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "GetGraph is not supported by the in-memory directory")
+}
+
+func (m *Memory) SetObject(_ context.Context, in *dsw.SetObjectRequest, _ ...grpc.CallOption) (*dsw.SetObjectResponse, error) {
+	obj := in.GetObject()
+	if obj.GetType() == "" || obj.GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "object type and id are required")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := clone(obj)
+	stored.UpdatedAt = timestamppb.Now()
+	stored.CreatedAt = stored.UpdatedAt
+
+	if existing, ok := m.objects[objectKey(obj.Type, obj.Id)]; ok {
+		stored.CreatedAt = existing.CreatedAt
+	}
+
+	stored.Etag = strconv.FormatInt(stored.UpdatedAt.AsTime().UnixNano(), 10)
+	m.objects[objectKey(obj.Type, obj.Id)] = stored
+
+	return &dsw.SetObjectResponse{Result: clone(stored)}, nil
+}
+
+func (m *Memory) DeleteObject(
+	_ context.Context, in *dsw.DeleteObjectRequest, _ ...grpc.CallOption,
+) (*dsw.DeleteObjectResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.objects, objectKey(in.ObjectType, in.ObjectId))
+
+	if in.WithRelations {
+		kept := m.relations[:0]
+		for _, rel := range m.relations {
+			if (rel.ObjectType == in.ObjectType && rel.ObjectId == in.ObjectId) ||
+				(rel.SubjectType == in.ObjectType && rel.SubjectId == in.ObjectId) {
+				continue
+			}
+			kept = append(kept, rel)
+		}
+		m.relations = kept
+	}
+
+	return &dsw.DeleteObjectResponse{Result: &emptypb.Empty{}}, nil
+}
+
+func (m *Memory) SetRelation(
+	_ context.Context, in *dsw.SetRelationRequest, _ ...grpc.CallOption,
+) (*dsw.SetRelationResponse, error) {
+	rel := in.GetRelation()
+	if rel.GetObjectType() == "" || rel.GetObjectId() == "" || rel.GetRelation() == "" ||
+		rel.GetSubjectType() == "" || rel.GetSubjectId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "relation object, relation and subject are required")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := clone(rel)
+	stored.UpdatedAt = timestamppb.Now()
+	stored.CreatedAt = stored.UpdatedAt
+	stored.Etag = strconv.FormatInt(stored.UpdatedAt.AsTime().UnixNano(), 10)
+
+	for i, existing := range m.relations {
+		if relationKey(existing) == relationKey(rel) {
+			stored.CreatedAt = existing.CreatedAt
+			m.relations[i] = stored
+
+			return &dsw.SetRelationResponse{Result: clone(stored)}, nil
+		}
+	}
+
+	m.relations = append(m.relations, stored)
+
+	return &dsw.SetRelationResponse{Result: clone(stored)}, nil
+}
+
+func (m *Memory) DeleteRelation(
+	_ context.Context, in *dsw.DeleteRelationRequest, _ ...grpc.CallOption,
+) (*dsw.DeleteRelationResponse, error) {
+	key := relationKey(&dsc.Relation{
+		ObjectType:      in.ObjectType,
+		ObjectId:        in.ObjectId,
+		Relation:        in.Relation,
+		SubjectType:     in.SubjectType,
+		SubjectId:       in.SubjectId,
+		SubjectRelation: in.SubjectRelation,
+	})
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, rel := range m.relations {
+		if relationKey(rel) == key {
+			m.relations = append(m.relations[:i], m.relations[i+1:]...)
+			break
+		}
+	}
+
+	return &dsw.DeleteRelationResponse{Result: &emptypb.Empty{}}, nil
+}
+
+// Import applies the requests sent on the stream when it is closed for sending. Like the real directory, it
+// reports each request that fails with a status message and carries on with the others.
+func (m *Memory) Import(
+	ctx context.Context, _ ...grpc.CallOption,
+) (grpc.BidiStreamingClient[dsi.ImportRequest, dsi.ImportResponse], error) {
+	return &memoryImport{ctx: ctx, mem: m}, nil
+}
+
+// memoryImport is an import stream into a Memory directory.
+type memoryImport struct {
+	grpc.ClientStream
+
+	ctx       context.Context
+	mem       *Memory
+	requests  []*dsi.ImportRequest
+	responses []*dsi.ImportResponse
+}
+
+func (s *memoryImport) Context() context.Context {
+	return s.ctx
+}
+
+func (s *memoryImport) Send(req *dsi.ImportRequest) error {
+	s.requests = append(s.requests, req)
+	return nil
+}
+
+func (s *memoryImport) CloseSend() error {
+	for _, req := range s.requests {
+		if err := s.apply(req); err != nil {
+			st, _ := status.FromError(err)
+			s.responses = append(s.responses, &dsi.ImportResponse{Msg: &dsi.ImportResponse_Status{
+				Status: &dsi.ImportStatus{Code: uint32(st.Code()), Msg: st.Message(), Req: req},
+			}})
+		}
+	}
+
+	s.requests = nil
+
+	return nil
+}
+
+func (s *memoryImport) Recv() (*dsi.ImportResponse, error) {
+	if len(s.responses) == 0 {
+		return nil, io.EOF
+	}
+
+	resp := s.responses[0]
+	s.responses = s.responses[1:]
+
+	return resp, nil
+}
+
+func (s *memoryImport) apply(req *dsi.ImportRequest) error {
+	switch {
+	case req.GetObject() != nil && req.GetOpCode() == dsi.Opcode_OPCODE_SET:
+		_, err := s.mem.SetObject(s.ctx, &dsw.SetObjectRequest{Object: req.GetObject()})
+		return err
+	case req.GetObject() != nil:
+		_, err := s.mem.DeleteObject(s.ctx, &dsw.DeleteObjectRequest{
+			ObjectType:    req.GetObject().GetType(),
+			ObjectId:      req.GetObject().GetId(),
+			WithRelations: req.GetOpCode() == dsi.Opcode_OPCODE_DELETE_WITH_RELATIONS,
+		})
+		return err
+	case req.GetRelation() != nil && req.GetOpCode() == dsi.Opcode_OPCODE_SET:
+		_, err := s.mem.SetRelation(s.ctx, &dsw.SetRelationRequest{Relation: req.GetRelation()})
+		return err
+	case req.GetRelation() != nil:
+		rel := req.GetRelation()
+		_, err := s.mem.DeleteRelation(s.ctx, &dsw.DeleteRelationRequest{
+			ObjectType:      rel.ObjectType,
+			ObjectId:        rel.ObjectId,
+			Relation:        rel.Relation,
+			SubjectType:     rel.SubjectType,
+			SubjectId:       rel.SubjectId,
+			SubjectRelation: rel.SubjectRelation,
+		})
+		return err
+	default:
+		return status.Error(codes.InvalidArgument, "import request has no object or relation")
+	}
+}
+
+// check reports whether the subject has the relation to the object, either directly or through a
+// subject relation. visited guards against cycles.
+func (m *Memory) check(in *dsr.CheckRequest, visited map[string]bool) bool {
+	key := objectKey(in.ObjectType, in.ObjectId) + "#" + in.Relation
+	if visited[key] {
+		return false
+	}
+	visited[key] = true
+
+	for _, rel := range m.relations {
+		if rel.ObjectType != in.ObjectType || rel.ObjectId != in.ObjectId || rel.Relation != in.Relation {
+			continue
+		}
+
+		if rel.SubjectRelation == "" {
+			if rel.SubjectType == in.SubjectType && rel.SubjectId == in.SubjectId {
+				return true
+			}
+
+			continue
+		}
+
+		if m.check(&dsr.CheckRequest{
+			ObjectType:  rel.SubjectType,
+			ObjectId:    rel.SubjectId,
+			Relation:    rel.SubjectRelation,
+			SubjectType: in.SubjectType,
+			SubjectId:   in.SubjectId,
+		}, visited) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *Memory) sortedRelations() []*dsc.Relation {
+	rels := append([]*dsc.Relation{}, m.relations...)
+	sort.Slice(rels, func(i, j int) bool { return relationKey(rels[i]) < relationKey(rels[j]) })
+
+	return rels
+}
+
+func (m *Memory) relationObjects(rel *dsc.Relation) map[string]*dsc.Object {
+	objects := map[string]*dsc.Object{}
+
+	for _, key := range []string{objectKey(rel.ObjectType, rel.ObjectId), objectKey(rel.SubjectType, rel.SubjectId)} {
+		if obj, ok := m.objects[key]; ok {
+			objects[key] = clone(obj)
+		}
+	}
+
+	return objects
+}
+
+// matchRelation reports whether rel matches all non-empty fields of filter.
+func matchRelation(filter, rel *dsc.Relation) bool {
+	return (filter.ObjectType == "" || filter.ObjectType == rel.ObjectType) &&
+		(filter.ObjectId == "" || filter.ObjectId == rel.ObjectId) &&
+		(filter.Relation == "" || filter.Relation == rel.Relation) &&
+		(filter.SubjectType == "" || filter.SubjectType == rel.SubjectType) &&
+		(filter.SubjectId == "" || filter.SubjectId == rel.SubjectId) &&
+		(filter.SubjectRelation == "" || filter.SubjectRelation == rel.SubjectRelation)
+}
+
+// paginate returns the requested page of items. Page tokens are offsets into the result set.
+func paginate[T any](items []T, page *dsc.PaginationRequest) ([]T, string, error) {
+	size := int(page.GetSize())
+	if size <= 0 || size > pageSize {
+		size = pageSize
+	}
+
+	start := 0
+	if token := page.GetToken(); token != "" {
+		offset, err := strconv.Atoi(token)
+		if err != nil || offset < 0 || offset > len(items) {
+			return nil, "", status.Errorf(codes.InvalidArgument, "invalid page token [%s]", token)
+		}
+		start = offset
+	}
+
+	end := min(start+size, len(items))
+
+	next := ""
+	if end < len(items) {
+		next = strconv.Itoa(end)
+	}
+
+	return items[start:end], next, nil
+}
+
+func objectKey(objType, objID string) string {
+	return fmt.Sprintf("%s:%s", objType, objID)
+}
+
+func relationKey(rel *dsc.Relation) string {
+	key := fmt.Sprintf("%s#%s@%s", objectKey(rel.ObjectType, rel.ObjectId), rel.Relation, objectKey(rel.SubjectType, rel.SubjectId))
+	if rel.SubjectRelation != "" {
+		key += "#" + rel.SubjectRelation
+	}
+
+	return key
+}
+
+func notFound(kind, key string) error {
+	return status.Errorf(codes.NotFound, "%s not found: %s", kind, key)
+}
+
+func valueOr(value, fallback string) string {
+	if value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+func clone[T proto.Message](msg T) T {
+	return proto.Clone(msg).(T)
+}
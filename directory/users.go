@@ -0,0 +1,169 @@
+package directory
+
+import (
+	"context"
+
+	dsc "github.com/aserto-dev/go-directory/aserto/directory/common/v3"
+	dsr "github.com/aserto-dev/go-directory/aserto/directory/reader/v3"
+	dsw "github.com/aserto-dev/go-directory/aserto/directory/writer/v3"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// pageSize is the number of results requested per page when listing directory objects.
+const pageSize = 100
+
+// User describes a user to add to the directory.
+type User struct {
+	ID          string         `json:"id"`
+	DisplayName string         `json:"displayName"`
+	Identity    string         `json:"identity"`
+	Properties  map[string]any `json:"properties,omitempty"`
+	// Creator determines whether the user is a member of the resource-creators group.
+	Creator bool `json:"creator"`
+}
+
+// AddUser creates or updates a user, its identity and the relation between them.
+// If the user is a creator, it is also made a member of the resource-creators group.
+func (d *Directory) AddUser(ctx context.Context, user *User) error {
+	props, err := structpb.NewStruct(user.Properties)
+	if err != nil {
+		return err
+	}
+
+	if _, err := d.Writer.SetObject(ctx, &dsw.SetObjectRequest{
+		Object: &dsc.Object{
+			Id:          user.ID,
+			Type:        UserObjectType,
+			DisplayName: user.DisplayName,
+			Properties:  props,
+		},
+	}); err != nil {
+		log.Err(err).Msgf("failed to create user [%s]", user.ID)
+		return err
+	}
+
+	if _, err := d.Writer.SetObject(ctx, &dsw.SetObjectRequest{
+		Object: &dsc.Object{Id: user.Identity, Type: IdentityObjectType},
+	}); err != nil {
+		log.Err(err).Msgf("failed to create identity [%s]", user.Identity)
+		return err
+	}
+
+	if _, err := d.Writer.SetRelation(ctx, &dsw.SetRelationRequest{Relation: d.identifierRelation(user)}); err != nil {
+		log.Err(err).Msgf("failed to set identifier relation [%s]", user.Identity)
+		return err
+	}
+
+	d.identities.remove(user.Identity)
+	d.relationsChanged(UserObjectType, user.ID)
+
+	if !user.Creator {
+		return nil
+	}
+
+	if _, err := d.Writer.SetObject(ctx, &dsw.SetObjectRequest{
+		Object: &dsc.Object{Id: ResourceCreatorsObjectID, Type: ResourceCreatorObjectType},
+	}); err != nil {
+		log.Err(err).Msg("failed to create resource-creators group")
+		return err
+	}
+
+	if _, err := d.Writer.SetRelation(ctx, &dsw.SetRelationRequest{
+		Relation: &dsc.Relation{
+			SubjectType: UserObjectType,
+			SubjectId:   user.ID,
+			Relation:    MemberRelation,
+			ObjectType:  ResourceCreatorObjectType,
+			ObjectId:    ResourceCreatorsObjectID,
+		},
+	}); err != nil {
+		log.Err(err).Msgf("failed to set member relation [%s]", user.ID)
+		return err
+	}
+
+	d.relationsChanged(ResourceCreatorObjectType, ResourceCreatorsObjectID)
+
+	return nil
+}
+
+// ListTodoIDs returns the IDs of all todo resources in the directory.
+func (d *Directory) ListTodoIDs(ctx context.Context) ([]string, error) {
+	var (
+		ids   []string
+		token string
+	)
+
+	for {
+		resp, err := d.Reader.GetObjects(ctx, &dsr.GetObjectsRequest{
+			ObjectType: ResourceObjectType,
+			Page:       &dsc.PaginationRequest{Size: pageSize, Token: token},
+		})
+		if err != nil {
+			log.Err(err).Msg("failed to list todo resources")
+			return nil, err
+		}
+
+		for _, obj := range resp.Results {
+			ids = append(ids, obj.Id)
+		}
+
+		token = resp.GetPage().GetNextToken()
+		if token == "" {
+			return ids, nil
+		}
+	}
+}
+
+// OwnedTodoIDs returns the IDs of the todos that the user owns, including todos shared with them.
+func (d *Directory) OwnedTodoIDs(ctx context.Context, userID string) (map[string]bool, error) {
+	var (
+		ids   = map[string]bool{}
+		token string
+	)
+
+	for {
+		resp, err := d.Reader.GetRelations(ctx, &dsr.GetRelationsRequest{
+			ObjectType:  ResourceObjectType,
+			Relation:    OwnerRelation,
+			SubjectType: UserObjectType,
+			SubjectId:   userID,
+			Page:        &dsc.PaginationRequest{Size: pageSize, Token: token},
+		})
+		if err != nil {
+			log.Err(err).Msgf("failed to list todos owned by [%s]", userID)
+			return nil, err
+		}
+
+		for _, rel := range resp.Results {
+			ids[rel.ObjectId] = true
+		}
+
+		token = resp.GetPage().GetNextToken()
+		if token == "" {
+			return ids, nil
+		}
+	}
+}
+
+// identifierRelation returns the relation between a user and its identity, honoring the direction
+// used by legacy directories.
+func (d *Directory) identifierRelation(user *User) *dsc.Relation {
+	if d.isLegacy {
+		return &dsc.Relation{
+			SubjectType: UserObjectType,
+			SubjectId:   user.ID,
+			Relation:    IdentifierRelationType,
+			ObjectType:  IdentityObjectType,
+			ObjectId:    user.Identity,
+		}
+	}
+
+	return &dsc.Relation{
+		SubjectType: IdentityObjectType,
+		SubjectId:   user.Identity,
+		Relation:    IdentifierRelationType,
+		ObjectType:  UserObjectType,
+		ObjectId:    user.ID,
+	}
+}
@@ -0,0 +1,201 @@
+// Package events distributes todo changes to subscribers, such as Server-Sent Events streams, in process.
+package events
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Event types.
+const (
+	TodoCreated = "todo.created"
+	TodoUpdated = "todo.updated"
+	// TodoCompleted follows the todo.updated event of a todo that was marked completed.
+	TodoCompleted = "todo.completed"
+	TodoDeleted   = "todo.deleted"
+)
+
+// Types lists all event types.
+var Types = []string{TodoCreated, TodoUpdated, TodoCompleted, TodoDeleted}
+
+// Config configures the hub.
+type Config struct {
+	// History is the number of recent events kept for subscribers that reconnect.
+	History int
+	// SubscriberBuffer is the number of events that may be queued for a subscriber. Subscribers that fall
+	// further behind are disconnected.
+	SubscriberBuffer int
+	// Heartbeat is how often idle streams send a comment to keep connections open.
+	Heartbeat time.Duration
+}
+
+// Validate returns a problem for each invalid setting.
+func (c *Config) Validate() []string {
+	if c.History < 0 || c.SubscriberBuffer <= 0 || c.Heartbeat <= 0 {
+		return []string{"event history must not be negative, and the subscriber buffer and heartbeat must be positive"}
+	}
+
+	return nil
+}
+
+// Event is a change to a todo. IDs increase by one with each event published by a hub. They start from the
+// time the hub was created, in microseconds, so that IDs issued before a restart are recognized as such.
+type Event struct {
+	ID   uint64
+	Type string
+	Time time.Time
+	// TodoID is the todo that changed, so that subscribers can check that they may read it.
+	TodoID string
+	// Data is the JSON encoded payload.
+	Data json.RawMessage
+}
+
+// Hub publishes events to subscribers. Publishing never blocks: subscribers that don't keep up are
+// disconnected and can resume from the history with Subscribe.
+type Hub struct {
+	cfg *Config
+
+	mu      sync.Mutex
+	lastID  uint64
+	history []Event // ring buffer of the last cfg.History events, indexed by ID
+	stored  int     // number of events in history
+	subs    map[*Subscription]struct{}
+	closed  bool
+}
+
+func NewHub(cfg *Config) *Hub {
+	return &Hub{
+		cfg:     cfg,
+		lastID:  uint64(time.Now().UnixMicro()),
+		history: make([]Event, cfg.History),
+		subs:    map[*Subscription]struct{}{},
+	}
+}
+
+// Subscription receives the events published after it was created.
+type Subscription struct {
+	hub    *Hub
+	events chan Event
+	// lagged is set if the subscription was dropped because it fell behind.
+	lagged bool
+}
+
+// Events returns the channel that events are delivered on. It is closed when the subscription ends, because
+// the subscriber fell behind, the hub was closed or Close was called.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Lagged reports whether the subscription ended because the subscriber fell behind. It must only be called
+// after the events channel was closed.
+func (s *Subscription) Lagged() bool {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	return s.lagged
+}
+
+// Close ends the subscription.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	s.hub.drop(s)
+}
+
+// Publish assigns the next ID to an event with the given type, todo and payload and delivers it to all
+// subscribers.
+func (h *Hub) Publish(eventType, todoID string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode %s event", eventType)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil
+	}
+
+	h.lastID++
+	event := Event{ID: h.lastID, Type: eventType, Time: time.Now().UTC(), TodoID: todoID, Data: payload}
+
+	if len(h.history) > 0 {
+		h.history[h.slot(event.ID)] = event
+		if h.stored < len(h.history) {
+			h.stored++
+		}
+	}
+
+	for sub := range h.subs {
+		select {
+		case sub.events <- event:
+		default:
+			sub.lagged = true
+			h.drop(sub)
+		}
+	}
+
+	return nil
+}
+
+// Subscribe starts a subscription. If lastID is not zero, the events published after it are returned, to
+// be delivered before the subscription's events. ok is false if those events are no longer in the history,
+// or lastID was issued before the hub started, so the subscriber may have missed events.
+func (h *Hub) Subscribe(lastID uint64) (sub *Subscription, missed []Event, ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub = &Subscription{hub: h, events: make(chan Event, h.cfg.SubscriberBuffer)}
+	if h.closed {
+		close(sub.events)
+		return sub, nil, true
+	}
+
+	h.subs[sub] = struct{}{}
+
+	if lastID == 0 {
+		return sub, nil, true
+	}
+
+	oldest := h.lastID - uint64(h.stored) + 1
+	if lastID > h.lastID || lastID+1 < oldest {
+		return sub, nil, false
+	}
+
+	for id := lastID + 1; id <= h.lastID; id++ {
+		missed = append(missed, h.history[h.slot(id)])
+	}
+
+	return sub, missed, true
+}
+
+// Close ends all subscriptions. Later events are discarded.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for sub := range h.subs {
+		h.drop(sub)
+	}
+}
+
+// slot returns the index of the event with the given ID in the history.
+func (h *Hub) slot(id uint64) int {
+	return int(id % uint64(len(h.history)))
+}
+
+// drop ends a subscription. The caller must hold h.mu.
+func (h *Hub) drop(sub *Subscription) {
+	if _, ok := h.subs[sub]; !ok {
+		return
+	}
+
+	delete(h.subs, sub)
+	close(sub.events)
+}
@@ -0,0 +1,118 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestHub(history, buffer int) *Hub {
+	return NewHub(&Config{History: history, SubscriberBuffer: buffer, Heartbeat: time.Second})
+}
+
+func publish(t *testing.T, hub *Hub, todoIDs ...string) {
+	t.Helper()
+
+	for _, id := range todoIDs {
+		if err := hub.Publish(TodoUpdated, id, map[string]string{"id": id}); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSubscribeReplaysMissedEvents(t *testing.T) {
+	hub := newTestHub(3, 8)
+	publish(t, hub, "a", "b", "c")
+
+	first, _, _ := hub.Subscribe(0)
+	defer first.Close()
+
+	publish(t, hub, "d")
+	seen := <-first.Events()
+
+	// The client reconnects after seeing "d" and misses "e" and "f".
+	publish(t, hub, "e", "f")
+
+	sub, missed, ok := hub.Subscribe(seen.ID)
+	defer sub.Close()
+
+	switch {
+	case !ok:
+		t.Fatal("missed events should still be in the history")
+	case len(missed) != 2 || missed[0].TodoID != "e" || missed[1].TodoID != "f":
+		t.Fatalf("got missed events %+v, want e and f", missed)
+	case missed[0].ID != seen.ID+1 || missed[1].ID != seen.ID+2:
+		t.Errorf("got IDs %d and %d, want the IDs after %d", missed[0].ID, missed[1].ID, seen.ID)
+	}
+
+	// Nothing is missed when the client is up to date.
+	sub, missed, ok = hub.Subscribe(missed[1].ID)
+	defer sub.Close()
+
+	if !ok || len(missed) != 0 {
+		t.Errorf("got ok %t and %d missed events, want none", ok, len(missed))
+	}
+}
+
+func TestSubscribeResetsWhenHistoryIsGone(t *testing.T) {
+	hub := newTestHub(2, 8)
+	publish(t, hub, "a")
+
+	sub, _, _ := hub.Subscribe(0)
+	defer sub.Close()
+
+	publish(t, hub, "b")
+	seen := <-sub.Events()
+
+	// Three more events push the one after "b" out of a history of two.
+	publish(t, hub, "c", "d", "e")
+
+	for name, lastID := range map[string]uint64{
+		"evicted":      seen.ID,
+		"before start": 1,
+		"never issued": seen.ID + 100,
+	} {
+		sub, missed, ok := hub.Subscribe(lastID)
+		sub.Close()
+
+		if ok || len(missed) != 0 {
+			t.Errorf("%s: got ok %t and %d missed events, want a reset", name, ok, len(missed))
+		}
+	}
+}
+
+func TestSlowSubscribersAreDropped(t *testing.T) {
+	hub := newTestHub(10, 2)
+
+	slow, _, _ := hub.Subscribe(0)
+	fast, _, _ := hub.Subscribe(0)
+	defer fast.Close()
+
+	// Publishing doesn't wait for the slow subscriber, whose buffer holds two events.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for _, id := range []string{"a", "b", "c"} {
+			publish(t, hub, id)
+
+			if event, open := <-fast.Events(); !open || event.TodoID != id {
+				t.Errorf("got event %+v, want %s", event, id)
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("publish blocked on a slow subscriber")
+	}
+
+	var queued int
+	for range slow.Events() {
+		queued++
+	}
+
+	if queued != 2 || !slow.Lagged() {
+		t.Errorf("got %d queued events and lagged %t, want the buffered events and a lagged subscription", queued, slow.Lagged())
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"todo-go/server"
+	"todo-go/store"
+
+	"github.com/pkg/errors"
+)
+
+func runExport(_ context.Context, args []string) error {
+	flags := server.NewOptionFlags("export")
+	file := flags.String("file", "", "output file (defaults to stdout)")
+
+	if _, err := loadOptions(flags, args); err != nil {
+		return err
+	}
+
+	db, err := store.NewStore()
+	if err != nil {
+		return errors.Wrap(err, "failed to create store")
+	}
+	defer db.Close()
+
+	todos, err := db.GetTodos()
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if *file != "" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return errors.Wrapf(err, "failed to create [%s]", *file)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+
+	if todos == nil {
+		todos = []store.Todo{}
+	}
+
+	return enc.Encode(todos)
+}
+
+func runImport(ctx context.Context, args []string) error {
+	flags := server.NewOptionFlags("import")
+	file := flags.String("file", "", "JSON file produced by 'export' (defaults to stdin)")
+
+	options, err := loadOptions(flags, args)
+	if err != nil {
+		return err
+	}
+
+	var in io.Reader = os.Stdin
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return errors.Wrapf(err, "failed to open [%s]", *file)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var todos []store.Todo
+	if err := json.NewDecoder(in).Decode(&todos); err != nil {
+		return errors.Wrap(err, "failed to parse todos")
+	}
+
+	db, dir, err := openDeps(options)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	defer dir.Close()
+
+	for i := range todos {
+		todo := &todos[i]
+		if todo.ID == "" || todo.OwnerID == "" {
+			return errors.Errorf("todo %d is missing an ID or owner", i)
+		}
+
+		// Exports from before todos recorded their last change.
+		if todo.UpdatedAt.IsZero() {
+			todo.UpdatedAt = time.Now().UTC()
+		}
+
+		existing, err := db.GetTodo(todo.ID)
+		if err != nil {
+			return err
+		}
+
+		if existing == nil {
+			err = db.InsertTodo(todo)
+		} else {
+			err = db.UpdateTodo(todo)
+		}
+
+		if err != nil {
+			return errors.Wrapf(err, "failed to import todo [%s]", todo.ID)
+		}
+
+		if err := dir.AddTodo(ctx, todo); err != nil {
+			return errors.Wrapf(err, "failed to import todo [%s]", todo.ID)
+		}
+	}
+
+	fmt.Printf("imported %d todos\n", len(todos))
+
+	return nil
+}
@@ -7,6 +7,7 @@ toolchain go1.23.6
 require (
 	github.com/aserto-dev/go-aserto v0.33.6
 	github.com/aserto-dev/go-aserto/middleware/gorillaz v0.0.0-20250305203028-e0647b19dcce
+	github.com/aserto-dev/go-authorizer v0.20.13
 	github.com/aserto-dev/go-directory v0.33.5
 	github.com/blockloop/scan v1.3.0
 	github.com/google/uuid v1.6.0
@@ -17,12 +18,13 @@ require (
 	github.com/pkg/errors v0.9.1
 	github.com/rs/zerolog v1.33.0
 	google.golang.org/grpc v1.71.0
+	google.golang.org/protobuf v1.36.5
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	buf.build/gen/go/bufbuild/protovalidate/protocolbuffers/go v1.36.3-20241127180247-a33202765966.1 // indirect
 	github.com/aserto-dev/errors v0.0.15 // indirect
-	github.com/aserto-dev/go-authorizer v0.20.13 // indirect
 	github.com/aserto-dev/header v0.0.10 // indirect
 	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.4.0 // indirect
 	github.com/go-http-utils/headers v0.0.0-20181008091004-fed159eddc2a // indirect
@@ -46,5 +48,4 @@ require (
 	golang.org/x/text v0.23.0 // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20250303144028-a0af3efb3deb // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20250303144028-a0af3efb3deb // indirect
-	google.golang.org/protobuf v1.36.5 // indirect
 )
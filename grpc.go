@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	todov1 "todo-go/api/todo/v1"
+	"todo-go/identity"
+	"todo-go/server"
+
+	"github.com/aserto-dev/go-aserto/middleware/gorillaz"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// grpcMethods holds the policy of each gRPC method, which is the policy of its equivalent HTTP route, so both
+// APIs are subject to the same rules and scopes.
+var grpcMethods = map[string]routePolicy{
+	todov1.TodoService_ListTodos_FullMethodName:  {route: "GET /v1/todos", policyPath: "GET.todos"},
+	todov1.TodoService_GetTodo_FullMethodName:    {route: "GET /v1/todos", policyPath: "GET.todos"},
+	todov1.TodoService_CreateTodo_FullMethodName: {route: "POST /v1/todos", creator: true},
+	todov1.TodoService_UpdateTodo_FullMethodName: {route: "PUT /v1/todos/{id}", policyPath: "PUT.todos.__id"},
+	todov1.TodoService_DeleteTodo_FullMethodName: {route: "DELETE /v1/todos/{id}", policyPath: "DELETE.todos.__id"},
+	// Sharing changes a todo, so it is allowed to those who may update it.
+	todov1.TodoService_ShareTodo_FullMethodName: {route: "PUT /v1/todos/{id}", policyPath: "PUT.todos.__id"},
+}
+
+// NewGRPCServer returns a gRPC server for the TodoService of srv. Calls are authenticated by bearer and
+// authorized by azClient, like HTTP requests. The server also supports reflection, which is unauthenticated.
+func NewGRPCServer(
+	srv *server.Server, bearer *BearerAuthenticator, azClient gorillaz.AuthorizerClient, options *server.Options,
+) *grpc.Server {
+	interceptors := &grpcInterceptors{bearer: bearer, azClient: azClient, options: options}
+
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(interceptors.authenticate, interceptors.authorize))
+	todov1.RegisterTodoServiceServer(grpcServer, server.NewTodoService(srv))
+	reflection.Register(grpcServer)
+
+	return grpcServer
+}
+
+// ServeGRPC serves grpcServer on the configured address until it is stopped.
+func ServeGRPC(grpcServer *grpc.Server, cfg *server.GRPCConfig) {
+	lis, err := net.Listen("tcp", cfg.ListenAddress)
+	if err != nil {
+		log.Fatal().Err(err).Msg("grpc listen error")
+	}
+
+	log.Info().Str("listen_address", cfg.ListenAddress).Msg("starting grpc server")
+
+	if err := grpcServer.Serve(lis); err != nil {
+		log.Fatal().Err(err).Msg("grpc serve error")
+	}
+}
+
+type grpcInterceptors struct {
+	bearer   *BearerAuthenticator
+	azClient gorillaz.AuthorizerClient
+	options  *server.Options
+}
+
+// authenticate verifies the bearer token in the "authorization" metadata and stores the caller's principal in
+// the context.
+func (i *grpcInterceptors) authenticate(
+	ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+) (interface{}, error) {
+	var tokenStr string
+	if values := metadata.ValueFromIncomingContext(ctx, "authorization"); len(values) > 0 {
+		if token, ok := strings.CutPrefix(values[0], "Bearer "); ok {
+			tokenStr = token
+		}
+	}
+
+	if tokenStr == "" {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token in authorization metadata")
+	}
+
+	principal, httpStatus, err := i.bearer.Authenticate(ctx, tokenStr)
+	switch {
+	case err != nil && httpStatus == http.StatusUnauthorized:
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	case err != nil:
+		log.Err(err).Msg("failed to authenticate grpc call")
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return handler(identity.WithPrincipal(ctx, principal), req)
+}
+
+// authorize checks the caller's scopes and asks the authorizer whether the caller may make the call.
+// Methods without an entry in grpcMethods are denied.
+func (i *grpcInterceptors) authorize(
+	ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+) (interface{}, error) {
+	method, ok := grpcMethods[info.FullMethod]
+	if !ok {
+		return nil, status.Errorf(codes.PermissionDenied, "no authorization rule for %s", info.FullMethod)
+	}
+
+	principal := identity.FromContext(ctx)
+	if missing := principal.MissingScopes(i.options.RouteScopes[method.route]...); len(missing) > 0 {
+		return nil, status.Error(codes.PermissionDenied, "insufficient scope: requires "+strings.Join(missing, ", "))
+	}
+
+	var objectID string
+	if withID, ok := req.(interface{ GetId() string }); ok {
+		objectID = withID.GetId()
+	}
+
+	allowed, err := isAllowed(ctx, i.azClient, i.options, method, principal.Subject, objectID)
+	switch {
+	case err != nil:
+		log.Err(err).Str("method", info.FullMethod).Msg("failed to authorize grpc call")
+		return nil, status.Error(codes.Internal, "internal error")
+	case !allowed:
+		return nil, status.Error(codes.PermissionDenied, "not authorized")
+	}
+
+	return handler(ctx, req)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	todov1 "todo-go/api/todo/v1"
+	"todo-go/identity"
+	"todo-go/server"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCInterceptors(t *testing.T) {
+	interceptors := &grpcInterceptors{options: &server.Options{
+		RouteScopes: map[string][]string{"POST /v1/todos": {"todos:write"}},
+	}}
+
+	// The caller only reads todos.
+	reader := identity.WithPrincipal(context.Background(), &identity.Principal{
+		Subject: "rick@the-citadel.com", Scopes: []string{"todos:read"},
+	})
+
+	for _, tc := range []struct {
+		name        string
+		interceptor grpc.UnaryServerInterceptor
+		ctx         context.Context
+		method      string
+		want        codes.Code
+	}{
+		{
+			"missing metadata", interceptors.authenticate, context.Background(),
+			todov1.TodoService_ListTodos_FullMethodName, codes.Unauthenticated,
+		},
+		{
+			"missing bearer token",
+			interceptors.authenticate,
+			metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Basic cmljaw==")),
+			todov1.TodoService_ListTodos_FullMethodName,
+			codes.Unauthenticated,
+		},
+		{
+			"missing scope", interceptors.authorize, reader,
+			todov1.TodoService_CreateTodo_FullMethodName, codes.PermissionDenied,
+		},
+		{
+			"unknown method", interceptors.authorize, reader,
+			"/todo.v1.TodoService/PurgeTodos", codes.PermissionDenied,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := func(context.Context, interface{}) (interface{}, error) {
+				t.Error("the handler was called")
+				return nil, nil
+			}
+
+			_, err := tc.interceptor(tc.ctx, nil, &grpc.UnaryServerInfo{FullMethod: tc.method}, handler)
+			if got := status.Code(err); got != tc.want {
+				t.Errorf("got code %s, want %s: %v", got, tc.want, err)
+			}
+		})
+	}
+}
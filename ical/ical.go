@@ -0,0 +1,94 @@
+// Package ical writes iCalendar (RFC 5545) documents, such as calendar feeds. It handles the format's line
+// endings, line folding and text escaping; callers choose the components and properties.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxLineOctets is the longest a content line may be, excluding the line break, before it must be folded.
+const maxLineOctets = 75
+
+// timeFormat is the format of UTC date-times.
+const timeFormat = "20060102T150405Z"
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// Writer writes the content lines of an iCalendar document. The first error stops all writes and is returned
+// by Flush.
+type Writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Begin starts a component, such as VCALENDAR or VEVENT.
+func (w *Writer) Begin(component string) {
+	w.Property("BEGIN", component)
+}
+
+// End ends a component.
+func (w *Writer) End(component string) {
+	w.Property("END", component)
+}
+
+// Property writes a property whose value is already in iCalendar form. Parameters, if any, are part of name,
+// e.g. "REFRESH-INTERVAL;VALUE=DURATION".
+func (w *Writer) Property(name, value string) {
+	w.line(name + ":" + value)
+}
+
+// Text writes a property with a text value, escaping it.
+func (w *Writer) Text(name, value string) {
+	w.Property(name, textEscaper.Replace(value))
+}
+
+// Time writes a property with a date-time value, in UTC.
+func (w *Writer) Time(name string, t time.Time) {
+	w.Property(name, t.UTC().Format(timeFormat))
+}
+
+// Flush writes any buffered data and returns the first error that occurred.
+func (w *Writer) Flush() error {
+	if w.err == nil {
+		w.err = w.w.Flush()
+	}
+
+	return w.err
+}
+
+// line writes a content line, folding it into lines of at most maxLineOctets without splitting characters.
+func (w *Writer) line(s string) {
+	if w.err != nil {
+		return
+	}
+
+	limit := maxLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+
+		w.write(s[:cut] + "\r\n ")
+		s = s[cut:]
+
+		// Continuation lines start with a space, which counts towards their length.
+		limit = maxLineOctets - 1
+	}
+
+	w.write(s + "\r\n")
+}
+
+func (w *Writer) write(s string) {
+	if w.err == nil {
+		_, w.err = w.w.WriteString(s)
+	}
+}
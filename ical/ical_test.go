@@ -0,0 +1,105 @@
+package ical_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"todo-go/ical"
+
+	"github.com/pkg/errors"
+)
+
+// write returns the document written by fn.
+func write(t *testing.T, fn func(w *ical.Writer)) string {
+	t.Helper()
+
+	var b strings.Builder
+	w := ical.NewWriter(&b)
+	fn(w)
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.String()
+}
+
+// unfold joins folded lines, as RFC 5545 readers do.
+func unfold(s string) string {
+	return strings.ReplaceAll(s, "\r\n ", "")
+}
+
+func TestFolding(t *testing.T) {
+	for name, value := range map[string]string{
+		"short":      "Buy milk",
+		"exact":      strings.Repeat("a", 75-len("SUMMARY:")),
+		"ascii":      strings.Repeat("Get Schwifty ", 20),
+		"multi-byte": strings.Repeat("Plumbus 🛸 für Größe ", 12),
+	} {
+		t.Run(name, func(t *testing.T) {
+			doc := write(t, func(w *ical.Writer) { w.Property("SUMMARY", value) })
+
+			if !strings.HasSuffix(doc, "\r\n") {
+				t.Fatalf("got document %q, want it to end with CRLF", doc)
+			}
+
+			for _, line := range strings.Split(strings.TrimSuffix(doc, "\r\n"), "\r\n") {
+				if len(line) > 75 {
+					t.Errorf("got a line of %d octets: %q", len(line), line)
+				}
+
+				if !utf8.ValidString(line) {
+					t.Errorf("got a line with a split character: %q", line)
+				}
+			}
+
+			if got := unfold(doc); got != "SUMMARY:"+value+"\r\n" {
+				t.Errorf("unfolded: got %q", got)
+			}
+
+			if folded := strings.Contains(doc, "\r\n "); folded != (len("SUMMARY:"+value) > 75) {
+				t.Errorf("got folded %t for a line of %d octets", folded, len("SUMMARY:"+value))
+			}
+		})
+	}
+}
+
+func TestText(t *testing.T) {
+	doc := write(t, func(w *ical.Writer) {
+		w.Text("DESCRIPTION", "Pickle Rick; Morty, Summer\\Beth\nJerry\r\nSpace Beth\r")
+	})
+
+	if want := `DESCRIPTION:Pickle Rick\; Morty\, Summer\\Beth\nJerry\nSpace Beth\n` + "\r\n"; doc != want {
+		t.Errorf("got %q, want %q", doc, want)
+	}
+}
+
+func TestComponents(t *testing.T) {
+	doc := write(t, func(w *ical.Writer) {
+		w.Begin("VEVENT")
+		w.Time("DTSTART", time.Date(2026, 10, 18, 21, 30, 0, 0, time.FixedZone("CEST", 2*60*60)))
+		w.End("VEVENT")
+	})
+
+	if want := "BEGIN:VEVENT\r\nDTSTART:20261018T193000Z\r\nEND:VEVENT\r\n"; doc != want {
+		t.Errorf("got %q, want %q", doc, want)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func TestFlushReturnsFirstError(t *testing.T) {
+	w := ical.NewWriter(failingWriter{})
+	w.Text("SUMMARY", strings.Repeat("a", 8192))
+	w.Text("SUMMARY", "b")
+
+	if err := w.Flush(); err == nil || err.Error() != "connection reset" {
+		t.Errorf("got error %v, want the writer's error", err)
+	}
+}
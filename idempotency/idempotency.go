@@ -0,0 +1,234 @@
+// Package idempotency makes requests safe to retry. The first response to a request with an Idempotency-Key
+// header is stored, per key and caller, and replayed when the request is retried with the same key.
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"todo-go/identity"
+	"todo-go/store"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// Header carries the key that the client chose for a request. Retries must send the same key.
+	Header = "Idempotency-Key"
+	// ReplayedHeader is set on responses that were replayed from an earlier request.
+	ReplayedHeader = "Idempotent-Replayed"
+
+	// maxKeyLength is the length of the longest key accepted.
+	maxKeyLength = 255
+	// lockTimeout is how long a key stays claimed by a request that never completes, e.g. because the server
+	// stopped while handling it. Retries within that time are rejected as in flight.
+	lockTimeout = time.Minute
+)
+
+// Config configures idempotency keys.
+type Config struct {
+	Enabled bool
+	// TTL is how long the first response for a key is replayed.
+	TTL time.Duration
+}
+
+// Validate returns a problem for each invalid setting.
+func (c *Config) Validate() []string {
+	if c.Enabled && c.TTL <= 0 {
+		return []string{"idempotency TTL must be positive"}
+	}
+
+	return nil
+}
+
+// Middleware stores and replays the responses of requests with idempotency keys. It must run after
+// authentication, since keys belong to the caller.
+type Middleware struct {
+	cfg   *Config
+	store *store.Store
+}
+
+func NewMiddleware(cfg *Config, db *store.Store) *Middleware {
+	return &Middleware{cfg: cfg, store: db}
+}
+
+// Handler handles requests with an idempotency key once per key. A retry is answered with the stored
+// response, with a 409 while the first request is still in flight, and with a 422 if its method, path or
+// body differ from the first request's. Requests without a key are passed through.
+//
+// Responses with a 5xx status aren't stored, so that requests that failed on the server can be retried.
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	if !m.cfg.Enabled {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(Header)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !validKey(key) {
+			http.Error(
+				w, "Idempotency-Key must be 1 to "+strconv.Itoa(maxKeyLength)+" printable ASCII characters",
+				http.StatusBadRequest,
+			)
+			return
+		}
+
+		subject := identity.ExtractSubject(r.Context())
+		if subject == "" {
+			http.Error(w, "context does not contain a subject value", http.StatusExpectationFailed)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		now := time.Now().UTC()
+		claim := &store.IdempotencyKey{
+			Subject:        subject,
+			IdempotencyKey: key,
+			Fingerprint:    fingerprint(r, body),
+			CreatedAt:      now,
+			ExpiresAt:      now.Add(lockTimeout),
+		}
+
+		existing, err := m.store.ClaimIdempotencyKey(claim, now)
+		if err != nil {
+			log.Err(err).Str("subject", subject).Msg("failed to claim idempotency key")
+			http.Error(w, "failed to claim idempotency key", http.StatusInternalServerError)
+			return
+		}
+
+		if existing != nil {
+			replay(w, existing, claim)
+			return
+		}
+
+		m.serve(w, r, next, claim)
+	})
+}
+
+// serve handles the request that claimed a key and stores its response.
+func (m *Middleware) serve(w http.ResponseWriter, r *http.Request, next http.Handler, claim *store.IdempotencyKey) {
+	rec := &recorder{ResponseWriter: w}
+
+	completed := false
+	defer func() {
+		if completed {
+			return
+		}
+
+		// The handler failed or panicked. Let the request be retried.
+		if err := m.store.ReleaseIdempotencyKey(claim.Subject, claim.IdempotencyKey); err != nil {
+			log.Err(err).Str("subject", claim.Subject).Msg("failed to release idempotency key")
+		}
+	}()
+
+	next.ServeHTTP(rec, r)
+
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	if rec.status >= http.StatusInternalServerError {
+		return
+	}
+
+	claim.Status = rec.status
+	claim.ContentType = rec.Header().Get("Content-Type")
+	claim.Body = rec.body.Bytes()
+	claim.ExpiresAt = claim.CreatedAt.Add(m.cfg.TTL)
+
+	if err := m.store.CompleteIdempotencyKey(claim); err != nil {
+		log.Err(err).Str("subject", claim.Subject).Msg("failed to store idempotent response")
+		return
+	}
+
+	completed = true
+}
+
+// replay answers a retry of the request that holds a key.
+func replay(w http.ResponseWriter, existing, retry *store.IdempotencyKey) {
+	switch {
+	case existing.Fingerprint != retry.Fingerprint:
+		http.Error(w, "Idempotency-Key was already used for a different request", http.StatusUnprocessableEntity)
+	case existing.InFlight():
+		http.Error(w, "a request with this Idempotency-Key is in progress", http.StatusConflict)
+	default:
+		if existing.ContentType != "" {
+			w.Header().Set("Content-Type", existing.ContentType)
+		}
+
+		w.Header().Set(ReplayedHeader, "true")
+		w.WriteHeader(existing.Status)
+		_, _ = w.Write(existing.Body)
+	}
+}
+
+// fingerprint identifies a request by its method, path and body.
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(body)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func validKey(key string) bool {
+	if len(key) > maxKeyLength {
+		return false
+	}
+
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
+
+// recorder passes a response through and keeps a copy of its status and body.
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+
+	r.body.Write(b)
+
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,127 @@
+package idempotency
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"todo-go/identity"
+	"todo-go/store"
+)
+
+func newTestMiddleware(t *testing.T) *Middleware {
+	t.Helper()
+
+	db, err := store.NewMemoryStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	return NewMiddleware(&Config{Enabled: true, TTL: time.Hour}, db)
+}
+
+// send makes a request with an idempotency key as rick.
+func send(handler http.Handler, key, path, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", path, strings.NewReader(body))
+	r.Header.Set(Header, key)
+	r = r.WithContext(identity.WithPrincipal(r.Context(), &identity.Principal{Subject: "rick@the-citadel.com"}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	return w
+}
+
+func TestReplay(t *testing.T) {
+	var calls atomic.Int32
+
+	handler := newTestMiddleware(t).Handler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		n := calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"call":` + strconv.Itoa(int(n)) + `}`))
+	}))
+
+	first := send(handler, "key", "/v1/todos", `{"title":"Buy milk"}`)
+	retry := send(handler, "key", "/v1/todos", `{"title":"Buy milk"}`)
+
+	switch {
+	case calls.Load() != 1:
+		t.Errorf("the handler was called %d times, want once", calls.Load())
+	case first.Header().Get(ReplayedHeader) != "":
+		t.Error("the first response is marked as replayed")
+	case retry.Code != http.StatusCreated || retry.Body.String() != `{"call":1}` ||
+		retry.Header().Get("Content-Type") != "application/json" || retry.Header().Get(ReplayedHeader) != "true":
+		t.Errorf("got replay %d %v [%s], want the first response", retry.Code, retry.Header(), retry.Body.String())
+	}
+
+	// Keys belong to the request they were first used for.
+	for name, w := range map[string]*httptest.ResponseRecorder{
+		"different body": send(handler, "key", "/v1/todos", `{"title":"Buy bread"}`),
+		"different path": send(handler, "key", "/v1/todos:batch", `{"title":"Buy milk"}`),
+	} {
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: got status %d, want 422", name, w.Code)
+		}
+	}
+}
+
+func TestRequestInFlight(t *testing.T) {
+	m := newTestMiddleware(t)
+
+	var retry *httptest.ResponseRecorder
+
+	var handler http.Handler
+	handler = m.Handler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		// The client retries while the first request is still being handled.
+		if retry == nil {
+			retry = send(handler, "key", "/v1/todos", `{}`)
+		}
+	}))
+
+	if w := send(handler, "key", "/v1/todos", `{}`); w.Code != http.StatusOK {
+		t.Fatalf("got status %d for the first request", w.Code)
+	}
+
+	if retry.Code != http.StatusConflict {
+		t.Errorf("got status %d for the retry in flight, want 409", retry.Code)
+	}
+}
+
+func TestKeyReleasedAfterFailure(t *testing.T) {
+	var calls atomic.Int32
+
+	handler := newTestMiddleware(t).Handler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			http.Error(w, "database is locked", http.StatusInternalServerError)
+		case 2:
+			panic("portal gun misfired")
+		default:
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+
+	if w := send(handler, "key", "/v1/todos", `{}`); w.Code != http.StatusInternalServerError {
+		t.Fatalf("got status %d, want the handler's 500", w.Code)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("the handler's panic was swallowed")
+			}
+		}()
+
+		send(handler, "key", "/v1/todos", `{}`)
+	}()
+
+	if w := send(handler, "key", "/v1/todos", `{}`); w.Code != http.StatusCreated || calls.Load() != 3 {
+		t.Errorf("got status %d after %d calls, want the retry handled", w.Code, calls.Load())
+	}
+}
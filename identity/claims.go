@@ -0,0 +1,91 @@
+package identity
+
+import "strings"
+
+// ClaimMapping names the token claims that hold a principal's attributes. Names may be dotted paths into
+// nested claims, such as "realm_access.roles".
+type ClaimMapping struct {
+	Email  string
+	Name   string
+	Groups string
+	Roles  string
+	// Scopes is read as a space-separated string or a list. If the claim is missing, "scp" is tried.
+	Scopes string
+}
+
+// DefaultClaimMapping returns the standard OIDC claim names.
+func DefaultClaimMapping() *ClaimMapping {
+	return &ClaimMapping{
+		Email:  "email",
+		Name:   "name",
+		Groups: "groups",
+		Roles:  "roles",
+		Scopes: "scope",
+	}
+}
+
+// Principal builds a principal from a token's claims. Missing or mistyped claims are left empty.
+func (m *ClaimMapping) Principal(claims map[string]interface{}) *Principal {
+	return &Principal{
+		Subject:    claimString(claims, "sub"),
+		Issuer:     claimString(claims, "iss"),
+		Email:      claimString(claims, m.Email),
+		Name:       claimString(claims, m.Name),
+		Groups:     claimStrings(claims, m.Groups),
+		Roles:      claimStrings(claims, m.Roles),
+		Scopes:     m.scopes(claims),
+		AuthMethod: AuthMethodJWT,
+	}
+}
+
+func (m *ClaimMapping) scopes(claims map[string]interface{}) []string {
+	if lookupClaim(claims, m.Scopes) != nil {
+		return claimStrings(claims, m.Scopes)
+	}
+
+	return claimStrings(claims, "scp")
+}
+
+func lookupClaim(claims map[string]interface{}, path string) interface{} {
+	if path == "" {
+		return nil
+	}
+
+	var value interface{} = claims
+	for _, key := range strings.Split(path, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		value = m[key]
+	}
+
+	return value
+}
+
+func claimString(claims map[string]interface{}, path string) string {
+	s, _ := lookupClaim(claims, path).(string)
+	return s
+}
+
+// claimStrings reads a claim that is either a list of strings or a single space-separated string.
+func claimStrings(claims map[string]interface{}, path string) []string {
+	switch v := lookupClaim(claims, path).(type) {
+	case string:
+		return strings.Fields(v)
+	case []string:
+		return v
+	case []interface{}:
+		var result []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+
+		return result
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,79 @@
+package identity
+
+import "strings"
+
+// AuthMethod is how a caller authenticated.
+type AuthMethod string
+
+const (
+	AuthMethodJWT     AuthMethod = "jwt"
+	AuthMethodPAT     AuthMethod = "pat"
+	AuthMethodSession AuthMethod = "session"
+)
+
+// Principal describes an authenticated caller.
+type Principal struct {
+	Subject string
+	Issuer  string
+	Email   string
+	Name    string
+	Groups  []string
+	Roles   []string
+	// Scopes are the OAuth scopes granted by the caller's token.
+	Scopes     []string
+	AuthMethod AuthMethod
+}
+
+// EmailDomain returns the domain part of the principal's email address, or an empty string.
+func (p *Principal) EmailDomain() string {
+	if _, domain, ok := strings.Cut(p.Email, "@"); ok {
+		return strings.ToLower(domain)
+	}
+
+	return ""
+}
+
+// InGroup reports whether the principal belongs to group.
+func (p *Principal) InGroup(group string) bool {
+	return contains(p.Groups, group)
+}
+
+// HasRole reports whether the principal has role.
+func (p *Principal) HasRole(role string) bool {
+	return contains(p.Roles, role)
+}
+
+// AsMap returns the principal's attributes in the form passed to the authorizer.
+func (p *Principal) AsMap() map[string]interface{} {
+	return map[string]interface{}{
+		"subject":      p.Subject,
+		"issuer":       p.Issuer,
+		"email":        p.Email,
+		"email_domain": p.EmailDomain(),
+		"name":         p.Name,
+		"groups":       toInterfaces(p.Groups),
+		"roles":        toInterfaces(p.Roles),
+		"scopes":       toInterfaces(p.Scopes),
+		"auth_method":  string(p.AuthMethod),
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// toInterfaces converts values to a slice that structpb accepts.
+func toInterfaces(values []string) []interface{} {
+	result := make([]interface{}, len(values))
+	for i, v := range values {
+		result[i] = v
+	}
+
+	return result
+}
@@ -0,0 +1,32 @@
+package identity
+
+// Scopes that tokens can grant.
+const (
+	ScopeRead  = "todos:read"
+	ScopeWrite = "todos:write"
+)
+
+// KnownScopes lists all scopes that tokens can grant.
+var KnownScopes = []string{ScopeRead, ScopeWrite}
+
+// IsKnownScope reports whether scope is one of KnownScopes.
+func IsKnownScope(scope string) bool {
+	return contains(KnownScopes, scope)
+}
+
+// HasScope reports whether the principal's token grants scope.
+func (p *Principal) HasScope(scope string) bool {
+	return contains(p.Scopes, scope)
+}
+
+// MissingScopes returns the scopes in required that the principal's token doesn't grant.
+func (p *Principal) MissingScopes(required ...string) []string {
+	var missing []string
+	for _, scope := range required {
+		if !p.HasScope(scope) {
+			missing = append(missing, scope)
+		}
+	}
+
+	return missing
+}
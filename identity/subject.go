@@ -5,18 +5,37 @@ import "context"
 type ContextKey string
 
 var (
-	SubjectKey = ContextKey("subject")
+	SubjectKey   = ContextKey("subject")
+	PrincipalKey = ContextKey("principal")
 )
 
+// WithSubject stores a bare subject in ctx. Prefer WithPrincipal when more is known about the caller.
 func WithSubject(ctx context.Context, subject string) context.Context {
 	return context.WithValue(ctx, SubjectKey, subject)
 }
 
-func ExtractSubject(ctx context.Context) string {
-	subject := ctx.Value(SubjectKey)
-	if subject != nil {
-		return subject.(string)
+// WithPrincipal stores the caller in ctx. The principal's subject is also stored under SubjectKey.
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	ctx = context.WithValue(ctx, PrincipalKey, principal)
+	return WithSubject(ctx, principal.Subject)
+}
+
+// FromContext returns the caller stored in ctx, or nil if there is none. A context that only holds a
+// subject yields a principal with just that subject.
+func FromContext(ctx context.Context) *Principal {
+	if principal, ok := ctx.Value(PrincipalKey).(*Principal); ok && principal != nil {
+		return principal
+	}
+
+	if subject := ExtractSubject(ctx); subject != "" {
+		return &Principal{Subject: subject}
 	}
 
-	return ""
+	return nil
+}
+
+// ExtractSubject returns the caller's subject, or an empty string if ctx has none.
+func ExtractSubject(ctx context.Context) string {
+	subject, _ := ctx.Value(SubjectKey).(string)
+	return subject
 }
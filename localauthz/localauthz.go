@@ -0,0 +1,213 @@
+// Package localauthz evaluates the todo application's authorization rules in-process, without an authorizer
+// service. It is meant for offline development only and is not a substitute for the todo policy.
+package localauthz
+
+import (
+	"context"
+	"runtime"
+	"strings"
+
+	"todo-go/directory"
+
+	authz "github.com/aserto-dev/go-authorizer/aserto/authorizer/v2"
+	"github.com/aserto-dev/go-authorizer/aserto/authorizer/v2/api"
+	dsc "github.com/aserto-dev/go-directory/aserto/directory/common/v3"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Version is reported by Info to make it obvious that decisions don't come from a real authorizer.
+const Version = "local (non-production)"
+
+// Directory is used to resolve callers and look up relations.
+type Directory interface {
+	UserFromIdentity(ctx context.Context, identity string) (*dsc.Object, error)
+	HasRelation(ctx context.Context, objectType, objectID, relation, subjectType, subjectID string) (bool, error)
+}
+
+// rule decides whether user may perform a request with the given resource context.
+type rule func(ctx context.Context, dir Directory, user *dsc.Object, resource map[string]*structpb.Value) (bool, error)
+
+// rules maps policy paths, relative to the policy root, to the rule that governs them.
+// Paths without a rule are denied.
+var rules = map[string]rule{
+	"GET.users.__userID": authenticated,
+	"GET.todos":          authenticated,
+	"GET.todos.export":   authenticated,
+	"POST.todos":         creator,
+	"PUT.todos.__id":     owner,
+	"DELETE.todos.__id":  owner,
+
+	"GET.me.usage":       authenticated,
+	"GET.me.calendar":    authenticated,
+	"POST.me.calendar":   authenticated,
+	"DELETE.me.calendar": authenticated,
+	"GET.events":         authenticated,
+
+	"GET.tokens":              authenticated,
+	"POST.tokens":             authenticated,
+	"DELETE.tokens.__tokenID": authenticated,
+
+	"GET.webhooks":                        authenticated,
+	"POST.webhooks":                       authenticated,
+	"GET.webhooks.__webhookID":            authenticated,
+	"PUT.webhooks.__webhookID":            authenticated,
+	"DELETE.webhooks.__webhookID":         authenticated,
+	"GET.webhooks.__webhookID.deliveries": authenticated,
+
+	"GET.admin.cache.identities":    admin,
+	"DELETE.admin.cache.identities": admin,
+
+	"check": check,
+}
+
+// Authorizer implements the authorizer service's Is call using the rules above.
+type Authorizer struct {
+	dir  Directory
+	root string
+}
+
+var _ authz.AuthorizerClient = (*Authorizer)(nil)
+
+func New(dir Directory, policyRoot string) *Authorizer {
+	return &Authorizer{dir: dir, root: policyRoot}
+}
+
+func (a *Authorizer) Is(ctx context.Context, in *authz.IsRequest, _ ...grpc.CallOption) (*authz.IsResponse, error) {
+	allowed, err := a.evaluate(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &authz.IsResponse{}
+	for _, decision := range in.GetPolicyContext().GetDecisions() {
+		resp.Decisions = append(resp.Decisions, &authz.Decision{Decision: decision, Is: allowed})
+	}
+
+	return resp, nil
+}
+
+func (a *Authorizer) evaluate(ctx context.Context, in *authz.IsRequest) (bool, error) {
+	path := a.relativePath(in.GetPolicyContext().GetPath())
+
+	evaluate, ok := rules[path]
+	if !ok {
+		log.Debug().Str("policy_path", in.GetPolicyContext().GetPath()).Msg("no local rule for policy path")
+		return false, nil
+	}
+
+	idc := in.GetIdentityContext()
+	if idc.GetType() != api.IdentityType_IDENTITY_TYPE_SUB || idc.GetIdentity() == "" {
+		return false, nil
+	}
+
+	user, err := a.dir.UserFromIdentity(ctx, idc.GetIdentity())
+	switch {
+	case errors.Is(err, directory.ErrNotFound):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+
+	return evaluate(ctx, a.dir, user, in.GetResourceContext().GetFields())
+}
+
+// relativePath strips the policy root from path. Check calls use the "rebac" root regardless of the
+// application's policy root.
+func (a *Authorizer) relativePath(path string) string {
+	for _, root := range []string{a.root, "rebac"} {
+		if rest, ok := strings.CutPrefix(path, root+"."); ok {
+			return rest
+		}
+	}
+
+	return path
+}
+
+func (a *Authorizer) Info(context.Context, *authz.InfoRequest, ...grpc.CallOption) (*authz.InfoResponse, error) {
+	return &authz.InfoResponse{Version: Version, Os: runtime.GOOS, Arch: runtime.GOARCH}, nil
+}
+
+func (a *Authorizer) DecisionTree(
+	context.Context, *authz.DecisionTreeRequest, ...grpc.CallOption,
+) (*authz.DecisionTreeResponse, error) {
+	return nil, unimplemented("DecisionTree")
+}
+
+func (a *Authorizer) Query(context.Context, *authz.QueryRequest, ...grpc.CallOption) (*authz.QueryResponse, error) {
+	return nil, unimplemented("Query")
+}
+
+func (a *Authorizer) Compile(context.Context, *authz.CompileRequest, ...grpc.CallOption) (*authz.CompileResponse, error) {
+	return nil, unimplemented("Compile")
+}
+
+func (a *Authorizer) ListPolicies(
+	context.Context, *authz.ListPoliciesRequest, ...grpc.CallOption,
+) (*authz.ListPoliciesResponse, error) {
+	return nil, unimplemented("ListPolicies")
+}
+
+func (a *Authorizer) GetPolicy(context.Context, *authz.GetPolicyRequest, ...grpc.CallOption) (*authz.GetPolicyResponse, error) {
+	return nil, unimplemented("GetPolicy")
+}
+
+// Close is a no-op. It lets the local authorizer be used wherever a remote client is closed.
+func (a *Authorizer) Close() error {
+	return nil
+}
+
+func authenticated(context.Context, Directory, *dsc.Object, map[string]*structpb.Value) (bool, error) {
+	return true, nil
+}
+
+func creator(ctx context.Context, dir Directory, user *dsc.Object, _ map[string]*structpb.Value) (bool, error) {
+	return dir.HasRelation(ctx,
+		directory.ResourceCreatorObjectType, directory.ResourceCreatorsObjectID, directory.MemberRelation,
+		directory.UserObjectType, user.Id,
+	)
+}
+
+func owner(ctx context.Context, dir Directory, user *dsc.Object, resource map[string]*structpb.Value) (bool, error) {
+	objectID := resource["object_id"].GetStringValue()
+	if objectID == "" {
+		return false, nil
+	}
+
+	return dir.HasRelation(ctx,
+		directory.ResourceObjectType, objectID, directory.OwnerRelation,
+		directory.UserObjectType, user.Id,
+	)
+}
+
+func admin(_ context.Context, _ Directory, user *dsc.Object, _ map[string]*structpb.Value) (bool, error) {
+	roles := user.GetProperties().GetFields()["roles"].GetListValue().GetValues()
+	for _, role := range roles {
+		if role.GetStringValue() == "admin" {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// check implements the "rebac.check" policy: the caller must have the requested relation to the object.
+func check(ctx context.Context, dir Directory, user *dsc.Object, resource map[string]*structpb.Value) (bool, error) {
+	objectType := resource["object_type"].GetStringValue()
+	objectID := resource["object_id"].GetStringValue()
+	relation := resource["relation"].GetStringValue()
+
+	if objectType == "" || objectID == "" || relation == "" {
+		return false, nil
+	}
+
+	return dir.HasRelation(ctx, objectType, objectID, relation, directory.UserObjectType, user.Id)
+}
+
+func unimplemented(method string) error {
+	return status.Errorf(codes.Unimplemented, "%s is not supported by the local authorizer", method)
+}
@@ -0,0 +1,134 @@
+package localauthz_test
+
+import (
+	"context"
+	"testing"
+
+	"todo-go/directory"
+	"todo-go/localauthz"
+
+	authz "github.com/aserto-dev/go-authorizer/aserto/authorizer/v2"
+	"github.com/aserto-dev/go-authorizer/aserto/authorizer/v2/api"
+	dsc "github.com/aserto-dev/go-directory/aserto/directory/common/v3"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// fakeDirectory resolves identities to users and holds relations as "type:id#relation@subjectType:subjectID".
+type fakeDirectory struct {
+	users     map[string]*dsc.Object
+	relations map[string]bool
+}
+
+func (d *fakeDirectory) UserFromIdentity(_ context.Context, identity string) (*dsc.Object, error) {
+	user, ok := d.users[identity]
+	if !ok {
+		return nil, directory.ErrNotFound
+	}
+
+	return user, nil
+}
+
+func (d *fakeDirectory) HasRelation(_ context.Context, objectType, objectID, relation, subjectType, subjectID string) (bool, error) {
+	return d.relations[objectType+":"+objectID+"#"+relation+"@"+subjectType+":"+subjectID], nil
+}
+
+func newFakeDirectory(t *testing.T) *fakeDirectory {
+	t.Helper()
+
+	props, err := structpb.NewStruct(map[string]interface{}{"roles": []interface{}{"viewer", "admin"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &fakeDirectory{
+		users: map[string]*dsc.Object{
+			"rick@the-citadel.com":  {Type: directory.UserObjectType, Id: "rick", Properties: props},
+			"morty@the-citadel.com": {Type: directory.UserObjectType, Id: "morty"},
+		},
+		relations: map[string]bool{
+			directory.ResourceCreatorObjectType + ":" + directory.ResourceCreatorsObjectID + "#" + directory.MemberRelation +
+				"@user:rick": true,
+			directory.ResourceObjectType + ":mortys-todo#" + directory.OwnerRelation + "@user:morty": true,
+		},
+	}
+}
+
+func TestRules(t *testing.T) {
+	authorizer := localauthz.New(newFakeDirectory(t), "todoApp")
+
+	tests := []struct {
+		name     string
+		identity string
+		path     string
+		objectID string
+		want     bool
+	}{
+		{"authenticated", "morty@the-citadel.com", "todoApp.GET.todos", "", true},
+		{"unknown user", "jerry@the-citadel.com", "todoApp.GET.todos", "", false},
+		{"anonymous", "", "todoApp.GET.todos", "", false},
+		{"creator", "rick@the-citadel.com", "todoApp.POST.todos", "", true},
+		{"not a creator", "morty@the-citadel.com", "todoApp.POST.todos", "", false},
+		{"owner", "morty@the-citadel.com", "todoApp.PUT.todos.__id", "mortys-todo", true},
+		{"not the owner", "rick@the-citadel.com", "todoApp.DELETE.todos.__id", "mortys-todo", false},
+		{"owner without an ID", "morty@the-citadel.com", "todoApp.DELETE.todos.__id", "", false},
+		{"admin role", "rick@the-citadel.com", "todoApp.GET.admin.cache.identities", "", true},
+		{"no admin role", "morty@the-citadel.com", "todoApp.DELETE.admin.cache.identities", "", false},
+		{"unknown path", "rick@the-citadel.com", "todoApp.DELETE.users.__userID", "", false},
+		{"other policy root", "morty@the-citadel.com", "otherApp.GET.todos", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource, err := structpb.NewStruct(map[string]interface{}{"object_id": tt.objectID})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			idc := &api.IdentityContext{Type: api.IdentityType_IDENTITY_TYPE_SUB, Identity: tt.identity}
+			if tt.identity == "" {
+				idc = &api.IdentityContext{Type: api.IdentityType_IDENTITY_TYPE_NONE}
+			}
+
+			resp, err := authorizer.Is(context.Background(), &authz.IsRequest{
+				IdentityContext: idc,
+				PolicyContext:   &api.PolicyContext{Path: tt.path, Decisions: []string{"allowed"}},
+				ResourceContext: resource,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(resp.Decisions) != 1 || resp.Decisions[0].Decision != "allowed" || resp.Decisions[0].Is != tt.want {
+				t.Errorf("got decisions %v, want allowed %t", resp.Decisions, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	authorizer := localauthz.New(newFakeDirectory(t), "todoApp")
+
+	for relation, want := range map[string]bool{directory.OwnerRelation: true, "viewer": false, "": false} {
+		resource, err := structpb.NewStruct(map[string]interface{}{
+			"object_type": directory.ResourceObjectType,
+			"object_id":   "mortys-todo",
+			"relation":    relation,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := authorizer.Is(context.Background(), &authz.IsRequest{
+			IdentityContext: &api.IdentityContext{Type: api.IdentityType_IDENTITY_TYPE_SUB, Identity: "morty@the-citadel.com"},
+			PolicyContext:   &api.PolicyContext{Path: "rebac.check", Decisions: []string{"allowed"}},
+			ResourceContext: resource,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := resp.Decisions[0].Is; got != want {
+			t.Errorf("relation %q: got allowed %t, want %t", relation, got, want)
+		}
+	}
+}
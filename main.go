@@ -2,86 +2,47 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
 	"os/signal"
+	"strings"
 	"syscall"
-	"time"
-
-	"todo-go/server"
-
-	"github.com/aserto-dev/go-aserto/middleware/gorillaz"
-	"github.com/gorilla/mux"
-	"github.com/rs/zerolog/log"
 )
 
 func main() {
-	// Load options from .env file.
-	options, err := server.LoadOptions()
-	if err != nil {
-		log.Fatal().Err(err).Msg("failed to load options")
+	os.Exit(run(os.Args[1:]))
+}
+
+// run dispatches to the command named by the first argument, defaulting to "serve".
+func run(args []string) int {
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
 
-	// Initialize the Server
-	srv, err := server.New(options)
-	if err != nil {
-		log.Fatal().Err(err).Msg("failed to create server")
+	cmd := findCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		printUsage()
+		return 2
 	}
-	defer srv.Close()
 
 	// Create a context that is cancelled when SIGINT or SIGTERM is received.
 	ctx, stop := signalContext()
 	defer stop()
 
-	// This middleware validates incoming JWTs and stores the subject name in the request context.
-	authn := AuthenticationMiddleware(ctx, options)
+	if err := cmd.run(ctx, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
 
-	// Create an authorizer client
-	azClient, err := NewAuthorizerClient(options.Authorizer)
-	if err != nil {
-		log.Fatal().Err(err).Msg("failed to create authorizer client")
+		fmt.Fprintf(os.Stderr, "%s: %s\n", cmd.name, err)
+		return 1
 	}
-	defer azClient.Close()
-
-	// This middleware authorizes incoming requests.
-	authz := AuthorizationMiddleware(azClient, options)
-
-	// Create the API router.
-	router := AppRouter(srv, authn, authz)
-
-	// Start the server
-	go func() {
-		srv.Start(router)
-	}()
-
-	// Wait for the context to be cancelled
-	<-ctx.Done()
-
-	// Gracefully shutdown the server
-	srv.Shutdown(5 * time.Second)
-}
-
-func AppRouter(srv *server.Server, authn mux.MiddlewareFunc, authz *gorillaz.Middleware) *mux.Router {
-	router := mux.NewRouter()
-
-	// Add authentication middleware to all routes.
-	router.Use(authn)
-
-	// Set up routes
-	router.Handle("/users/{userID}", authz.HandlerFunc(srv.GetUser)).Methods("GET")
-
-	router.Handle("/todos", authz.HandlerFunc(srv.GetTodos)).Methods("GET")
-	router.Handle("/todos/{id}", authz.HandlerFunc(srv.UpdateTodo)).Methods("PUT")
-	router.Handle("/todos/{id}", authz.HandlerFunc(srv.DeleteTodo)).Methods("DELETE")
-
-	router.Handle(
-		"/todos",
-		authz.Check(
-			gorillaz.WithObjectType("resource-creator"),
-			gorillaz.WithRelation("member"),
-			gorillaz.WithObjectID("resource-creators"),
-			gorillaz.WithPolicyPath("rebac.check"),
-		).HandlerFunc(srv.InsertTodo)).Methods("POST")
 
-	return router
+	return 0
 }
 
 // signalContext returns a context that is cancelled when SIGINT or SIGTERM is received.
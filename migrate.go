@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"todo-go/server"
+	"todo-go/store"
+)
+
+func runMigrate(_ context.Context, args []string) error {
+	flags := server.NewOptionFlags("migrate")
+	status := flags.Bool("status", false, "report the schema version without applying migrations")
+
+	if _, err := loadOptions(flags, args); err != nil {
+		return err
+	}
+
+	db := store.OpenStore()
+	defer db.Close()
+
+	if *status {
+		version, err := db.SchemaVersion()
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("schema version %d (latest %d)\n", version, store.LatestSchemaVersion())
+		return nil
+	}
+
+	from, to, err := db.Migrate()
+	if err != nil {
+		return err
+	}
+
+	if from == to {
+		fmt.Printf("schema is up to date at version %d\n", to)
+	} else {
+		fmt.Printf("migrated schema from version %d to %d\n", from, to)
+	}
+
+	return nil
+}
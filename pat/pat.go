@@ -0,0 +1,52 @@
+// Package pat generates and hashes personal access tokens and calendar feed tokens. Tokens are random strings
+// with a recognizable prefix. Only their SHA-256 hash is stored.
+package pat
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// Prefix identifies personal access tokens, distinguishing them from JWTs.
+const Prefix = "todo_pat_"
+
+// FeedPrefix identifies calendar feed tokens. They only grant access to a calendar feed and aren't accepted
+// as bearer tokens.
+const FeedPrefix = "todo_cal_"
+
+const secretSize = 32
+
+// Generate returns a new token and its hash.
+func Generate() (token, hash string, err error) {
+	return generate(Prefix)
+}
+
+// GenerateFeed returns a new calendar feed token and its hash.
+func GenerateFeed() (token, hash string, err error) {
+	return generate(FeedPrefix)
+}
+
+func generate(prefix string) (token, hash string, err error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+
+	token = prefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	return token, Hash(token), nil
+}
+
+// Hash returns the hash under which a token is stored.
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsToken reports whether s looks like a personal access token.
+func IsToken(s string) bool {
+	return strings.HasPrefix(s, Prefix)
+}
@@ -0,0 +1,54 @@
+package pat_test
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"todo-go/pat"
+)
+
+func TestGenerate(t *testing.T) {
+	for prefix, generate := range map[string]func() (string, string, error){
+		pat.Prefix:     pat.Generate,
+		pat.FeedPrefix: pat.GenerateFeed,
+	} {
+		token, hash, err := generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.HasPrefix(token, prefix) || len(token) != len(prefix)+43 {
+			t.Errorf("got token %q, want %s followed by 32 encoded bytes", token, prefix)
+		}
+
+		if raw, err := hex.DecodeString(hash); err != nil || len(raw) != 32 || hash != pat.Hash(token) {
+			t.Errorf("got hash %q of token %q, want its SHA-256", hash, token)
+		}
+
+		if other, _, _ := generate(); other == token {
+			t.Errorf("got token %q twice", token)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	// echo -n todo_pat_secret | sha256sum
+	if got := pat.Hash("todo_pat_secret"); got != "019ed897dd5e7c50d332346614166bfe261c861648bc8518a8f0ee5b09cb1ff9" {
+		t.Errorf("got hash %s", got)
+	}
+}
+
+func TestIsToken(t *testing.T) {
+	for s, want := range map[string]bool{
+		"todo_pat_abc":           true,
+		"todo_cal_abc":           false,
+		"eyJhbGciOiJFUzI1NiJ9.e": false,
+		"Bearer todo_pat_abc":    false,
+		"":                       false,
+	} {
+		if got := pat.IsToken(s); got != want {
+			t.Errorf("IsToken(%q): got %t, want %t", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// Package quota defines per-user limits on todos. Defaults come from the configuration and can be overridden
+// for a user or a group with a "quota" property on its directory object, such as
+//
+//	{"quota": {"maxTodos": 5000, "maxTitleLength": 500}}
+package quota
+
+import (
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// PropertyName is the directory object property that holds quota overrides.
+const PropertyName = "quota"
+
+// Config holds the limits that apply to a user. Zero means unlimited.
+type Config struct {
+	// MaxTodos is the number of todos a user may own.
+	MaxTodos int
+	// MaxTitleLength is the number of characters allowed in a todo title.
+	MaxTitleLength int
+}
+
+// Resolve returns the limits for a user with the given directory object properties, who belongs to groups
+// with the given properties. Group overrides replace the defaults, the most generous group winning, and
+// user overrides replace both. Any of the properties may be nil.
+func (c *Config) Resolve(user *structpb.Struct, groups ...*structpb.Struct) Config {
+	resolved := *c
+
+	var fromGroups Config
+	overridden := map[string]bool{}
+
+	for _, group := range groups {
+		for name, value := range overrides(group) {
+			field := fromGroups.field(name)
+			if !overridden[name] || isMoreGenerous(value, *field) {
+				*field = value
+			}
+			overridden[name] = true
+		}
+	}
+
+	for name := range overridden {
+		*resolved.field(name) = *fromGroups.field(name)
+	}
+
+	for name, value := range overrides(user) {
+		*resolved.field(name) = value
+	}
+
+	return resolved
+}
+
+// TodosLeft reports whether a user who owns count todos may create another.
+func (c Config) TodosLeft(count int) bool {
+	return c.MaxTodos == 0 || count < c.MaxTodos
+}
+
+// TitleFits reports whether title is within the title length limit.
+func (c Config) TitleFits(title string) bool {
+	return c.MaxTitleLength == 0 || utf8.RuneCountInString(title) <= c.MaxTitleLength
+}
+
+const (
+	maxTodosProperty       = "maxTodos"
+	maxTitleLengthProperty = "maxTitleLength"
+)
+
+func (c *Config) field(name string) *int {
+	switch name {
+	case maxTodosProperty:
+		return &c.MaxTodos
+	default:
+		return &c.MaxTitleLength
+	}
+}
+
+// overrides returns the non-negative limits set in the quota property of props.
+func overrides(props *structpb.Struct) map[string]int {
+	result := map[string]int{}
+
+	quota := props.GetFields()[PropertyName].GetStructValue()
+	for _, name := range []string{maxTodosProperty, maxTitleLengthProperty} {
+		value, ok := quota.GetFields()[name]
+		if !ok {
+			continue
+		}
+
+		if n, ok := value.GetKind().(*structpb.Value_NumberValue); ok && n.NumberValue >= 0 {
+			result[name] = int(n.NumberValue)
+		}
+	}
+
+	return result
+}
+
+// isMoreGenerous reports whether limit a allows more than limit b, where zero is unlimited.
+func isMoreGenerous(a, b int) bool {
+	return b != 0 && (a == 0 || a > b)
+}
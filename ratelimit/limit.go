@@ -0,0 +1,97 @@
+// Package ratelimit limits request rates with token buckets, keyed by client IP before authentication and
+// by subject after it.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Limit allows Requests requests per Period. Buckets hold up to Requests tokens and refill continuously,
+// so short bursts up to the full limit are allowed. A zero limit is unlimited.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParseLimit parses a limit such as "300/1m" or "10/s". An empty string is unlimited.
+func ParseLimit(s string) (Limit, error) {
+	if s == "" {
+		return Limit{}, nil
+	}
+
+	requests, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, errors.Errorf("rate limit [%s] must look like 300/1m", s)
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(requests))
+	if err != nil || n < 0 {
+		return Limit{}, errors.Errorf("rate limit [%s] must start with a non-negative number of requests", s)
+	}
+
+	period = strings.TrimSpace(period)
+
+	d, err := time.ParseDuration(period)
+	if err != nil {
+		// Allow a bare unit, as in 10/s.
+		d, err = time.ParseDuration("1" + period)
+	}
+
+	if err != nil || d <= 0 {
+		return Limit{}, errors.Errorf("rate limit [%s] must end with a positive period", s)
+	}
+
+	return Limit{Requests: n, Period: d}, nil
+}
+
+// Unlimited reports whether the limit allows any number of requests.
+func (l Limit) Unlimited() bool {
+	return l.Requests == 0
+}
+
+func (l Limit) String() string {
+	if l.Unlimited() {
+		return ""
+	}
+
+	// Drop zero minutes and seconds, so one minute reads "1m" rather than "1m0s".
+	period := l.Period.String()
+	if strings.HasSuffix(period, "m0s") {
+		period = strings.TrimSuffix(period, "0s")
+	}
+
+	if strings.HasSuffix(period, "h0m") {
+		period = strings.TrimSuffix(period, "0m")
+	}
+
+	return fmt.Sprintf("%d/%s", l.Requests, period)
+}
+
+// rate is the number of tokens added per second.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// Result is the outcome of taking a token.
+type Result struct {
+	Allowed bool
+	Limit   int
+	// Remaining is the number of whole tokens left in the bucket.
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until a token is available, if the request was not allowed.
+	RetryAfter time.Duration
+}
+
+// Limiter takes tokens from buckets. Implementations must be safe for concurrent use. MemoryLimiter keeps
+// buckets in process; a backend shared between replicas can implement the same interface.
+type Limiter interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
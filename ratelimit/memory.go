@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+// MemoryLimiter keeps token buckets in memory. Buckets that have refilled completely are dropped
+// periodically, since a new bucket would be identical.
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+var _ Limiter = (*MemoryLimiter)(nil)
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{buckets: map[string]*bucket{}, lastSweep: time.Now(), now: time.Now}
+}
+
+func (m *MemoryLimiter) Take(_ context.Context, key string, limit Limit) (Result, error) {
+	if limit.Unlimited() {
+		return Result{Allowed: true}, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok || b.limit != limit {
+		b = &bucket{tokens: float64(limit.Requests), updated: now, limit: limit}
+		m.buckets[key] = b
+	}
+
+	b.refill(now)
+
+	result := Result{Limit: limit.Requests}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = durationFor(1-b.tokens, limit)
+	}
+
+	result.Remaining = int(math.Floor(b.tokens))
+	result.Reset = durationFor(float64(limit.Requests)-b.tokens, limit)
+
+	return result, nil
+}
+
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated).Seconds()
+	b.tokens = math.Min(float64(b.limit.Requests), b.tokens+elapsed*b.limit.rate())
+	b.updated = now
+}
+
+// sweep drops full buckets. The caller must hold m.mu.
+func (m *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+
+	m.lastSweep = now
+
+	for key, b := range m.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Requests) {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// durationFor returns how long it takes to add tokens to a bucket with the given limit.
+func durationFor(tokens float64, limit Limit) time.Duration {
+	return time.Duration(tokens / limit.rate() * float64(time.Second))
+}
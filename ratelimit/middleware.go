@@ -0,0 +1,169 @@
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"todo-go/identity"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+// Config sets the rate limits.
+type Config struct {
+	Enabled bool
+	// PerIP limits each client IP across all routes. It is applied before authentication.
+	PerIP Limit
+	// PerSubject limits each authenticated caller across all routes that don't have their own limit.
+	PerSubject Limit
+	// Routes sets per-subject limits for individual routes, keyed by method and path template, such as
+	// "POST /v1/todos".
+	Routes map[string]Limit
+	// TrustForwardedFor takes the client IP from the X-Forwarded-For header. Only enable it behind a proxy
+	// that sets the header.
+	TrustForwardedFor bool
+	// ForwardedHops is the number of trusted proxies in front of the server, each of which appends the
+	// address it received the request from to X-Forwarded-For. The client IP is that many entries from the
+	// right; entries to its left are written by the client and can't be trusted.
+	ForwardedHops int
+}
+
+// Validate returns a problem for each invalid setting.
+func (c *Config) Validate() []string {
+	var problems []string
+
+	if c.TrustForwardedFor && c.ForwardedHops < 1 {
+		problems = append(problems, "rate limit forwarded hops must be at least 1 when X-Forwarded-For is trusted")
+	}
+
+	for route := range c.Routes {
+		method, path, ok := strings.Cut(route, " ")
+		if !ok || method == "" || !strings.HasPrefix(path, "/") {
+			problems = append(problems, "rate limit route ["+route+"] must look like \"POST /v1/todos\"")
+		}
+	}
+
+	return problems
+}
+
+// Middleware applies the configured limits to requests.
+type Middleware struct {
+	cfg     *Config
+	limiter Limiter
+}
+
+func NewMiddleware(cfg *Config, limiter Limiter) *Middleware {
+	return &Middleware{cfg: cfg, limiter: limiter}
+}
+
+// ByIP limits requests per client IP.
+func (m *Middleware) ByIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.allow(w, r, "ip:"+m.clientIP(r), m.cfg.PerIP) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// BySubject limits requests per authenticated caller, using the route's own limit if it has one. It must run
+// after authentication.
+func (m *Middleware) BySubject(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject := identity.ExtractSubject(r.Context())
+
+		key, limit := "subject:"+subject, m.cfg.PerSubject
+
+		if route := routeName(r); route != "" {
+			if routeLimit, ok := m.cfg.Routes[route]; ok {
+				key, limit = "subject:"+subject+":"+route, routeLimit
+			}
+		}
+
+		if m.allow(w, r, key, limit) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// allow takes a token for key and sets the rate limit headers. If the limit is exceeded, it writes a 429
+// response and returns false. Limiter errors let the request through.
+func (m *Middleware) allow(w http.ResponseWriter, r *http.Request, key string, limit Limit) bool {
+	if limit.Unlimited() {
+		return true
+	}
+
+	result, err := m.limiter.Take(r.Context(), key, limit)
+	if err != nil {
+		log.Err(err).Str("key", key).Msg("rate limiter failed")
+		return true
+	}
+
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	h.Set("RateLimit-Reset", seconds(result.Reset))
+	h.Set("RateLimit-Policy", strconv.Itoa(limit.Requests)+";w="+seconds(limit.Period))
+
+	if !result.Allowed {
+		h.Set("Retry-After", seconds(result.RetryAfter))
+		http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+
+		log.Debug().Str("key", key).Str("limit", limit.String()).Msg("rate limit exceeded")
+
+		return false
+	}
+
+	return true
+}
+
+// clientIP returns the IP of the client that sent r. Behind trusted proxies, it is the X-Forwarded-For entry
+// appended by the outermost one, so clients can't choose their own IP by sending the header.
+func (m *Middleware) clientIP(r *http.Request) string {
+	if m.cfg.TrustForwardedFor {
+		var hops []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			for _, hop := range strings.Split(header, ",") {
+				if hop = strings.TrimSpace(hop); hop != "" {
+					hops = append(hops, hop)
+				}
+			}
+		}
+
+		if len(hops) > 0 {
+			// Requests that passed through fewer proxies than configured only carry entries written by them.
+			return hops[max(len(hops)-m.cfg.ForwardedHops, 0)]
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// routeName returns the method and path template of the matched route, e.g. "PUT /v1/todos/{id}".
+func routeName(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return ""
+	}
+
+	tmpl, err := route.GetPathTemplate()
+	if err != nil {
+		return ""
+	}
+
+	return r.Method + " " + tmpl
+}
+
+// seconds formats d as whole seconds, rounded up.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
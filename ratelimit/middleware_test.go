@@ -0,0 +1,38 @@
+package ratelimit
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		trust     bool
+		hops      int
+		forwarded []string
+		want      string
+	}{
+		{"untrusted header", false, 1, []string{"10.0.0.1"}, "192.0.2.1"},
+		{"no header", true, 1, nil, "192.0.2.1"},
+		{"one proxy", true, 1, []string{"10.0.0.1"}, "10.0.0.1"},
+		{"spoofed entries", true, 1, []string{"203.0.113.7, 198.51.100.2, 10.0.0.1"}, "10.0.0.1"},
+		{"two proxies", true, 2, []string{"203.0.113.7, 10.0.0.1, 10.0.0.2"}, "10.0.0.1"},
+		{"several headers", true, 2, []string{"203.0.113.7", "10.0.0.1, 10.0.0.2"}, "10.0.0.1"},
+		{"fewer entries than proxies", true, 3, []string{"10.0.0.1, 10.0.0.2"}, "10.0.0.1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m := NewMiddleware(&Config{TrustForwardedFor: tc.trust, ForwardedHops: tc.hops}, nil)
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = "192.0.2.1:4711"
+			for _, header := range tc.forwarded {
+				r.Header.Add("X-Forwarded-For", header)
+			}
+
+			if got := m.clientIP(r); got != tc.want {
+				t.Errorf("got client IP [%s], want [%s]", got, tc.want)
+			}
+		})
+	}
+}
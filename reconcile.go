@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"todo-go/server"
+
+	"github.com/pkg/errors"
+)
+
+// runReconcile makes the directory match the store: todos missing from the directory are added,
+// and, with --prune, directory resources without a matching todo are deleted.
+func runReconcile(ctx context.Context, args []string) error {
+	flags := server.NewOptionFlags("reconcile")
+	dryRun := flags.Bool("dry-run", false, "report differences without changing anything")
+	prune := flags.Bool("prune", false, "delete directory resources that have no matching todo")
+
+	options, err := loadOptions(flags, args)
+	if err != nil {
+		return err
+	}
+
+	db, dir, err := openDeps(options)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	defer dir.Close()
+
+	todos, err := db.GetTodos()
+	if err != nil {
+		return err
+	}
+
+	dirIDs, err := dir.ListTodoIDs(ctx)
+	if err != nil {
+		return err
+	}
+
+	inDirectory := make(map[string]bool, len(dirIDs))
+	for _, id := range dirIDs {
+		inDirectory[id] = true
+	}
+
+	added := 0
+	for i := range todos {
+		todo := &todos[i]
+		if inDirectory[todo.ID] {
+			delete(inDirectory, todo.ID)
+			continue
+		}
+
+		fmt.Printf("missing from directory: %s (%s)\n", todo.ID, todo.Title)
+		added++
+
+		if !*dryRun {
+			if err := dir.AddTodo(ctx, todo); err != nil {
+				return errors.Wrapf(err, "failed to add todo [%s] to the directory", todo.ID)
+			}
+		}
+	}
+
+	// Remaining entries are directory resources with no todo in the store.
+	for id := range inDirectory {
+		fmt.Printf("orphaned in directory: %s\n", id)
+
+		if *prune && !*dryRun {
+			if err := dir.DeleteTodo(ctx, id); err != nil {
+				return errors.Wrapf(err, "failed to delete orphaned resource [%s]", id)
+			}
+		}
+	}
+
+	fmt.Printf("%d missing, %d orphaned", added, len(inDirectory))
+	if *dryRun {
+		fmt.Print(" (dry run)")
+	}
+	fmt.Println()
+
+	return nil
+}
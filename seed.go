@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"todo-go/directory"
+	"todo-go/server"
+	"todo-go/store"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// seedUser is a demo user along with the titles of the todos it owns.
+type seedUser struct {
+	directory.User
+	Todos []string `json:"todos"`
+}
+
+// seedNamespace is used to derive stable todo IDs so that seeding is idempotent.
+var seedNamespace = uuid.MustParse("5b0d3c5e-8f4a-4f8e-9d43-0c6f8f7f2a11")
+
+var defaultSeedUsers = []seedUser{
+	{
+		User: directory.User{
+			ID: "rick@the-citadel.com", DisplayName: "Rick Sanchez", Identity: "rick@the-citadel.com",
+			Properties: map[string]any{"email": "rick@the-citadel.com", "roles": []any{"admin", "evil_genius"}},
+			Creator:    true,
+		},
+		Todos: []string{"Build a portal gun", "Pick up Morty from school"},
+	},
+	{
+		User: directory.User{
+			ID: "morty@the-citadel.com", DisplayName: "Morty Smith", Identity: "morty@the-citadel.com",
+			Properties: map[string]any{"email": "morty@the-citadel.com", "roles": []any{"editor"}},
+			Creator:    true,
+		},
+		Todos: []string{"Finish homework"},
+	},
+	{
+		User: directory.User{
+			ID: "jerry@the-smiths.com", DisplayName: "Jerry Smith", Identity: "jerry@the-smiths.com",
+			Properties: map[string]any{"email": "jerry@the-smiths.com", "roles": []any{"viewer"}},
+		},
+	},
+}
+
+func runSeed(ctx context.Context, args []string) error {
+	flags := server.NewOptionFlags("seed")
+	file := flags.String("file", "", "JSON file with the users and todos to create (defaults to built-in demo data)")
+
+	options, err := loadOptions(flags, args)
+	if err != nil {
+		return err
+	}
+
+	users := defaultSeedUsers
+	if *file != "" {
+		if users, err = readSeedFile(*file); err != nil {
+			return err
+		}
+	}
+
+	db, dir, err := openDeps(options)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	defer dir.Close()
+
+	for i := range users {
+		user := &users[i]
+		if err := dir.AddUser(ctx, &user.User); err != nil {
+			return errors.Wrapf(err, "failed to seed user [%s]", user.ID)
+		}
+
+		for _, title := range user.Todos {
+			todo := &store.Todo{
+				ID:        uuid.NewSHA1(seedNamespace, []byte(user.ID+"/"+title)).String(),
+				OwnerID:   user.ID,
+				Title:     title,
+				UpdatedAt: time.Now().UTC(),
+			}
+
+			if err := seedTodo(ctx, db, dir, todo); err != nil {
+				return errors.Wrapf(err, "failed to seed todo [%s]", title)
+			}
+		}
+
+		fmt.Printf("seeded user %s with %d todos\n", user.ID, len(user.Todos))
+	}
+
+	return nil
+}
+
+func seedTodo(ctx context.Context, db *store.Store, dir *directory.Directory, todo *store.Todo) error {
+	existing, err := db.GetTodo(todo.ID)
+	if err != nil {
+		return err
+	}
+
+	if existing == nil {
+		if err := db.InsertTodo(todo); err != nil {
+			return err
+		}
+	}
+
+	return dir.AddTodo(ctx, todo)
+}
+
+func readSeedFile(path string) ([]seedUser, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read seed file [%s]", path)
+	}
+
+	var users []seedUser
+	if err := json.Unmarshal(data, &users); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse seed file [%s]", path)
+	}
+
+	return users, nil
+}
+
+// populateMemoryDirectory loads the demo users into an in-memory directory and adds an owner relation for
+// every todo in the store, so that a server running without a directory service starts in a usable state.
+func populateMemoryDirectory(ctx context.Context, db *store.Store, dir *directory.Directory) error {
+	for i := range defaultSeedUsers {
+		if err := dir.AddUser(ctx, &defaultSeedUsers[i].User); err != nil {
+			return err
+		}
+	}
+
+	todos, err := db.GetTodos()
+	if err != nil {
+		return err
+	}
+
+	for i := range todos {
+		if err := dir.AddTodo(ctx, &todos[i]); err != nil {
+			return err
+		}
+	}
+
+	log.Info().Int("users", len(defaultSeedUsers)).Int("todos", len(todos)).Msg("in-memory directory populated")
+
+	return nil
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"todo-go/decisioncache"
+	"todo-go/decisionlog"
+	"todo-go/devauth"
+	"todo-go/directory"
+	"todo-go/idempotency"
+	"todo-go/ratelimit"
+	"todo-go/server"
+	"todo-go/session"
+	"todo-go/webhooks"
+
+	"github.com/aserto-dev/go-aserto/middleware/gorillaz"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+func runServe(ctx context.Context, args []string) error {
+	options, err := loadOptions(server.NewOptionFlags("serve"), args)
+	if err != nil {
+		return err
+	}
+
+	// Open the todo store and connect to the directory.
+	db, dir, err := openDeps(options)
+	if err != nil {
+		return err
+	}
+
+	// Initialize the Server
+	srv := server.New(options, db, dir)
+	defer srv.Close()
+
+	if options.DirectoryMode == server.ModeMemory {
+		if err := populateMemoryDirectory(ctx, db, dir); err != nil {
+			return errors.Wrap(err, "failed to populate in-memory directory")
+		}
+	}
+
+	// In development auth mode, the server issues its own tokens and trusts them.
+	var issuer *devauth.Issuer
+	if options.DevAuth.Enabled {
+		if issuer, err = devauth.LoadOrCreate(options.DevAuth, options.OidcAudience); err != nil {
+			return errors.Wrap(err, "failed to create development token issuer")
+		}
+	}
+
+	// Browser clients can log in and authenticate with a session cookie.
+	var sessions *session.Manager
+	if options.Session.Enabled {
+		sessions, err = session.NewManager(
+			ctx, options.Session, options.OidcIssuer, options.OidcJwksURL, PrincipalFromClaims(options),
+		)
+		if err != nil {
+			return errors.Wrap(err, "failed to create session manager")
+		}
+	}
+
+	// This middleware validates incoming JWTs, personal access tokens and session cookies and stores the
+	// caller's principal in the request context.
+	bearer := NewBearerAuthenticator(ctx, options, db)
+	authn := AuthenticationMiddleware(bearer, sessions)
+
+	// Create an authorizer client
+	azClient, err := NewAuthorizer(options, dir)
+	if err != nil {
+		return errors.Wrap(err, "failed to create authorizer client")
+	}
+	defer azClient.Close()
+
+	// Record authorization decisions.
+	decisions, err := decisionlog.NewSink(options.DecisionLog)
+	if err != nil {
+		return errors.Wrap(err, "failed to create decision log")
+	}
+	defer decisions.Close()
+
+	// Cache decisions and drop them when this server changes the relations they depend on.
+	cache := decisioncache.NewAuthorizer(azClient, options.DecisionCache)
+	srv.Directory.ObserveRelations(cache.InvalidateObject)
+
+	// Responses tell callers what they may do with each todo, and event streams leave out the todos they may
+	// not read, as decided by the cached policies. The decisions don't authorize requests, so they aren't logged.
+	srv.AuthorizeTodo = todoAuthorizer(cache, options)
+
+	// This middleware authorizes incoming requests.
+	authorizer := decisionlog.NewAuthorizer(cache, decisions, options.DecisionLog.IncludeAllowed)
+	authz := AuthorizationMiddleware(authorizer, options)
+
+	// Limit request rates per client IP and per caller.
+	var limits *ratelimit.Middleware
+	if options.RateLimit.Enabled {
+		limits = ratelimit.NewMiddleware(options.RateLimit, ratelimit.NewMemoryLimiter())
+	}
+
+	// Deliver events to the webhooks users register, as long as their owners may stream events.
+	dispatcher := webhooks.NewDispatcher(options.Webhooks, db, srv.Events, eventAccess(authorizer, options))
+	dispatcher.Start()
+	defer dispatcher.Close()
+
+	// Replay the responses of retried requests that create todos.
+	idempotent := idempotency.NewMiddleware(options.Idempotency, db)
+
+	// Create the API router.
+	router := AppRouter(
+		srv, authn, options.RouteScopes, authz, todoAuthorizer(authorizer, options), feedAccess(authorizer, options),
+		idempotent, issuer, sessions, limits,
+	)
+
+	// Clients are generated from the OpenAPI document, so it must describe exactly the routes we serve.
+	if err := server.CheckAPISpec(router); err != nil {
+		return err
+	}
+
+	// Start the server
+	go func() {
+		srv.Start(router)
+	}()
+
+	// Serve the same operations over gRPC, authenticated and authorized like HTTP requests.
+	if options.GRPC.Enabled {
+		grpcServer := NewGRPCServer(srv, bearer, authorizer, options)
+		defer grpcServer.GracefulStop()
+
+		go ServeGRPC(grpcServer, options.GRPC)
+	}
+
+	// Wait for the context to be cancelled
+	<-ctx.Done()
+
+	// Gracefully shutdown the server
+	srv.Shutdown(5 * time.Second)
+
+	return nil
+}
+
+// AppRouter creates the API router. Each route requires the OAuth scopes that routeScopes sets for it.
+// Batches of todo changes are authorized per operation by batchAuthz, and calendar feeds, which are
+// authenticated by their own tokens, by feedAccess. Requests that create todos can be retried safely with
+// idempotency keys. The development token issuer, the session manager and rate limits are optional.
+func AppRouter(
+	srv *server.Server,
+	authn mux.MiddlewareFunc,
+	routeScopes map[string][]string,
+	authz *gorillaz.Middleware,
+	batchAuthz server.TodoAuthorizer,
+	feedAccess server.FeedAccessCheck,
+	idempotent *idempotency.Middleware,
+	issuer *devauth.Issuer,
+	sessions *session.Manager,
+	limits *ratelimit.Middleware,
+) *mux.Router {
+	root := mux.NewRouter()
+
+	// Limit each client IP before doing any work to authenticate it.
+	if limits != nil {
+		root.Use(limits.ByIP)
+	}
+
+	// Unauthenticated routes.
+	root.HandleFunc("/health", srv.Health).Methods("GET")
+
+	if issuer != nil {
+		root.HandleFunc(devauth.JWKSPath, issuer.JWKS).Methods("GET")
+		root.HandleFunc(devauth.TokenPath, issuer.Token).Methods("POST")
+		root.HandleFunc(devauth.AuthorizePath, issuer.Authorize).Methods("GET")
+		root.HandleFunc(devauth.OAuthTokenPath, issuer.OAuthToken).Methods("POST")
+	}
+
+	if sessions != nil {
+		root.HandleFunc(session.LoginPath, sessions.Login).Methods("GET")
+		root.HandleFunc(session.CallbackPath, sessions.Callback).Methods("GET")
+		root.HandleFunc(session.LogoutPath, sessions.Logout).Methods("POST")
+	}
+
+	// The API is versioned. Its description is public.
+	root.HandleFunc(server.APIPrefix+"/openapi.json", srv.OpenAPI).Methods("GET")
+
+	// Calendar apps can't send bearer tokens. Feeds are authenticated by the feed token in their URL.
+	root.HandleFunc(server.APIPrefix+server.CalendarPath, srv.ServeCalendar(feedAccess)).Methods("GET")
+
+	// Add authentication middleware to all other API routes.
+	router := root.PathPrefix(server.APIPrefix).Subrouter()
+	router.Use(authn)
+
+	if limits != nil {
+		router.Use(limits.BySubject)
+	}
+
+	// Set up routes. Each route requires the OAuth scopes that its token must grant, before it is authorized.
+	handle := func(method, path string, handler http.Handler) {
+		scopes := RequireScopes(routeScopes[method+" "+server.APIPrefix+path]...)
+		router.Handle(path, scopes(handler)).Methods(method)
+	}
+
+	handle("GET", "/users/{userID}", authz.HandlerFunc(srv.GetUser))
+
+	handle("GET", "/todos", authz.HandlerFunc(srv.GetTodos))
+	handle("GET", "/todos/export", authz.HandlerFunc(srv.ExportTodos))
+	handle("PUT", "/todos/{id}", authz.HandlerFunc(srv.UpdateTodo))
+	handle("DELETE", "/todos/{id}", authz.HandlerFunc(srv.DeleteTodo))
+
+	// Each operation in a batch is authorized like the route that performs it on its own.
+	handle("POST", "/todos:batch", idempotent.Handler(srv.BatchTodos(batchAuthz)))
+
+	handle("GET", "/events", authz.HandlerFunc(srv.StreamEvents))
+
+	handle("GET", "/me/usage", authz.HandlerFunc(srv.GetUsage))
+	handle("GET", "/me/calendar", authz.HandlerFunc(srv.GetCalendarFeed))
+	handle("POST", "/me/calendar", authz.HandlerFunc(srv.CreateCalendarFeed))
+	handle("DELETE", "/me/calendar", authz.HandlerFunc(srv.DeleteCalendarFeed))
+
+	handle("GET", "/tokens", authz.HandlerFunc(srv.ListAccessTokens))
+	handle("POST", "/tokens", authz.HandlerFunc(srv.CreateAccessToken))
+	handle("DELETE", "/tokens/{tokenID}", authz.HandlerFunc(srv.RevokeAccessToken))
+
+	handle("GET", "/webhooks", authz.HandlerFunc(srv.ListWebhooks))
+	handle("POST", "/webhooks", authz.HandlerFunc(srv.CreateWebhook))
+	handle("GET", "/webhooks/{webhookID}", authz.HandlerFunc(srv.GetWebhook))
+	handle("PUT", "/webhooks/{webhookID}", authz.HandlerFunc(srv.UpdateWebhook))
+	handle("DELETE", "/webhooks/{webhookID}", authz.HandlerFunc(srv.DeleteWebhook))
+	handle("GET", "/webhooks/{webhookID}/deliveries", authz.HandlerFunc(srv.ListWebhookDeliveries))
+
+	handle("GET", "/admin/cache/identities", authz.HandlerFunc(srv.IdentityCacheStats))
+	handle("DELETE", "/admin/cache/identities", authz.HandlerFunc(srv.FlushIdentityCache))
+
+	// Creating todos, including by importing them, requires membership in the resource creators.
+	creator := authz.Check(
+		gorillaz.WithObjectType(directory.ResourceCreatorObjectType),
+		gorillaz.WithRelation(directory.MemberRelation),
+		gorillaz.WithObjectID(directory.ResourceCreatorsObjectID),
+		gorillaz.WithPolicyPath("rebac.check"),
+	)
+
+	handle("POST", "/todos", creator.Handler(idempotent.Handler(http.HandlerFunc(srv.InsertTodo))))
+	handle("POST", "/todos/import", creator.HandlerFunc(srv.ImportTodos))
+
+	return root
+}
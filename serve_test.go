@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"todo-go/directory"
+	"todo-go/idempotency"
+	"todo-go/localauthz"
+	"todo-go/ratelimit"
+	"todo-go/server"
+	"todo-go/store"
+)
+
+// TestAppRouterMatchesAPISpec fails when the routes that AppRouter serves drift from the OpenAPI document.
+func TestAppRouterMatchesAPISpec(t *testing.T) {
+	// An empty config file keeps a local config.yaml out of the test.
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	flags := server.NewOptionFlags("serve")
+	if err := flags.Parse([]string{
+		"--config", config, "--authorizer-mode", server.ModeLocal, "--directory-mode", server.ModeMemory,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	options, err := server.LoadOptions(flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := store.NewMemoryStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, _ := directory.NewMemoryDirectory(options.IdentityCache)
+
+	srv := server.New(options, db, dir)
+	defer srv.Close()
+
+	// Requests aren't served, so authentication can be stubbed out.
+	authn := func(next http.Handler) http.Handler { return next }
+	authorizer := localauthz.New(dir, options.PolicyRoot)
+
+	router := AppRouter(
+		srv, authn, options.RouteScopes, AuthorizationMiddleware(authorizer, options),
+		todoAuthorizer(authorizer, options), feedAccess(authorizer, options),
+		idempotency.NewMiddleware(options.Idempotency, db), nil, nil,
+		ratelimit.NewMiddleware(options.RateLimit, ratelimit.NewMemoryLimiter()),
+	)
+
+	if err := server.CheckAPISpec(router); err != nil {
+		t.Fatal(err)
+	}
+
+	router.Handle(server.APIPrefix+"/undocumented", http.NotFoundHandler()).Methods("GET")
+	if err := server.CheckAPISpec(router); err == nil {
+		t.Error("an undocumented route wasn't reported")
+	}
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"todo-go/store"
+	"todo-go/validation"
+
+	"github.com/rs/zerolog/log"
+)
+
+// The types in this file are the API's contract. They are mapped to and from the store model so that storage
+// changes don't leak into it.
+
+// maxTitleLength is the most characters a title may have, whatever the caller's quota allows. It must match
+// the max rule on todoRequest.Title.
+const maxTitleLength = 1024
+
+// todoRequest is the body of requests that create or replace a todo. IDs and owners are assigned by the
+// server, so clients may not set them.
+type todoRequest struct {
+	ID        string `json:"id" validate:"absent"`
+	OwnerID   string `json:"ownerId" validate:"absent"`
+	Title     string `json:"title" validate:"required,max=1024"`
+	Completed bool   `json:"completed"`
+	// DueAt is an RFC 3339 time. Todos without it have no due date.
+	DueAt string `json:"dueAt" validate:"rfc3339"`
+}
+
+// toTodo returns the todo described by the request, changed now.
+func (req *todoRequest) toTodo(id, ownerID string) store.Todo {
+	return store.Todo{
+		ID:        id,
+		OwnerID:   ownerID,
+		Title:     req.Title,
+		Completed: req.Completed,
+		DueAt:     req.dueAt(),
+		UpdatedAt: time.Now().UTC(),
+	}
+}
+
+// dueAt returns the due date of a valid request in UTC, or nil if it has none.
+func (req *todoRequest) dueAt() *time.Time {
+	due, err := time.Parse(time.RFC3339, req.DueAt)
+	if err != nil {
+		return nil
+	}
+
+	due = due.UTC()
+
+	return &due
+}
+
+type todoResponse struct {
+	ID      string `json:"id"`
+	OwnerID string `json:"ownerId"`
+	// OwnerName is the owner's display name. It is omitted if the owner can't be found in the directory.
+	OwnerName   string          `json:"ownerName,omitempty"`
+	Title       string          `json:"title"`
+	Completed   bool            `json:"completed"`
+	DueAt       *time.Time      `json:"dueAt,omitempty"`
+	Permissions todoPermissions `json:"permissions"`
+}
+
+// todoPermissions tells clients which actions the caller may take on a todo, so they can hide the others.
+// They are decided by the policies of the routes that take the actions, which are still enforced on each
+// request.
+type todoPermissions struct {
+	Update bool `json:"update"`
+	Delete bool `json:"delete"`
+}
+
+// toTodoResponse maps a todo to its response, with the actions the caller may take on it.
+func toTodoResponse(todo *store.Todo, ownerName string, permissions todoPermissions) *todoResponse {
+	return &todoResponse{
+		ID:          todo.ID,
+		OwnerID:     todo.OwnerID,
+		OwnerName:   ownerName,
+		Title:       todo.Title,
+		Completed:   todo.Completed,
+		DueAt:       todo.DueAt,
+		Permissions: permissions,
+	}
+}
+
+// todoResponses maps todos to responses for the caller, looking up each owner once.
+func (s *Server) todoResponses(ctx context.Context, todos []store.Todo) []*todoResponse {
+	permissions := s.todoPermissions(ctx, todos)
+
+	names := map[string]string{}
+	responses := make([]*todoResponse, len(todos))
+
+	for i := range todos {
+		name, ok := names[todos[i].OwnerID]
+		if !ok {
+			name = s.ownerName(ctx, todos[i].OwnerID)
+			names[todos[i].OwnerID] = name
+		}
+
+		responses[i] = toTodoResponse(&todos[i], name, permissions[i])
+	}
+
+	return responses
+}
+
+// todoResponse maps a todo to a response for the caller.
+func (s *Server) todoResponse(ctx context.Context, todo *store.Todo) *todoResponse {
+	return s.todoResponses(ctx, []store.Todo{*todo})[0]
+}
+
+// todoPermissions asks AuthorizeTodo, concurrently, whether the caller may update and delete each todo.
+// Permissions are only hints, so a failed decision denies the action instead of failing the request.
+func (s *Server) todoPermissions(ctx context.Context, todos []store.Todo) []todoPermissions {
+	permissions := make([]todoPermissions, len(todos))
+	if s.AuthorizeTodo == nil {
+		return permissions
+	}
+
+	allowed := func(action TodoAction, id string) bool {
+		ok, err := s.AuthorizeTodo(ctx, action, id)
+		if err != nil {
+			log.Err(err).Str("id", id).Str("action", string(action)).Msg("failed to decide todo permission")
+		}
+
+		return ok && err == nil
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, batchAuthzConcurrency)
+
+	for i := range todos {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-slots; wg.Done() }()
+
+			permissions[i] = todoPermissions{
+				Update: allowed(TodoUpdate, todos[i].ID),
+				Delete: allowed(TodoDelete, todos[i].ID),
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return permissions
+}
+
+// ownerName returns the display name of the user with the given ID, or "" if it can't be resolved.
+func (s *Server) ownerName(ctx context.Context, userID string) string {
+	user, err := s.Directory.GetUser(ctx, userID)
+	if err != nil {
+		return ""
+	}
+
+	return user.DisplayName
+}
+
+// limitBody caps the size of request bodies. Handlers that read past the limit get an error that
+// validation.WriteError reports with 413.
+func limitBody(maxBytes int, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// decodeRequest decodes and validates the body of r into dst. On failure it writes the error response and
+// returns false.
+func decodeRequest(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	if err := validation.Decode(r, dst); err != nil {
+		validation.WriteError(w, err)
+		return false
+	}
+
+	return true
+}
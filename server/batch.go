@@ -0,0 +1,388 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"todo-go/events"
+	"todo-go/store"
+	"todo-go/validation"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// batchAuthzConcurrency is the number of operations in a batch that are authorized at the same time.
+const batchAuthzConcurrency = 8
+
+// TodoAction is an operation on a todo.
+type TodoAction string
+
+const (
+	TodoCreate TodoAction = "create"
+	TodoUpdate TodoAction = "update"
+	TodoDelete TodoAction = "delete"
+	// TodoRead isn't a batch operation. It decides which todo events a caller receives.
+	TodoRead TodoAction = "read"
+)
+
+// TodoAuthorizer reports whether the caller may perform an action on the todo with the given ID, under the
+// policy of the route that performs the action on its own. The ID is empty for creates.
+type TodoAuthorizer func(ctx context.Context, action TodoAction, id string) (bool, error)
+
+var (
+	// errNotAuthorized is returned for operations in a batch that the caller may not perform.
+	errNotAuthorized = errors.New("not authorized")
+	// errDuplicateOperation is returned when a batch changes the same todo more than once.
+	errDuplicateOperation = errors.New("the todo is changed by an earlier operation in the batch")
+)
+
+type batchRequest struct {
+	Operations []batchOperation `json:"operations" validate:"required,max=100"`
+}
+
+type batchOperation struct {
+	Op string `json:"op" validate:"required,oneof=create update delete"`
+	// ID is the todo to update or delete.
+	ID string `json:"id"`
+	// Todo is the todo to create, or the new title, completion and due date of the todo to update.
+	Todo *todoRequest `json:"todo"`
+}
+
+// validate checks that the operation has the fields its action requires. Problems with the todo are reported
+// with a "todo." prefix.
+func (op *batchOperation) validate() error {
+	if err := validation.Struct(op); err != nil {
+		return err
+	}
+
+	action := TodoAction(op.Op)
+
+	var problems []validation.FieldError
+
+	switch {
+	case action == TodoCreate && op.ID != "":
+		problems = append(problems, validation.FieldError{Field: "id", Code: "read_only", Message: "id is assigned by the server"})
+	case action != TodoCreate && strings.TrimSpace(op.ID) == "":
+		problems = append(problems, validation.FieldError{Field: "id", Code: "required", Message: "id is required"})
+	}
+
+	switch {
+	case action == TodoDelete && op.Todo != nil:
+		problems = append(problems, validation.FieldError{Field: "todo", Code: "absent", Message: "todo must be omitted from deletes"})
+	case action != TodoDelete && op.Todo == nil:
+		problems = append(problems, validation.FieldError{Field: "todo", Code: "required", Message: "todo is required"})
+	case op.Todo != nil:
+		var invalid *validation.Error
+		if errors.As(validation.Struct(op.Todo), &invalid) {
+			for _, problem := range invalid.Fields {
+				problem.Field = "todo." + problem.Field
+				problems = append(problems, problem)
+			}
+		}
+	}
+
+	return validation.Fields(problems...)
+}
+
+type batchResponse struct {
+	Results   []*batchResult `json:"results"`
+	Succeeded int            `json:"succeeded"`
+	Failed    int            `json:"failed"`
+}
+
+// batchResult is the outcome of an operation in a batch.
+type batchResult struct {
+	Index int    `json:"index"`
+	Op    string `json:"op"`
+	ID    string `json:"id,omitempty"`
+	itemStatus
+	// Todo is the created or updated todo.
+	Todo *todoResponse `json:"todo,omitempty"`
+}
+
+// itemStatus reports the outcome of an item in a bulk request, such as a batch or an import.
+type itemStatus struct {
+	// Status is the HTTP status that the item would have had as a request of its own.
+	Status int                     `json:"status"`
+	Error  string                  `json:"error,omitempty"`
+	Fields []validation.FieldError `json:"fields,omitempty"`
+}
+
+func (i *itemStatus) fail(err error) {
+	i.Status = httpStatus(err)
+	i.Error = err.Error()
+
+	var invalid *validation.Error
+	if errors.As(err, &invalid) {
+		i.Error = "validation failed"
+		i.Fields = invalid.Fields
+	}
+}
+
+// failed reports whether the item has failed. Items that haven't failed yet have no status.
+func (i *itemStatus) failed() bool {
+	return i.Status != 0
+}
+
+// BatchTodos returns a handler that creates, updates and deletes todos in bulk. Each operation is authorized
+// by authorize, like the request that would perform it on its own, and reported with its own status.
+// Operations that fail are skipped. The others are saved in a single transaction, and written to the directory.
+func (s *Server) BatchTodos(authorize TodoAuthorizer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req batchRequest
+		if !decodeRequest(w, r, &req) {
+			return
+		}
+
+		resp, err := s.batchTodos(r.Context(), authorize, req.Operations)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+}
+
+// batchTodos applies the operations that are valid and authorized, within the caller's quotas.
+func (s *Server) batchTodos(ctx context.Context, authorize TodoAuthorizer, ops []batchOperation) (*batchResponse, error) {
+	caller, user, err := s.callerUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := s.quotaFor(ctx, caller, user)
+
+	results := make([]*batchResult, len(ops))
+	changed := map[string]bool{}
+
+	for i := range ops {
+		op := &ops[i]
+		result := &batchResult{Index: i, Op: op.Op, ID: op.ID}
+		results[i] = result
+
+		if err := op.validate(); err != nil {
+			result.fail(err)
+			continue
+		}
+
+		if op.Todo != nil {
+			if err := checkTitle(limits, op.Todo.Title); err != nil {
+				result.fail(err)
+				continue
+			}
+		}
+
+		if op.ID != "" {
+			if changed[op.ID] {
+				result.fail(errDuplicateOperation)
+				continue
+			}
+
+			changed[op.ID] = true
+		}
+	}
+
+	if err := authorizeBatch(ctx, authorize, ops, results); err != nil {
+		return nil, err
+	}
+
+	count, err := s.Store.CountTodos(user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	// The store checks the quota again when it applies the batch, in case todos were created meanwhile.
+	batch := store.TodoBatch{MaxTodos: limits.MaxTodos}
+
+	// The previous state of updated todos, to tell when they are completed.
+	previous := map[string]*store.Todo{}
+
+	for i := range ops {
+		op, result := &ops[i], results[i]
+		if result.failed() {
+			continue
+		}
+
+		if TodoAction(op.Op) == TodoCreate {
+			if !limits.TodosLeft(count) {
+				result.fail(&quotaError{limit: limits.MaxTodos})
+				continue
+			}
+
+			count++
+
+			todo := op.Todo.toTodo(uuid.New().String(), user.Id)
+			result.ID = todo.ID
+			batch.Inserts = append(batch.Inserts, todo)
+
+			continue
+		}
+
+		existing, err := s.Store.GetTodo(op.ID)
+		switch {
+		case err != nil:
+			return nil, err
+		case existing == nil:
+			result.fail(errTodoNotFound)
+			continue
+		}
+
+		if TodoAction(op.Op) == TodoUpdate {
+			previous[op.ID] = existing
+			batch.Updates = append(batch.Updates, op.Todo.toTodo(op.ID, existing.OwnerID))
+		} else {
+			batch.Deletes = append(batch.Deletes, op.ID)
+		}
+	}
+
+	if err := s.Store.ApplyTodoBatch(&batch); err != nil {
+		return nil, storeQuotaError(err, limits.MaxTodos)
+	}
+
+	added := make([]*store.Todo, len(batch.Inserts))
+	for i := range batch.Inserts {
+		added[i] = &batch.Inserts[i]
+	}
+
+	if err := s.Directory.WriteTodos(ctx, added, batch.Deletes); err != nil {
+		log.Warn().Err(err).Str("owner", user.Id).Msg("failed to write batch to the directory, retrying each change")
+		s.writeBatchTodos(ctx, results, &batch)
+	}
+
+	return s.batchResponse(ctx, results, &batch, previous), nil
+}
+
+// writeBatchTodos makes the directory changes of a saved batch one at a time, after making them together
+// failed, and fails the operations whose change still fails. Todos that can't be added to the directory are
+// removed from the store again, so that no todo is left without an owner.
+func (s *Server) writeBatchTodos(ctx context.Context, results []*batchResult, batch *store.TodoBatch) {
+	inserted := map[string]store.Todo{}
+	for _, todo := range batch.Inserts {
+		inserted[todo.ID] = todo
+	}
+
+	for _, result := range results {
+		if result.failed() {
+			continue
+		}
+
+		switch TodoAction(result.Op) {
+		case TodoCreate:
+			todo := inserted[result.ID]
+			if err := s.Directory.AddTodo(ctx, &todo); err != nil {
+				if err := s.Store.DeleteTodo(todo.ID); err != nil {
+					log.Err(err).Str("id", todo.ID).Msg("failed to remove todo that isn't in the directory")
+				}
+
+				delete(inserted, todo.ID)
+				result.ID = ""
+				result.fail(errors.Wrap(err, "the todo wasn't created, because the directory wasn't updated"))
+			}
+		case TodoDelete:
+			if err := s.Directory.DeleteTodo(ctx, result.ID); err != nil {
+				result.fail(errors.Wrap(err, "the todo was deleted, but the directory wasn't updated"))
+			}
+		}
+	}
+
+	inserts := batch.Inserts[:0]
+	for _, todo := range batch.Inserts {
+		if _, ok := inserted[todo.ID]; ok {
+			inserts = append(inserts, todo)
+		}
+	}
+
+	batch.Inserts = inserts
+}
+
+// authorizeBatch authorizes the operations that haven't failed yet, concurrently, and fails those that the
+// caller may not perform. The authorizer has no call for several decisions, but repeated ones are cached.
+func authorizeBatch(ctx context.Context, authorize TodoAuthorizer, ops []batchOperation, results []*batchResult) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+
+	slots := make(chan struct{}, batchAuthzConcurrency)
+
+	for i := range ops {
+		if results[i].failed() {
+			continue
+		}
+
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-slots; wg.Done() }()
+
+			allowed, err := authorize(ctx, TodoAction(ops[i].Op), ops[i].ID)
+			switch {
+			case err != nil:
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			case !allowed:
+				results[i].fail(errNotAuthorized)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return firstErr
+}
+
+// batchResponse completes the results of the operations that were applied and publishes their events.
+func (s *Server) batchResponse(
+	ctx context.Context, results []*batchResult, batch *store.TodoBatch, previous map[string]*store.Todo,
+) *batchResponse {
+	saved := append(append([]store.Todo{}, batch.Inserts...), batch.Updates...)
+	todos := s.todoResponses(ctx, saved)
+
+	byID := map[string]*todoResponse{}
+	for _, todo := range todos {
+		byID[todo.ID] = todo
+	}
+
+	resp := &batchResponse{Results: results}
+
+	for _, result := range results {
+		if result.failed() {
+			resp.Failed++
+			continue
+		}
+
+		resp.Succeeded++
+		result.Status = http.StatusOK
+
+		switch TodoAction(result.Op) {
+		case TodoCreate:
+			result.Todo = byID[result.ID]
+			s.publish(events.TodoCreated, result.ID, toTodoEvent(result.Todo))
+		case TodoUpdate:
+			result.Todo = byID[result.ID]
+			s.publish(events.TodoUpdated, result.ID, toTodoEvent(result.Todo))
+
+			if result.Todo.Completed && !previous[result.ID].Completed {
+				s.publish(events.TodoCompleted, result.ID, toTodoEvent(result.Todo))
+			}
+		case TodoDelete:
+			s.publish(events.TodoDeleted, result.ID, map[string]string{"id": result.ID})
+		}
+	}
+
+	return resp
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"todo-go/store"
+
+	"github.com/pkg/errors"
+)
+
+// failingDirectory fails to write batches, and to add the todos whose titles are in failTitles.
+type failingDirectory struct {
+	Directory
+	failTitles map[string]bool
+}
+
+func (d *failingDirectory) WriteTodos(context.Context, []*store.Todo, []string) error {
+	return errors.New("import failed")
+}
+
+func (d *failingDirectory) AddTodo(ctx context.Context, todo *store.Todo) error {
+	if d.failTitles[todo.Title] {
+		return errors.New("set relation failed")
+	}
+
+	return d.Directory.AddTodo(ctx, todo)
+}
+
+func allowAll(context.Context, TodoAction, string) (bool, error) {
+	return true, nil
+}
+
+func TestBatchDirectoryFailure(t *testing.T) {
+	srv := newTestServer(t)
+	srv.Directory = &failingDirectory{Directory: srv.Directory, failTitles: map[string]bool{"Lost": true}}
+
+	body := `{"operations": [{"op": "create", "todo": {"title": "Saved"}}, {"op": "create", "todo": {"title": "Lost"}}]}`
+
+	w := serve(srv.BatchTodos(allowAll), rick, "POST", "/v1/todos:batch", body, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("batch: got status %d: %s", w.Code, w.Body.String())
+	}
+
+	resp := decode[*batchResponse](t, w)
+
+	switch saved, lost := resp.Results[0], resp.Results[1]; {
+	case resp.Succeeded != 1 || resp.Failed != 1:
+		t.Errorf("got %d succeeded and %d failed, want 1 each", resp.Succeeded, resp.Failed)
+	case saved.Status != http.StatusOK || saved.Todo == nil || saved.Todo.OwnerID != rick:
+		t.Errorf("got saved result %+v, want the created todo", saved)
+	case lost.Status != http.StatusInternalServerError || lost.ID != "" || lost.Todo != nil:
+		t.Errorf("got lost result %+v, want status 500 without a todo", lost)
+	}
+
+	todos := listTestTodos(t, srv, rick)
+	if len(todos) != 1 || todos[0].Title != "Saved" || !todos[0].Permissions.Delete {
+		t.Errorf("got todos %+v, want only the one in the directory", todos)
+	}
+}
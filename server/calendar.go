@@ -0,0 +1,299 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"todo-go/ical"
+	"todo-go/identity"
+	"todo-go/pat"
+	"todo-go/store"
+	"todo-go/validation"
+
+	"github.com/rs/zerolog/log"
+)
+
+// CalendarPath is the path of calendar feeds under APIPrefix. Calendar apps can't send bearer tokens, so
+// feeds are authenticated by the feed token in their URL instead.
+const CalendarPath = "/calendar.ics"
+
+const (
+	// calendarRefresh asks calendar apps to refresh feeds every 15 minutes.
+	calendarRefresh = "PT15M"
+	// calendarUIDDomain makes the UIDs of todos in feeds globally unique.
+	calendarUIDDomain = "todo-go"
+)
+
+// Kinds of calendar components that todos are written as.
+const (
+	calendarEvents = "event"
+	calendarTodos  = "todo"
+)
+
+// FeedAccessCheck reports whether the owner of a calendar feed, identified by their subject, may list todos.
+type FeedAccessCheck func(ctx context.Context, subject string) (bool, error)
+
+type calendarFeedResponse struct {
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	// Token and URL are only returned when the feed is created.
+	Token string `json:"token,omitempty"`
+	URL   string `json:"url,omitempty"`
+}
+
+// CreateCalendarFeed creates the caller's calendar feed and returns its URL, which holds a secret feed token.
+// The token is returned once and only its hash is stored. If the caller already has a feed, its token is
+// replaced and the previous URL stops working.
+func (s *Server) CreateCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	subject := identity.ExtractSubject(r.Context())
+	if subject == "" {
+		http.Error(w, "context does not contain a subject value", http.StatusExpectationFailed)
+		return
+	}
+
+	secret, hash, err := pat.GenerateFeed()
+	if err != nil {
+		log.Err(err).Msg("failed to generate calendar feed token")
+		http.Error(w, "failed to generate calendar feed token", http.StatusInternalServerError)
+		return
+	}
+
+	feed := &store.CalendarFeed{Subject: subject, Hash: hash, CreatedAt: time.Now().UTC()}
+	if err := s.Store.SetCalendarFeed(feed); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Info().Str("subject", subject).Msg("calendar feed created")
+
+	resp := &calendarFeedResponse{CreatedAt: feed.CreatedAt, Token: secret, URL: calendarURL(r, secret)}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
+// GetCalendarFeed tells the caller whether they have a calendar feed, and when it was created and last used.
+func (s *Server) GetCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	subject := identity.ExtractSubject(r.Context())
+	if subject == "" {
+		http.Error(w, "context does not contain a subject value", http.StatusExpectationFailed)
+		return
+	}
+
+	feed, err := s.Store.GetCalendarFeed(subject)
+	switch {
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case feed == nil:
+		http.Error(w, "calendar feed not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&calendarFeedResponse{CreatedAt: feed.CreatedAt, LastUsedAt: feed.LastUsedAt}); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
+// DeleteCalendarFeed deletes the caller's calendar feed, which revokes its token.
+func (s *Server) DeleteCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	subject := identity.ExtractSubject(r.Context())
+	if subject == "" {
+		http.Error(w, "context does not contain a subject value", http.StatusExpectationFailed)
+		return
+	}
+
+	deleted, err := s.Store.DeleteCalendarFeed(subject)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !deleted {
+		http.Error(w, "calendar feed not found", http.StatusNotFound)
+		return
+	}
+
+	log.Info().Str("subject", subject).Msg("calendar feed deleted")
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// ServeCalendar returns a handler that serves the calendar feed whose token is in the token query parameter.
+// The feed lists the todos with due dates that its owner owns or that were shared with them, as events at
+// their due dates or, with kind=todo, as tasks. Todos keep their UID, and their SEQUENCE grows with each
+// update, so calendar apps update them in place. Feeds are only served while access allows their owner to
+// list todos.
+func (s *Server) ServeCalendar(access FeedAccessCheck) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		feed, err := s.Store.GetCalendarFeedByHash(pat.Hash(query.Get("token")))
+		switch {
+		case err != nil:
+			log.Err(err).Msg("failed to look up calendar feed")
+			http.Error(w, "failed to look up calendar feed", http.StatusInternalServerError)
+			return
+		case feed == nil:
+			http.Error(w, "invalid calendar feed token", http.StatusUnauthorized)
+			return
+		}
+
+		kind := query.Get("kind")
+		switch kind {
+		case "":
+			kind = calendarEvents
+		case calendarEvents, calendarTodos:
+		default:
+			validation.WriteError(w, validation.Fields(validation.FieldError{
+				Field:   "kind",
+				Code:    "oneof",
+				Message: fmt.Sprintf("kind must be one of %s, %s, not [%s]", calendarEvents, calendarTodos, kind),
+			}))
+			return
+		}
+
+		allowed, err := access(r.Context(), feed.Subject)
+		switch {
+		case err != nil:
+			log.Err(err).Str("subject", feed.Subject).Msg("failed to authorize calendar feed")
+			http.Error(w, "failed to authorize calendar feed", http.StatusInternalServerError)
+			return
+		case !allowed:
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		todos, err := s.calendarTodos(r.Context(), feed.Subject)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := writeCalendar(&buf, todos, kind); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := s.Store.TouchCalendarFeed(feed.Subject, time.Now().UTC()); err != nil {
+			log.Warn().Err(err).Str("subject", feed.Subject).Msg("failed to record calendar feed use")
+		}
+
+		w.Header().Add("Content-Type", "text/calendar; charset=utf-8")
+		w.Header().Add("Content-Disposition", `inline; filename="todos.ics"`)
+		w.Header().Add("Cache-Control", "private, no-cache")
+		_, _ = w.Write(buf.Bytes())
+	}
+}
+
+// calendarTodos returns the todos with due dates that the user with the given subject owns, including those
+// shared with them, by due date.
+func (s *Server) calendarTodos(ctx context.Context, subject string) ([]store.Todo, error) {
+	user, err := s.Directory.UserFromIdentity(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	owned, err := s.Directory.OwnedTodoIDs(ctx, user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	todos, err := s.Store.GetTodos()
+	if err != nil {
+		return nil, err
+	}
+
+	var due []store.Todo
+	for _, todo := range todos {
+		if todo.DueAt != nil && owned[todo.ID] {
+			due = append(due, todo)
+		}
+	}
+
+	sort.SliceStable(due, func(i, j int) bool { return due[i].DueAt.Before(*due[j].DueAt) })
+
+	return due, nil
+}
+
+// writeCalendar writes todos as the events or tasks of an iCalendar document.
+func writeCalendar(w io.Writer, todos []store.Todo, kind string) error {
+	cal := ical.NewWriter(w)
+
+	cal.Begin("VCALENDAR")
+	cal.Property("VERSION", "2.0")
+	cal.Property("PRODID", "-//todo-go//Todos//EN")
+	cal.Property("CALSCALE", "GREGORIAN")
+	cal.Text("NAME", "Todos")
+	cal.Text("X-WR-CALNAME", "Todos")
+	cal.Property("REFRESH-INTERVAL;VALUE=DURATION", calendarRefresh)
+	cal.Property("X-PUBLISHED-TTL", calendarRefresh)
+
+	component := "VEVENT"
+	if kind == calendarTodos {
+		component = "VTODO"
+	}
+
+	for i := range todos {
+		todo := &todos[i]
+
+		cal.Begin(component)
+		cal.Text("UID", todo.ID+"@"+calendarUIDDomain)
+		cal.Property("SEQUENCE", strconv.Itoa(todo.Sequence))
+		cal.Time("DTSTAMP", todo.UpdatedAt)
+		cal.Time("LAST-MODIFIED", todo.UpdatedAt)
+		cal.Text("SUMMARY", todo.Title)
+
+		if kind == calendarTodos {
+			cal.Time("DUE", *todo.DueAt)
+
+			status := "NEEDS-ACTION"
+			if todo.Completed {
+				status = "COMPLETED"
+			}
+
+			cal.Property("STATUS", status)
+		} else {
+			// Events without an end end when they start. They don't make their owner busy.
+			cal.Time("DTSTART", *todo.DueAt)
+			cal.Property("TRANSP", "TRANSPARENT")
+		}
+
+		cal.End(component)
+	}
+
+	cal.End("VCALENDAR")
+
+	return cal.Flush()
+}
+
+// calendarURL returns the URL of the calendar feed with the given token, on the host that r was sent to.
+func calendarURL(r *http.Request, token string) string {
+	u := url.URL{
+		Scheme:   "http",
+		Host:     r.Host,
+		Path:     APIPrefix + CalendarPath,
+		RawQuery: url.Values{"token": {token}}.Encode(),
+	}
+
+	if r.TLS != nil {
+		u.Scheme = "https"
+	}
+
+	return u.String()
+}
@@ -0,0 +1,694 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"todo-go/cors"
+	"todo-go/decisioncache"
+	"todo-go/decisionlog"
+	"todo-go/devauth"
+	"todo-go/directory"
+	"todo-go/events"
+	"todo-go/idempotency"
+	"todo-go/identity"
+	"todo-go/quota"
+	"todo-go/ratelimit"
+	"todo-go/session"
+	"todo-go/webhooks"
+
+	"github.com/aserto-dev/go-aserto"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
+)
+
+// configFile is the YAML representation of Options.
+type configFile struct {
+	Authorizer    serviceConfig       `yaml:"authorizer"`
+	Directory     serviceConfig       `yaml:"directory"`
+	Policy        policyConfig        `yaml:"policy"`
+	OIDC          oidcConfig          `yaml:"oidc"`
+	RouteScopes   map[string][]string `yaml:"route_scopes"`
+	DecisionLog   decisionLogConfig   `yaml:"decision_log"`
+	DecisionCache decisionCacheConfig `yaml:"decision_cache"`
+	IdentityCache identityCacheConfig `yaml:"identity_cache"`
+	DevAuth       devAuthConfig       `yaml:"dev_auth"`
+	Session       sessionConfig       `yaml:"session"`
+	CORS          corsConfig          `yaml:"cors"`
+	RateLimit     rateLimitConfig     `yaml:"rate_limit"`
+	Quota         quotaConfig         `yaml:"quota"`
+	Events        eventsConfig        `yaml:"events"`
+	Webhooks      webhooksConfig      `yaml:"webhooks"`
+	Idempotency   idempotencyConfig   `yaml:"idempotency"`
+	MaxBodyBytes  int                 `yaml:"max_body_bytes"`
+	GRPC          grpcConfig          `yaml:"grpc"`
+	LogLevel      string              `yaml:"log_level"`
+}
+
+type serviceConfig struct {
+	Mode       string `yaml:"mode"`
+	Address    string `yaml:"address"`
+	APIKey     string `yaml:"api_key,omitempty"`
+	Token      string `yaml:"token,omitempty"`
+	TenantID   string `yaml:"tenant_id,omitempty"`
+	CACertPath string `yaml:"ca_cert_path,omitempty"`
+	Insecure   bool   `yaml:"insecure,omitempty"`
+	NoTLS      bool   `yaml:"no_tls,omitempty"`
+}
+
+type policyConfig struct {
+	Name string `yaml:"name"`
+	Root string `yaml:"root"`
+}
+
+type oidcConfig struct {
+	Issuer   string             `yaml:"issuer"`
+	Audience string             `yaml:"audience"`
+	JwksURL  string             `yaml:"jwks_url"`
+	Claims   claimMappingConfig `yaml:"claims"`
+	// RequireScopes rejects tokens without a scope claim.
+	RequireScopes bool `yaml:"require_scopes"`
+}
+
+type claimMappingConfig struct {
+	Email  string `yaml:"email"`
+	Name   string `yaml:"name"`
+	Groups string `yaml:"groups"`
+	Roles  string `yaml:"roles"`
+	Scopes string `yaml:"scopes"`
+}
+
+type decisionLogConfig struct {
+	Sink           string `yaml:"sink"`
+	Path           string `yaml:"path,omitempty"`
+	URL            string `yaml:"url,omitempty"`
+	IncludeAllowed bool   `yaml:"include_allowed"`
+}
+
+type decisionCacheConfig struct {
+	TTL        string `yaml:"ttl"`
+	MaxEntries int    `yaml:"max_entries"`
+}
+
+type identityCacheConfig struct {
+	Size        int    `yaml:"size"`
+	TTL         string `yaml:"ttl"`
+	NegativeTTL string `yaml:"negative_ttl"`
+}
+
+type devAuthConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	KeyPath  string `yaml:"key_path"`
+	TokenTTL string `yaml:"token_ttl"`
+}
+
+type sessionConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	AuthorizeURL  string `yaml:"authorize_url"`
+	TokenURL      string `yaml:"token_url"`
+	EndSessionURL string `yaml:"end_session_url,omitempty"`
+	ClientID      string `yaml:"client_id"`
+	ClientSecret  string `yaml:"client_secret,omitempty"`
+	RedirectURL   string `yaml:"redirect_url"`
+	Scopes        string `yaml:"scopes"`
+	CookieName    string `yaml:"cookie_name"`
+	CookieSecure  bool   `yaml:"cookie_secure"`
+	TTL           string `yaml:"ttl"`
+	SecretKey     string `yaml:"secret_key,omitempty"`
+}
+
+type corsConfig struct {
+	AllowedOrigins   []string `yaml:"allowed_origins"`
+	AllowedMethods   []string `yaml:"allowed_methods"`
+	AllowedHeaders   []string `yaml:"allowed_headers"`
+	ExposedHeaders   []string `yaml:"exposed_headers"`
+	AllowCredentials bool     `yaml:"allow_credentials"`
+	MaxAge           string   `yaml:"max_age"`
+}
+
+type rateLimitConfig struct {
+	Enabled           bool              `yaml:"enabled"`
+	PerIP             string            `yaml:"per_ip"`
+	PerSubject        string            `yaml:"per_subject"`
+	Routes            map[string]string `yaml:"routes"`
+	TrustForwardedFor bool              `yaml:"trust_forwarded_for"`
+	ForwardedHops     int               `yaml:"forwarded_hops"`
+}
+
+type eventsConfig struct {
+	History          int    `yaml:"history"`
+	SubscriberBuffer int    `yaml:"subscriber_buffer"`
+	Heartbeat        string `yaml:"heartbeat"`
+}
+
+type webhooksConfig struct {
+	Timeout              string `yaml:"timeout"`
+	MaxAttempts          int    `yaml:"max_attempts"`
+	InitialBackoff       string `yaml:"initial_backoff"`
+	MaxBackoff           string `yaml:"max_backoff"`
+	DisableAfter         int    `yaml:"disable_after"`
+	AllowPrivateNetworks bool   `yaml:"allow_private_networks"`
+}
+
+type idempotencyConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	TTL     string `yaml:"ttl"`
+}
+
+type grpcConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	ListenAddress string `yaml:"listen_address"`
+}
+
+type quotaConfig struct {
+	MaxTodos       int `yaml:"max_todos"`
+	MaxTitleLength int `yaml:"max_title_length"`
+}
+
+// loadConfigFile overrides options with the values present in the YAML file at path.
+// Keys missing from the file leave the corresponding options unchanged, and so do invalid values, which are
+// returned as problems. It fails if the file can't be read or parsed at all.
+func loadConfigFile(path string, options *Options) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read config file [%s]", path)
+	}
+
+	cfg := toConfigFile(options)
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse config file [%s]", path)
+	}
+
+	return cfg.applyTo(options), nil
+}
+
+func toConfigFile(options *Options) *configFile {
+	return &configFile{
+		Authorizer: serviceConfig{
+			Mode:       options.AuthorizerMode,
+			Address:    options.Authorizer.Address,
+			APIKey:     options.Authorizer.APIKey,
+			Token:      options.Authorizer.Token,
+			TenantID:   options.Authorizer.TenantID,
+			CACertPath: options.Authorizer.CACertPath,
+			Insecure:   options.Authorizer.Insecure,
+			NoTLS:      options.Authorizer.NoTLS,
+		},
+		Directory: serviceConfig{
+			Mode:       options.DirectoryMode,
+			Address:    options.Directory.Address,
+			APIKey:     options.Directory.APIKey,
+			Token:      options.Directory.Token,
+			TenantID:   options.Directory.TenantID,
+			CACertPath: options.Directory.CACertPath,
+			Insecure:   options.Directory.Insecure,
+			NoTLS:      options.Directory.NoTLS,
+		},
+		Policy: policyConfig{
+			Name: options.PolicyName,
+			Root: options.PolicyRoot,
+		},
+		OIDC: oidcConfig{
+			Issuer:   options.OidcIssuer,
+			Audience: options.OidcAudience,
+			JwksURL:  options.OidcJwksURL,
+			Claims: claimMappingConfig{
+				Email:  options.OidcClaims.Email,
+				Name:   options.OidcClaims.Name,
+				Groups: options.OidcClaims.Groups,
+				Roles:  options.OidcClaims.Roles,
+				Scopes: options.OidcClaims.Scopes,
+			},
+			RequireScopes: options.OidcRequireScopes,
+		},
+		RouteScopes: copyRouteScopes(options.RouteScopes),
+		DecisionLog: decisionLogConfig{
+			Sink:           options.DecisionLog.Sink,
+			Path:           options.DecisionLog.Path,
+			URL:            options.DecisionLog.URL,
+			IncludeAllowed: options.DecisionLog.IncludeAllowed,
+		},
+		DecisionCache: decisionCacheConfig{
+			TTL:        options.DecisionCache.TTL.String(),
+			MaxEntries: options.DecisionCache.MaxEntries,
+		},
+		IdentityCache: identityCacheConfig{
+			Size:        options.IdentityCache.Size,
+			TTL:         options.IdentityCache.TTL.String(),
+			NegativeTTL: options.IdentityCache.NegativeTTL.String(),
+		},
+		DevAuth: devAuthConfig{
+			Enabled:  options.DevAuth.Enabled,
+			KeyPath:  options.DevAuth.KeyPath,
+			TokenTTL: options.DevAuth.TokenTTL.String(),
+		},
+		Session: sessionConfig{
+			Enabled:       options.Session.Enabled,
+			AuthorizeURL:  options.Session.AuthorizeURL,
+			TokenURL:      options.Session.TokenURL,
+			EndSessionURL: options.Session.EndSessionURL,
+			ClientID:      options.Session.ClientID,
+			ClientSecret:  options.Session.ClientSecret,
+			RedirectURL:   options.Session.RedirectURL,
+			Scopes:        options.Session.Scopes,
+			CookieName:    options.Session.CookieName,
+			CookieSecure:  options.Session.CookieSecure,
+			TTL:           options.Session.TTL.String(),
+			SecretKey:     options.Session.SecretKey,
+		},
+		CORS: corsConfig{
+			AllowedOrigins:   options.CORS.AllowedOrigins,
+			AllowedMethods:   options.CORS.AllowedMethods,
+			AllowedHeaders:   options.CORS.AllowedHeaders,
+			ExposedHeaders:   options.CORS.ExposedHeaders,
+			AllowCredentials: options.CORS.AllowCredentials,
+			MaxAge:           options.CORS.MaxAge.String(),
+		},
+		RateLimit: toRateLimitConfig(options.RateLimit),
+		Quota: quotaConfig{
+			MaxTodos:       options.Quota.MaxTodos,
+			MaxTitleLength: options.Quota.MaxTitleLength,
+		},
+		Events: eventsConfig{
+			History:          options.Events.History,
+			SubscriberBuffer: options.Events.SubscriberBuffer,
+			Heartbeat:        options.Events.Heartbeat.String(),
+		},
+		Webhooks: webhooksConfig{
+			Timeout:              options.Webhooks.Timeout.String(),
+			MaxAttempts:          options.Webhooks.MaxAttempts,
+			InitialBackoff:       options.Webhooks.InitialBackoff.String(),
+			MaxBackoff:           options.Webhooks.MaxBackoff.String(),
+			DisableAfter:         options.Webhooks.DisableAfter,
+			AllowPrivateNetworks: options.Webhooks.AllowPrivateNetworks,
+		},
+		Idempotency: idempotencyConfig{
+			Enabled: options.Idempotency.Enabled,
+			TTL:     options.Idempotency.TTL.String(),
+		},
+		MaxBodyBytes: options.MaxBodyBytes,
+		GRPC: grpcConfig{
+			Enabled:       options.GRPC.Enabled,
+			ListenAddress: options.GRPC.ListenAddress,
+		},
+		LogLevel: options.LogLevel.String(),
+	}
+}
+
+// copyRouteScopes copies scopes, so that routes set by the config file are added to a new map.
+func copyRouteScopes(scopes map[string][]string) map[string][]string {
+	routes := make(map[string][]string, len(scopes))
+	for route, required := range scopes {
+		routes[route] = required
+	}
+
+	return routes
+}
+
+func toRateLimitConfig(cfg *ratelimit.Config) rateLimitConfig {
+	routes := map[string]string{}
+	for route, limit := range cfg.Routes {
+		routes[route] = limit.String()
+	}
+
+	return rateLimitConfig{
+		Enabled:           cfg.Enabled,
+		PerIP:             cfg.PerIP.String(),
+		PerSubject:        cfg.PerSubject.String(),
+		Routes:            routes,
+		TrustForwardedFor: cfg.TrustForwardedFor,
+		ForwardedHops:     cfg.ForwardedHops,
+	}
+}
+
+// applyTo sets options from the config file and returns a problem for each value that can't be parsed.
+func (c *configFile) applyTo(options *Options) []string {
+	var problems []string
+
+	c.Authorizer.applyTo(options.Authorizer)
+	c.Directory.applyTo(options.Directory.Config)
+
+	options.AuthorizerMode = c.Authorizer.Mode
+	options.DirectoryMode = c.Directory.Mode
+
+	options.PolicyName = c.Policy.Name
+	options.PolicyRoot = c.Policy.Root
+
+	options.OidcIssuer = c.OIDC.Issuer
+	options.OidcAudience = c.OIDC.Audience
+	options.OidcJwksURL = c.OIDC.JwksURL
+	options.OidcClaims = &identity.ClaimMapping{
+		Email:  c.OIDC.Claims.Email,
+		Name:   c.OIDC.Claims.Name,
+		Groups: c.OIDC.Claims.Groups,
+		Roles:  c.OIDC.Claims.Roles,
+		Scopes: c.OIDC.Claims.Scopes,
+	}
+	options.OidcRequireScopes = c.OIDC.RequireScopes
+	options.RouteScopes = c.RouteScopes
+
+	options.DecisionLog = &decisionlog.Config{
+		Sink:           c.DecisionLog.Sink,
+		Path:           c.DecisionLog.Path,
+		URL:            c.DecisionLog.URL,
+		IncludeAllowed: c.DecisionLog.IncludeAllowed,
+	}
+
+	options.DecisionCache = &decisioncache.Config{
+		TTL:        parseDuration("decision_cache.ttl", c.DecisionCache.TTL, options.DecisionCache.TTL, &problems),
+		MaxEntries: c.DecisionCache.MaxEntries,
+	}
+
+	options.IdentityCache = &directory.IdentityCacheConfig{
+		Size: c.IdentityCache.Size,
+		TTL:  parseDuration("identity_cache.ttl", c.IdentityCache.TTL, options.IdentityCache.TTL, &problems),
+		NegativeTTL: parseDuration(
+			"identity_cache.negative_ttl", c.IdentityCache.NegativeTTL, options.IdentityCache.NegativeTTL, &problems,
+		),
+	}
+
+	options.DevAuth = &devauth.Config{
+		Enabled:  c.DevAuth.Enabled,
+		KeyPath:  c.DevAuth.KeyPath,
+		TokenTTL: parseDuration("dev_auth.token_ttl", c.DevAuth.TokenTTL, options.DevAuth.TokenTTL, &problems),
+	}
+
+	sessionTTL := parseDuration("session.ttl", c.Session.TTL, options.Session.TTL, &problems)
+
+	options.Session = &session.Config{
+		Enabled:       c.Session.Enabled,
+		AuthorizeURL:  c.Session.AuthorizeURL,
+		TokenURL:      c.Session.TokenURL,
+		EndSessionURL: c.Session.EndSessionURL,
+		ClientID:      c.Session.ClientID,
+		ClientSecret:  c.Session.ClientSecret,
+		RedirectURL:   c.Session.RedirectURL,
+		Scopes:        c.Session.Scopes,
+		CookieName:    c.Session.CookieName,
+		CookieSecure:  c.Session.CookieSecure,
+		TTL:           sessionTTL,
+		SecretKey:     c.Session.SecretKey,
+	}
+
+	maxAge := parseDuration("cors.max_age", c.CORS.MaxAge, options.CORS.MaxAge, &problems)
+
+	options.CORS = &cors.Config{
+		AllowedOrigins:   c.CORS.AllowedOrigins,
+		AllowedMethods:   c.CORS.AllowedMethods,
+		AllowedHeaders:   c.CORS.AllowedHeaders,
+		ExposedHeaders:   c.CORS.ExposedHeaders,
+		AllowCredentials: c.CORS.AllowCredentials,
+		MaxAge:           maxAge,
+	}
+
+	options.RateLimit = c.RateLimit.toConfig(&problems)
+
+	options.Quota = &quota.Config{MaxTodos: c.Quota.MaxTodos, MaxTitleLength: c.Quota.MaxTitleLength}
+
+	options.Events = &events.Config{
+		History:          c.Events.History,
+		SubscriberBuffer: c.Events.SubscriberBuffer,
+		Heartbeat:        parseDuration("events.heartbeat", c.Events.Heartbeat, options.Events.Heartbeat, &problems),
+	}
+
+	options.Webhooks = c.Webhooks.toConfig(options.Webhooks, &problems)
+
+	options.Idempotency = &idempotency.Config{
+		Enabled: c.Idempotency.Enabled,
+		TTL:     parseDuration("idempotency.ttl", c.Idempotency.TTL, options.Idempotency.TTL, &problems),
+	}
+
+	options.MaxBodyBytes = c.MaxBodyBytes
+	options.GRPC = &GRPCConfig{Enabled: c.GRPC.Enabled, ListenAddress: c.GRPC.ListenAddress}
+
+	if level, err := zerolog.ParseLevel(c.LogLevel); err != nil {
+		problems = append(problems, fmt.Sprintf("invalid log_level [%s] in config file", c.LogLevel))
+	} else {
+		options.LogLevel = level
+	}
+
+	return problems
+}
+
+// parseDuration returns the duration of a config file key, or fallback if value is invalid, in which case a
+// problem is added to problems.
+func parseDuration(key, value string, fallback time.Duration, problems *[]string) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		*problems = append(*problems, fmt.Sprintf("invalid %s [%s] in config file", key, value))
+		return fallback
+	}
+
+	return d
+}
+
+func (c *webhooksConfig) toConfig(fallback *webhooks.Config, problems *[]string) *webhooks.Config {
+	return &webhooks.Config{
+		Timeout:              parseDuration("webhooks.timeout", c.Timeout, fallback.Timeout, problems),
+		MaxAttempts:          c.MaxAttempts,
+		InitialBackoff:       parseDuration("webhooks.initial_backoff", c.InitialBackoff, fallback.InitialBackoff, problems),
+		MaxBackoff:           parseDuration("webhooks.max_backoff", c.MaxBackoff, fallback.MaxBackoff, problems),
+		DisableAfter:         c.DisableAfter,
+		AllowPrivateNetworks: c.AllowPrivateNetworks,
+	}
+}
+
+// toConfig returns the rate limits. Limits that can't be parsed are added to problems and left unlimited.
+func (c *rateLimitConfig) toConfig(problems *[]string) *ratelimit.Config {
+	parse := func(key, value string) ratelimit.Limit {
+		limit, err := ratelimit.ParseLimit(value)
+		if err != nil {
+			*problems = append(*problems, errors.Wrapf(err, "invalid %s in config file", key).Error())
+		}
+
+		return limit
+	}
+
+	routes := map[string]ratelimit.Limit{}
+	for route, value := range c.Routes {
+		routes[route] = parse("rate_limit.routes["+route+"]", value)
+	}
+
+	return &ratelimit.Config{
+		Enabled:           c.Enabled,
+		PerIP:             parse("rate_limit.per_ip", c.PerIP),
+		PerSubject:        parse("rate_limit.per_subject", c.PerSubject),
+		Routes:            routes,
+		TrustForwardedFor: c.TrustForwardedFor,
+		ForwardedHops:     c.ForwardedHops,
+	}
+}
+
+func (s *serviceConfig) applyTo(cfg *aserto.Config) {
+	cfg.Address = s.Address
+	cfg.APIKey = s.APIKey
+	cfg.Token = s.Token
+	cfg.TenantID = s.TenantID
+	cfg.CACertPath = s.CACertPath
+	cfg.Insecure = s.Insecure
+	cfg.NoTLS = s.NoTLS
+}
+
+// Validate checks the options for consistency and returns a ValidationError listing all problems found.
+func (o *Options) Validate() error {
+	var problems ValidationError
+
+	switch o.AuthorizerMode {
+	case ModeRemote:
+		if o.Authorizer.Address == "" {
+			problems = append(problems, "authorizer address is required")
+		}
+
+		problems = append(problems, validateCACert("authorizer", o.Authorizer.CACertPath)...)
+	case ModeLocal:
+	default:
+		problems = append(problems, fmt.Sprintf("authorizer mode [%s] must be %q or %q", o.AuthorizerMode, ModeRemote, ModeLocal))
+	}
+
+	switch o.DirectoryMode {
+	case ModeRemote:
+		if o.Directory.Address == "" {
+			problems = append(problems, "directory address is required")
+		}
+
+		problems = append(problems, validateCACert("directory", o.Directory.CACertPath)...)
+	case ModeMemory:
+	default:
+		problems = append(problems, fmt.Sprintf("directory mode [%s] must be %q or %q", o.DirectoryMode, ModeRemote, ModeMemory))
+	}
+
+	if o.Authorizer.APIKey != "" && o.Authorizer.TenantID == "" {
+		problems = append(problems, "tenant ID is required when an authorizer API key is set")
+	}
+
+	if o.PolicyRoot == "" {
+		problems = append(problems, "policy root is required")
+	}
+
+	if o.OidcIssuer == "" {
+		problems = append(problems, "OIDC issuer is required")
+	}
+
+	if o.OidcAudience == "" {
+		problems = append(problems, "OIDC audience is required")
+	}
+
+	if !isAbsoluteHTTPURL(o.OidcJwksURL) {
+		problems = append(problems, fmt.Sprintf("JWKS URL [%s] must be an absolute http(s) URL", o.OidcJwksURL))
+	}
+
+	problems = append(problems, validateRouteScopes(o.RouteScopes)...)
+
+	problems = append(problems, validateDecisionLog(o.DecisionLog)...)
+
+	if o.DecisionCache.TTL < 0 || o.DecisionCache.MaxEntries < 0 {
+		problems = append(problems, "decision cache TTL and max entries must not be negative")
+	}
+
+	if o.IdentityCache.Size < 0 || o.IdentityCache.TTL < 0 || o.IdentityCache.NegativeTTL < 0 {
+		problems = append(problems, "identity cache size and TTLs must not be negative")
+	}
+
+	if o.DevAuth.Enabled && (o.DevAuth.KeyPath == "" || o.DevAuth.TokenTTL <= 0) {
+		problems = append(problems, "development auth requires a key path and a positive token TTL")
+	}
+
+	if o.Quota.MaxTodos < 0 || o.Quota.MaxTitleLength < 0 {
+		problems = append(problems, "quotas must not be negative")
+	}
+
+	if o.Quota.MaxTitleLength > maxTitleLength {
+		problems = append(problems, fmt.Sprintf("quota max title length must not exceed %d", maxTitleLength))
+	}
+
+	if o.MaxBodyBytes <= 0 {
+		problems = append(problems, "max body bytes must be positive")
+	}
+
+	if o.GRPC.Enabled && o.GRPC.ListenAddress == "" {
+		problems = append(problems, "the gRPC API requires a listen address")
+	}
+
+	problems = append(problems, validateSession(o.Session)...)
+	problems = append(problems, o.CORS.Validate()...)
+	problems = append(problems, o.RateLimit.Validate()...)
+	problems = append(problems, o.Events.Validate()...)
+	problems = append(problems, o.Webhooks.Validate()...)
+	problems = append(problems, o.Idempotency.Validate()...)
+
+	if len(problems) > 0 {
+		return problems
+	}
+
+	return nil
+}
+
+func validateSession(cfg *session.Config) []string {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	var problems []string
+
+	for _, u := range []struct{ name, value string }{
+		{"authorize URL", cfg.AuthorizeURL},
+		{"token URL", cfg.TokenURL},
+		{"redirect URL", cfg.RedirectURL},
+	} {
+		if !isAbsoluteHTTPURL(u.value) {
+			problems = append(problems, fmt.Sprintf("session %s [%s] must be an absolute http(s) URL", u.name, u.value))
+		}
+	}
+
+	if cfg.ClientID == "" || cfg.CookieName == "" || cfg.TTL <= 0 {
+		problems = append(problems, "session requires a client ID, a cookie name and a positive TTL")
+	}
+
+	if cfg.SecretKey != "" {
+		if _, err := session.DecodeKey(cfg.SecretKey); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	return problems
+}
+
+func isAbsoluteHTTPURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && u.Host != "" && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+// validateRouteScopes checks that route scopes are set for documented API operations and only use known
+// scopes.
+func validateRouteScopes(routes map[string][]string) []string {
+	operations, err := specOperations()
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	var problems []string
+	for route, scopes := range routes {
+		method, path, _ := strings.Cut(route, " ")
+		if path, ok := strings.CutPrefix(path, APIPrefix); !ok || !operations[method+" "+path] {
+			problems = append(problems, fmt.Sprintf("route scopes are set for [%s], which isn't an API route", route))
+		}
+
+		for _, scope := range scopes {
+			if !identity.IsKnownScope(scope) {
+				problems = append(problems, fmt.Sprintf("route [%s] requires unknown scope [%s]", route, scope))
+			}
+		}
+	}
+
+	sort.Strings(problems)
+
+	return problems
+}
+
+func validateDecisionLog(cfg *decisionlog.Config) []string {
+	switch cfg.Sink {
+	case decisionlog.SinkNone, decisionlog.SinkLog:
+	case decisionlog.SinkJSONL:
+		if cfg.Path == "" {
+			return []string{"decision log path is required for the jsonl sink"}
+		}
+	case decisionlog.SinkWebhook:
+		if u, err := url.Parse(cfg.URL); err != nil || u.Host == "" {
+			return []string{fmt.Sprintf("decision log URL [%s] must be an absolute URL for the webhook sink", cfg.URL)}
+		}
+	default:
+		return []string{fmt.Sprintf("unknown decision log sink [%s]", cfg.Sink)}
+	}
+
+	return nil
+}
+
+func validateCACert(service, path string) []string {
+	if path == "" {
+		return nil
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return []string{fmt.Sprintf("%s CA certificate [%s] is not readable: %s", service, path, err)}
+	}
+
+	return nil
+}
+
+// Print writes the options to w in config file format with secrets redacted.
+func (o *Options) Print(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+
+	if err := enc.Encode(toConfigFile(o.Redacted())); err != nil {
+		return errors.Wrap(err, "failed to encode options")
+	}
+
+	return enc.Close()
+}
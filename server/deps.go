@@ -0,0 +1,32 @@
+package server
+
+import (
+	"context"
+
+	"todo-go/directory"
+	"todo-go/store"
+
+	dsc "github.com/aserto-dev/go-directory/aserto/directory/common/v3"
+)
+
+// Directory is the set of directory operations the server depends on.
+// It is implemented by *directory.Directory, which can be backed by a remote directory or by directory.Memory.
+type Directory interface {
+	GetUser(ctx context.Context, userID string) (*dsc.Object, error)
+	UserFromIdentity(ctx context.Context, identity string) (*dsc.Object, error)
+	GetGroup(ctx context.Context, groupID string) (*dsc.Object, error)
+
+	AddTodo(ctx context.Context, todo *store.Todo) error
+	DeleteTodo(ctx context.Context, id string) error
+	ShareTodo(ctx context.Context, id, userID string) error
+	WriteTodos(ctx context.Context, added []*store.Todo, deleted []string) error
+	OwnedTodoIDs(ctx context.Context, userID string) (map[string]bool, error)
+
+	ObserveRelations(observer directory.RelationObserver)
+	IdentityCacheStats() directory.IdentityCacheStats
+	FlushIdentityCache() int
+
+	Close() error
+}
+
+var _ Directory = (*directory.Directory)(nil)
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"todo-go/events"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// eventRetry tells clients how long to wait before reconnecting, in milliseconds.
+	eventRetry = 3000
+	// eventWriteTimeout bounds each write to an event stream, so that clients that stop reading are dropped.
+	eventWriteTimeout = 10 * time.Second
+)
+
+// todoEvent is the payload of todo.created, todo.updated and todo.completed events. todo.deleted events only
+// carry the ID.
+type todoEvent struct {
+	ID        string     `json:"id"`
+	OwnerID   string     `json:"ownerId"`
+	OwnerName string     `json:"ownerName,omitempty"`
+	Title     string     `json:"title"`
+	Completed bool       `json:"completed"`
+	DueAt     *time.Time `json:"dueAt,omitempty"`
+}
+
+func toTodoEvent(todo *todoResponse) *todoEvent {
+	return &todoEvent{
+		ID:        todo.ID,
+		OwnerID:   todo.OwnerID,
+		OwnerName: todo.OwnerName,
+		Title:     todo.Title,
+		Completed: todo.Completed,
+		DueAt:     todo.DueAt,
+	}
+}
+
+// publish publishes an event about the todo with the given ID. Failures are logged, since the change has
+// already been made.
+func (s *Server) publish(eventType, todoID string, data interface{}) {
+	if err := s.Events.Publish(eventType, todoID, data); err != nil {
+		log.Err(err).Str("type", eventType).Msg("failed to publish event")
+	}
+}
+
+// StreamEvents streams todo events as Server-Sent Events, leaving out those about todos the caller may not
+// read. Clients that reconnect with a Last-Event-ID header first receive the events they missed. If those are
+// no longer available, a "reset" event tells the client to reload its todos. Idle streams send heartbeat
+// comments. Clients that fall behind are disconnected and can resume by reconnecting.
+func (s *Server) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	var lastID uint64
+	if header := r.Header.Get("Last-Event-ID"); header != "" {
+		id, err := strconv.ParseUint(header, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid Last-Event-ID [%s]", header), http.StatusBadRequest)
+			return
+		}
+
+		lastID = id
+	}
+
+	sub, missed, ok := s.Events.Subscribe(lastID)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	stream := &eventStream{w: w, rc: http.NewResponseController(w)}
+	stream.write("retry: %d\n\n", eventRetry)
+
+	if !ok {
+		stream.write("event: reset\ndata: {}\n\n")
+	}
+
+	for _, event := range missed {
+		if s.mayRead(r.Context(), event) {
+			stream.event(event)
+		}
+	}
+
+	heartbeat := time.NewTicker(s.options.Events.Heartbeat)
+	defer heartbeat.Stop()
+
+	for stream.flush() {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, open := <-sub.Events():
+			if !open {
+				if sub.Lagged() {
+					stream.write(": too far behind, reconnect to resume\n\n")
+					stream.flush()
+				}
+
+				return
+			}
+
+			if s.mayRead(r.Context(), event) {
+				stream.event(event)
+			}
+		case <-heartbeat.C:
+			stream.write(": heartbeat\n\n")
+		}
+	}
+}
+
+// mayRead reports whether the caller may read the todo that an event is about, as decided for GET /v1/todos
+// with the todo's ID. Streams are authorized when they start, so each event is checked on its own, for
+// policies that restrict todos and for changes to the caller's access. Failed decisions leave the event out.
+func (s *Server) mayRead(ctx context.Context, event events.Event) bool {
+	if s.AuthorizeTodo == nil {
+		return false
+	}
+
+	allowed, err := s.AuthorizeTodo(ctx, TodoRead, event.TodoID)
+	if err != nil {
+		log.Err(err).Uint64("event", event.ID).Str("id", event.TodoID).Msg("failed to authorize event")
+		return false
+	}
+
+	return allowed
+}
+
+// eventStream writes Server-Sent Events. After a write fails, later writes are skipped and flush reports
+// false.
+type eventStream struct {
+	w   http.ResponseWriter
+	rc  *http.ResponseController
+	err error
+}
+
+func (e *eventStream) event(event events.Event) {
+	e.write("id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+}
+
+func (e *eventStream) write(format string, args ...interface{}) {
+	if e.err != nil {
+		return
+	}
+
+	// The server's write timeout would end the stream, so each write gets its own deadline instead.
+	if e.err = e.rc.SetWriteDeadline(time.Now().Add(eventWriteTimeout)); e.err != nil {
+		return
+	}
+
+	_, e.err = fmt.Fprintf(e.w, format, args...)
+}
+
+func (e *eventStream) flush() bool {
+	if e.err == nil {
+		e.err = e.rc.Flush()
+	}
+
+	return e.err == nil
+}
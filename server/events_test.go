@@ -0,0 +1,53 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"todo-go/events"
+	"todo-go/identity"
+)
+
+func TestStreamEventsLeavesOutUnreadableTodos(t *testing.T) {
+	srv := newTestServer(t)
+
+	// The policy hides the todo with the ID "secret" from everyone.
+	srv.AuthorizeTodo = func(_ context.Context, action TodoAction, id string) (bool, error) {
+		return action == TodoRead && id != "secret", nil
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(identity.WithPrincipal(r.Context(), &identity.Principal{Subject: morty}))
+		srv.StreamEvents(w, r)
+	}))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// The stream has subscribed once the response has started.
+	srv.publish(events.TodoCreated, "secret", map[string]string{"id": "secret"})
+	srv.publish(events.TodoCreated, "public", map[string]string{"id": "public"})
+
+	lines := bufio.NewScanner(resp.Body)
+	for lines.Scan() {
+		line := lines.Text()
+		if strings.Contains(line, "secret") {
+			t.Fatalf("got an event about a todo the caller may not read: %s", line)
+		}
+
+		// Events are delivered in order, so the secret one would have come first.
+		if strings.Contains(line, "public") {
+			return
+		}
+	}
+
+	t.Fatalf("the stream ended before the readable event: %v", lines.Err())
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+
+	todov1 "todo-go/api/todo/v1"
+	"todo-go/validation"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCConfig configures the gRPC API.
+type GRPCConfig struct {
+	Enabled bool
+	// ListenAddress is the host and port that the gRPC server listens on.
+	ListenAddress string
+}
+
+// TodoService implements the gRPC TodoService with the same operations as the HTTP handlers. Callers must be
+// authenticated and authorized by interceptors before it is called.
+type TodoService struct {
+	todov1.UnimplementedTodoServiceServer
+
+	srv *Server
+}
+
+var _ todov1.TodoServiceServer = (*TodoService)(nil)
+
+// NewTodoService returns the gRPC TodoService of srv.
+func NewTodoService(srv *Server) *TodoService {
+	return &TodoService{srv: srv}
+}
+
+func (t *TodoService) ListTodos(ctx context.Context, _ *todov1.ListTodosRequest) (*todov1.ListTodosResponse, error) {
+	todos, err := t.srv.listTodos(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	resp := &todov1.ListTodosResponse{Todos: make([]*todov1.Todo, len(todos))}
+	for i, todo := range todos {
+		resp.Todos[i] = todo.toProto()
+	}
+
+	return resp, nil
+}
+
+func (t *TodoService) GetTodo(ctx context.Context, req *todov1.GetTodoRequest) (*todov1.GetTodoResponse, error) {
+	todo, err := t.srv.getTodo(ctx, req.GetId())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &todov1.GetTodoResponse{Todo: todo.toProto()}, nil
+}
+
+func (t *TodoService) CreateTodo(ctx context.Context, req *todov1.CreateTodoRequest) (*todov1.CreateTodoResponse, error) {
+	body := &todoRequest{Title: req.GetTitle(), Completed: req.GetCompleted(), DueAt: req.GetDueAt()}
+	if err := validation.Struct(body); err != nil {
+		return nil, grpcError(err)
+	}
+
+	todo, err := t.srv.createTodo(ctx, body)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &todov1.CreateTodoResponse{Todo: todo.toProto()}, nil
+}
+
+func (t *TodoService) UpdateTodo(ctx context.Context, req *todov1.UpdateTodoRequest) (*todov1.UpdateTodoResponse, error) {
+	body := &todoRequest{Title: req.GetTitle(), Completed: req.GetCompleted(), DueAt: req.GetDueAt()}
+	if err := validation.Struct(body); err != nil {
+		return nil, grpcError(err)
+	}
+
+	todo, err := t.srv.updateTodo(ctx, req.GetId(), body)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &todov1.UpdateTodoResponse{Todo: todo.toProto()}, nil
+}
+
+func (t *TodoService) DeleteTodo(ctx context.Context, req *todov1.DeleteTodoRequest) (*todov1.DeleteTodoResponse, error) {
+	if err := t.srv.deleteTodo(ctx, req.GetId()); err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &todov1.DeleteTodoResponse{}, nil
+}
+
+func (t *TodoService) ShareTodo(ctx context.Context, req *todov1.ShareTodoRequest) (*todov1.ShareTodoResponse, error) {
+	if req.GetUserId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	if err := t.srv.shareTodo(ctx, req.GetId(), req.GetUserId()); err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &todov1.ShareTodoResponse{}, nil
+}
+
+func (t *todoResponse) toProto() *todov1.Todo {
+	return &todov1.Todo{
+		Id:        t.ID,
+		OwnerId:   t.OwnerID,
+		OwnerName: t.OwnerName,
+		Title:     t.Title,
+		Completed: t.Completed,
+		DueAt:     formatDueAt(t.DueAt),
+		Permissions: &todov1.TodoPermissions{
+			Update: t.Permissions.Update,
+			Delete: t.Permissions.Delete,
+		},
+	}
+}
+
+// grpcError returns a gRPC status error with the code that corresponds to err, like httpStatus does for HTTP.
+// Internal errors are logged, and reported without their details.
+func grpcError(err error) error {
+	var invalid *validation.Error
+	var quotaErr *quotaError
+
+	switch {
+	case errors.As(err, &invalid):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.As(err, &quotaErr):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, errNotAuthorized):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, errDuplicateOperation):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, errTodoNotFound), errors.Is(err, errUserNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	}
+
+	log.Err(err).Msg("grpc call failed")
+
+	return status.Error(codes.Internal, "internal error")
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"testing"
+
+	"todo-go/validation"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCError(t *testing.T) {
+	for _, tc := range []struct {
+		err     error
+		code    codes.Code
+		message string
+	}{
+		{validation.Fields(validation.FieldError{Field: "title"}), codes.InvalidArgument, ""},
+		{&quotaError{limit: 1}, codes.ResourceExhausted, ""},
+		{errNotAuthorized, codes.PermissionDenied, errNotAuthorized.Error()},
+		{errDuplicateOperation, codes.Aborted, errDuplicateOperation.Error()},
+		{errTodoNotFound, codes.NotFound, errTodoNotFound.Error()},
+		// The details of internal errors stay in the server's log.
+		{errors.New("open /var/lib/todo/todo.db: permission denied"), codes.Internal, "internal error"},
+	} {
+		s := status.Convert(grpcError(tc.err))
+
+		switch {
+		case s.Code() != tc.code:
+			t.Errorf("%v: got code %s, want %s", tc.err, s.Code(), tc.code)
+		case tc.message != "" && s.Message() != tc.message:
+			t.Errorf("%v: got message [%s], want [%s]", tc.err, s.Message(), tc.message)
+		}
+	}
+}
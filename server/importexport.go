@@ -0,0 +1,490 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"todo-go/events"
+	"todo-go/store"
+	"todo-go/validation"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// maxImportRows is the largest number of todos that can be imported at once.
+const maxImportRows = 1000
+
+// Export and import formats.
+const (
+	formatJSON     = "json"
+	formatCSV      = "csv"
+	formatMarkdown = "md"
+)
+
+// todoFormat reads and writes todos in an export format.
+type todoFormat struct {
+	contentType string
+	write       func(w io.Writer, todos []*todoResponse) error
+	// read parses an import. It fails if the body can't be parsed at all; problems with individual rows are
+	// reported with the rows.
+	read func(body []byte) ([]importRow, error)
+}
+
+var todoFormats = map[string]*todoFormat{
+	formatJSON:     {contentType: "application/json", write: writeJSONTodos, read: readJSONTodos},
+	formatCSV:      {contentType: "text/csv; charset=utf-8", write: writeCSVTodos, read: readCSVTodos},
+	formatMarkdown: {contentType: "text/markdown; charset=utf-8", write: writeMarkdownTodos, read: readMarkdownTodos},
+}
+
+// exportedTodo is a todo in a JSON export. Imports ignore its ID and owner, since imported todos are new and
+// owned by the caller, so exports can be imported as they are.
+type exportedTodo struct {
+	ID        string `json:"id,omitempty"`
+	OwnerID   string `json:"ownerId,omitempty"`
+	OwnerName string `json:"ownerName,omitempty"`
+	Title     string `json:"title"`
+	Completed bool   `json:"completed"`
+	DueAt     string `json:"dueAt,omitempty"`
+}
+
+// importRow is a todo read from an import, or the reason it couldn't be read.
+type importRow struct {
+	// Row is the line of the todo in CSV and Markdown imports, and its position in JSON imports, from 1.
+	Row  int
+	Todo todoRequest
+	Err  error
+}
+
+type importResponse struct {
+	// DryRun reports that nothing was imported. The results tell which rows would have been.
+	DryRun   bool            `json:"dryRun"`
+	Results  []*importResult `json:"results"`
+	Imported int             `json:"imported"`
+	Failed   int             `json:"failed"`
+}
+
+// importResult is the outcome of importing a row.
+type importResult struct {
+	Row   int    `json:"row"`
+	Title string `json:"title,omitempty"`
+	itemStatus
+	// Todo is the imported todo. It is omitted from dry runs.
+	Todo *todoResponse `json:"todo,omitempty"`
+}
+
+// ExportTodos writes the todos that the caller may list, in the format named by the format query parameter:
+// json (the default), csv or md for a Markdown checklist.
+func (s *Server) ExportTodos(w http.ResponseWriter, r *http.Request) {
+	name, format, err := requestFormat(r)
+	if err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	todos, err := s.listTodos(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := format.write(&buf, todos); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", format.contentType)
+	w.Header().Add("Content-Disposition", `attachment; filename="todos.`+name+`"`)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// ImportTodos creates todos owned by the caller from a body in the format named by the format query
+// parameter, like ExportTodos. Rows that can't be read or are invalid or over the caller's quota are reported
+// and skipped. With dry_run=true, nothing is created.
+func (s *Server) ImportTodos(w http.ResponseWriter, r *http.Request) {
+	_, format, err := requestFormat(r)
+	if err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	dryRun := false
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			validation.WriteError(w, validation.Fields(validation.FieldError{
+				Field:   "dry_run",
+				Code:    "bool",
+				Message: fmt.Sprintf("dry_run must be true or false, not [%s]", value),
+			}))
+			return
+		}
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	rows, err := format.read(body)
+	if err == nil && len(rows) > maxImportRows {
+		err = errors.Errorf("at most %d todos can be imported at once, not %d", maxImportRows, len(rows))
+	}
+
+	if err != nil {
+		validation.WriteError(w, validation.Fields(validation.FieldError{Field: "body", Code: "format", Message: err.Error()}))
+		return
+	}
+
+	resp, err := s.importTodos(r.Context(), rows, dryRun)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
+// requestFormat returns the format named by the request's format query parameter.
+func requestFormat(r *http.Request) (string, *todoFormat, error) {
+	name := r.URL.Query().Get("format")
+	if name == "" {
+		name = formatJSON
+	}
+
+	format, ok := todoFormats[name]
+	if !ok {
+		return "", nil, validation.Fields(validation.FieldError{
+			Field:   "format",
+			Code:    "oneof",
+			Message: fmt.Sprintf("format must be one of %s, %s, %s, not [%s]", formatJSON, formatCSV, formatMarkdown, name),
+		})
+	}
+
+	return name, format, nil
+}
+
+// importTodos creates a todo owned by the caller for each row that is valid and within their quotas.
+func (s *Server) importTodos(ctx context.Context, rows []importRow, dryRun bool) (*importResponse, error) {
+	caller, owner, err := s.callerUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := s.quotaFor(ctx, caller, owner)
+
+	count, err := s.Store.CountTodos(owner.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &importResponse{DryRun: dryRun, Results: make([]*importResult, len(rows))}
+
+	for i := range rows {
+		row := &rows[i]
+		result := &importResult{Row: row.Row, Title: row.Todo.Title}
+		resp.Results[i] = result
+
+		err := row.Err
+		if err == nil {
+			err = validation.Struct(&row.Todo)
+		}
+
+		if err == nil {
+			err = checkTitle(limits, row.Todo.Title)
+		}
+
+		if err == nil && !limits.TodosLeft(count) {
+			err = &quotaError{limit: limits.MaxTodos}
+		}
+
+		if err != nil {
+			result.fail(err)
+			resp.Failed++
+			continue
+		}
+
+		count++
+
+		if !dryRun {
+			if result.Todo, err = s.importTodo(ctx, &row.Todo, owner.Id, owner.DisplayName, limits.MaxTodos); err != nil {
+				result.fail(err)
+				resp.Failed++
+				continue
+			}
+		}
+
+		result.Status = http.StatusOK
+		resp.Imported++
+	}
+
+	if !dryRun {
+		log.Info().Str("owner", owner.Id).Int("imported", resp.Imported).Int("failed", resp.Failed).Msg("todos imported")
+	}
+
+	return resp, nil
+}
+
+// importTodo creates an imported todo and its owner relation, unless the owner already owns maxTodos todos.
+func (s *Server) importTodo(
+	ctx context.Context, req *todoRequest, ownerID, ownerName string, maxTodos int,
+) (*todoResponse, error) {
+	todo := req.toTodo(uuid.New().String(), ownerID)
+
+	if err := s.Store.InsertTodoWithinLimit(&todo, maxTodos); err != nil {
+		return nil, storeQuotaError(err, maxTodos)
+	}
+
+	if err := s.Directory.AddTodo(ctx, &todo); err != nil {
+		return nil, errors.Wrap(err, "the todo was saved, but the directory wasn't updated")
+	}
+
+	resp := toTodoResponse(&todo, ownerName, s.todoPermissions(ctx, []store.Todo{todo})[0])
+	s.publish(events.TodoCreated, resp.ID, toTodoEvent(resp))
+
+	return resp, nil
+}
+
+func writeJSONTodos(w io.Writer, todos []*todoResponse) error {
+	exported := make([]exportedTodo, 0, len(todos))
+	for _, todo := range todos {
+		exported = append(exported, exportedTodo{
+			ID:        todo.ID,
+			OwnerID:   todo.OwnerID,
+			OwnerName: todo.OwnerName,
+			Title:     todo.Title,
+			Completed: todo.Completed,
+			DueAt:     formatDueAt(todo.DueAt),
+		})
+	}
+
+	return json.NewEncoder(w).Encode(exported)
+}
+
+// readJSONTodos reads an array of todos, like the ones writeJSONTodos writes.
+func readJSONTodos(body []byte) ([]importRow, error) {
+	var items []json.RawMessage
+	if err := json.Unmarshal(body, &items); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return nil, errors.New("body must be a JSON array of todos")
+		}
+
+		return nil, errors.Wrap(err, "body isn't valid JSON")
+	}
+
+	rows := make([]importRow, 0, len(items))
+	for i, item := range items {
+		row := importRow{Row: i + 1}
+
+		var todo exportedTodo
+		row.Err = validation.Unmarshal(item, &todo)
+
+		row.Todo = todoRequest{Title: todo.Title, Completed: todo.Completed, DueAt: todo.DueAt}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+var csvHeader = []string{"id", "ownerId", "ownerName", "title", "completed", "dueAt"}
+
+// csvFormulaPrefixes are the characters that make spreadsheets treat a cell as a formula.
+const csvFormulaPrefixes = "=+-@\t\r"
+
+// escapeCSVCell keeps spreadsheets from running a cell that users control as a formula, by prefixing it with
+// a single quote. Cells that already start with quotes before a formula character get another one, so that
+// unescapeCSVCell can restore every value.
+func escapeCSVCell(cell string) string {
+	if isCSVFormula(strings.TrimLeft(cell, "'")) {
+		return "'" + cell
+	}
+
+	return cell
+}
+
+// unescapeCSVCell reverses escapeCSVCell.
+func unescapeCSVCell(cell string) string {
+	if strings.HasPrefix(cell, "'") && isCSVFormula(strings.TrimLeft(cell, "'")) {
+		return cell[1:]
+	}
+
+	return cell
+}
+
+func isCSVFormula(cell string) bool {
+	return cell != "" && strings.ContainsRune(csvFormulaPrefixes, rune(cell[0]))
+}
+
+func writeCSVTodos(w io.Writer, todos []*todoResponse) error {
+	out := csv.NewWriter(w)
+	_ = out.Write(csvHeader)
+
+	for _, todo := range todos {
+		_ = out.Write([]string{
+			escapeCSVCell(todo.ID),
+			escapeCSVCell(todo.OwnerID),
+			escapeCSVCell(todo.OwnerName),
+			escapeCSVCell(todo.Title),
+			strconv.FormatBool(todo.Completed),
+			formatDueAt(todo.DueAt),
+		})
+	}
+
+	out.Flush()
+
+	return out.Error()
+}
+
+// readCSVTodos reads todos from CSV with a header row. The title column is required; the completed and dueAt
+// columns are optional, and other columns are ignored. Titles escaped by writeCSVTodos are unescaped.
+func readCSVTodos(body []byte) ([]importRow, error) {
+	in := csv.NewReader(bytes.NewReader(body))
+	in.FieldsPerRecord = -1
+	in.TrimLeadingSpace = true
+
+	header, err := in.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "body must be CSV with a header row")
+	}
+
+	titleCol, completedCol, dueAtCol := -1, -1, -1
+	for i, name := range header {
+		switch strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))) {
+		case "title":
+			titleCol = i
+		case "completed":
+			completedCol = i
+		case "dueat":
+			dueAtCol = i
+		}
+	}
+
+	if titleCol < 0 {
+		return nil, errors.New("CSV header must have a title column")
+	}
+
+	var rows []importRow
+	for {
+		record, err := in.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+
+		var row importRow
+
+		var parseErr *csv.ParseError
+		switch {
+		case errors.As(err, &parseErr):
+			row.Row = parseErr.StartLine
+			row.Err = validation.Fields(validation.FieldError{Field: "row", Code: "format", Message: parseErr.Err.Error()})
+			rows = append(rows, row)
+
+			continue
+		case err != nil:
+			return nil, err
+		}
+
+		row.Row, _ = in.FieldPos(0)
+
+		switch {
+		case titleCol >= len(record):
+			row.Err = validation.Fields(validation.FieldError{Field: "title", Code: "required", Message: "title is required"})
+		default:
+			row.Todo.Title = unescapeCSVCell(strings.TrimSpace(record[titleCol]))
+
+			if completedCol >= 0 && completedCol < len(record) {
+				row.Todo.Completed, row.Err = parseCompleted(record[completedCol])
+			}
+
+			if dueAtCol >= 0 && dueAtCol < len(record) {
+				row.Todo.DueAt = strings.TrimSpace(record[dueAtCol])
+			}
+		}
+
+		rows = append(rows, row)
+	}
+}
+
+// parseCompleted reads a completed column, which is empty for incomplete todos.
+func parseCompleted(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "false", "no", "0":
+		return false, nil
+	case "true", "yes", "x", "1":
+		return true, nil
+	default:
+		return false, validation.Fields(validation.FieldError{
+			Field:   "completed",
+			Code:    "bool",
+			Message: fmt.Sprintf("completed must be true or false, not [%s]", value),
+		})
+	}
+}
+
+// formatDueAt formats a due date like requests do, or returns "" if there is none.
+func formatDueAt(due *time.Time) string {
+	if due == nil {
+		return ""
+	}
+
+	return due.Format(time.RFC3339)
+}
+
+// writeMarkdownTodos writes a Markdown checklist. It has no room for due dates, so they aren't exported.
+func writeMarkdownTodos(w io.Writer, todos []*todoResponse) error {
+	var buf bytes.Buffer
+	buf.WriteString("# Todos\n\n")
+
+	for _, todo := range todos {
+		check := " "
+		if todo.Completed {
+			check = "x"
+		}
+
+		// Each todo must stay on its own line to be read back.
+		title := strings.Join(strings.Fields(todo.Title), " ")
+		fmt.Fprintf(&buf, "- [%s] %s\n", check, title)
+	}
+
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
+
+// checklistItem matches Markdown task list items, such as "- [x] Buy milk".
+var checklistItem = regexp.MustCompile(`^\s*[-*+]\s+\[([ xX])\]\s*(.*)$`)
+
+// readMarkdownTodos reads the task list items of a Markdown document. Other lines are ignored.
+func readMarkdownTodos(body []byte) ([]importRow, error) {
+	var rows []importRow
+
+	for i, line := range strings.Split(string(body), "\n") {
+		match := checklistItem.FindStringSubmatch(strings.TrimSuffix(line, "\r"))
+		if match == nil {
+			continue
+		}
+
+		rows = append(rows, importRow{
+			Row:  i + 1,
+			Todo: todoRequest{Title: strings.TrimSpace(match[2]), Completed: match[1] != " "},
+		})
+	}
+
+	return rows, nil
+}
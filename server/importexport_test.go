@@ -0,0 +1,55 @@
+package server
+
+import (
+	"encoding/csv"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCSVFormulaEscaping(t *testing.T) {
+	srv := newTestServer(t)
+
+	titles := []string{`=HYPERLINK("https://evil.example", "Buy milk")`, "+1 for the portal gun", "'=not a formula", "Plain"}
+	for _, title := range titles {
+		createTestTodo(t, srv, rick, `{"title": "`+strings.ReplaceAll(title, `"`, `\"`)+`"}`)
+	}
+
+	w := serve(srv.ExportTodos, rick, "GET", "/v1/todos/export?format=csv", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("export: got status %d: %s", w.Code, w.Body.String())
+	}
+
+	export := w.Body.String()
+
+	records, err := csv.NewReader(strings.NewReader(export)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, record := range records[1:] {
+		if title := record[3]; isCSVFormula(title) {
+			t.Errorf("exported title [%s] would run as a formula", title)
+		}
+	}
+
+	w = serve(srv.ImportTodos, morty, "POST", "/v1/todos/import?format=csv", export, nil)
+	if resp := decode[*importResponse](t, w); w.Code != http.StatusOK || resp.Imported != len(titles) {
+		t.Fatalf("import: got status %d: %s", w.Code, w.Body.String())
+	}
+
+	var imported []string
+	for _, todo := range listTestTodos(t, srv, morty) {
+		if todo.OwnerID == morty {
+			imported = append(imported, todo.Title)
+		}
+	}
+
+	sort.Strings(titles)
+	sort.Strings(imported)
+
+	if strings.Join(imported, "\n") != strings.Join(titles, "\n") {
+		t.Errorf("got imported titles %q, want %q", imported, titles)
+	}
+}
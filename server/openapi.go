@@ -0,0 +1,102 @@
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// APIPrefix is the path prefix of the current version of the API.
+const APIPrefix = "/v1"
+
+// openAPISpec describes the routes under APIPrefix. Paths in it are relative to the prefix.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// OpenAPI serves the OpenAPI document of the API.
+func (s *Server) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(openAPISpec)
+}
+
+// CheckAPISpec returns an error if the routes that router serves under APIPrefix differ from the operations
+// in the OpenAPI document.
+func CheckAPISpec(router *mux.Router) error {
+	documented, err := specOperations()
+	if err != nil {
+		return err
+	}
+
+	served := map[string]bool{}
+	err = router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+
+		if path, ok := strings.CutPrefix(path, APIPrefix); ok {
+			for _, method := range methods {
+				served[method+" "+path] = true
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to list routes")
+	}
+
+	var problems []string
+	for op := range served {
+		if !documented[op] {
+			problems = append(problems, "undocumented route "+op)
+		}
+	}
+
+	for op := range documented {
+		if !served[op] {
+			problems = append(problems, "documented route "+op+" is not served")
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return errors.Errorf("OpenAPI document is out of date: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// specOperations returns the operations in the OpenAPI document as "METHOD /path".
+func specOperations() (map[string]bool, error) {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		return nil, errors.Wrap(err, "failed to parse OpenAPI document")
+	}
+
+	operations := map[string]bool{}
+	for path, item := range spec.Paths {
+		for method := range item {
+			switch method {
+			case "get", "put", "post", "delete", "patch", "head", "options":
+				operations[strings.ToUpper(method)+" "+path] = true
+			}
+		}
+	}
+
+	return operations, nil
+}
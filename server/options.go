@@ -1,7 +1,26 @@
 package server
 
 import (
+	"flag"
+	"fmt"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"todo-go/cors"
+	"todo-go/decisioncache"
+	"todo-go/decisionlog"
+	"todo-go/devauth"
+	"todo-go/directory"
+	"todo-go/events"
+	"todo-go/idempotency"
+	"todo-go/identity"
+	"todo-go/quota"
+	"todo-go/ratelimit"
+	"todo-go/session"
+	"todo-go/webhooks"
 
 	"github.com/aserto-dev/go-aserto"
 	"github.com/aserto-dev/go-aserto/ds/v3"
@@ -11,54 +30,85 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// Authorizer and directory modes.
+const (
+	// ModeRemote uses the configured authorizer or directory service.
+	ModeRemote = "remote"
+	// ModeLocal evaluates authorization rules in-process. For development only.
+	ModeLocal = "local"
+	// ModeMemory keeps directory objects and relations in memory. For development only.
+	ModeMemory = "memory"
+)
+
+// defaultConfigFile is loaded when no config file is specified and it exists in the working directory.
+const defaultConfigFile = "config.yaml"
+
 type Options struct {
 	Authorizer *aserto.Config
 	Directory  *ds.Config
 
+	AuthorizerMode string
+	DirectoryMode  string
+
 	PolicyName string
 	PolicyRoot string
 
 	OidcIssuer   string
 	OidcAudience string
 	OidcJwksURL  string
+	OidcClaims   *identity.ClaimMapping
+	// OidcRequireScopes rejects JWTs without a scope claim instead of granting them all scopes.
+	OidcRequireScopes bool
+	// RouteScopes sets the OAuth scopes that each route under APIPrefix requires, keyed by method and path
+	// template, such as "POST /v1/todos". Routes without scopes only require authentication.
+	RouteScopes map[string][]string
+
+	DecisionLog   *decisionlog.Config
+	DecisionCache *decisioncache.Config
+	IdentityCache *directory.IdentityCacheConfig
+
+	DevAuth *devauth.Config
+	Session *session.Config
+
+	CORS      *cors.Config
+	RateLimit *ratelimit.Config
+	Quota     *quota.Config
+	Events    *events.Config
+	Webhooks  *webhooks.Config
+
+	Idempotency *idempotency.Config
+
+	// MaxBodyBytes is the largest request body that the server reads.
+	MaxBodyBytes int
+
+	GRPC *GRPCConfig
 
 	LogLevel zerolog.Level
 }
 
-func LoadOptions() (*Options, error) {
-	if err := loadEnv(); err != nil {
+// LoadOptions resolves the effective options from defaults, the config file, environment variables
+// and command line flags (in increasing order of precedence), validates them and initializes logging.
+// The flags must already be parsed.
+//
+// Invalid values in the config file, the environment or the flags are reported together with the problems
+// that Validate finds, in a single ValidationError.
+func LoadOptions(flags *OptionFlags) (*Options, error) {
+	options, problems, err := resolveOptions(flags)
+	if err != nil {
 		return nil, err
 	}
 
-	authorizerAddr := getEnvOr("ASERTO_AUTHORIZER_SERVICE_URL", "localhost:8282")
-	directoryAddr := getEnvOr("ASERTO_DIRECTORY_SERVICE_URL", "localhost:9292")
-	asertoLogLevel := getEnvOr("ASERTO_LOG_LEVEL", "info")
+	if err := options.Validate(); err != nil {
+		var invalid ValidationError
+		if !errors.As(err, &invalid) {
+			return nil, err
+		}
 
-	logLevel, err := zerolog.ParseLevel(asertoLogLevel)
-	if err != nil {
-		return nil, errors.Wrapf(err, "invalid log level [%s] in ASERTO_LOG_LEVEL", asertoLogLevel)
+		problems.add(invalid)
 	}
 
-	options := &Options{
-		Authorizer: &aserto.Config{
-			Address:    authorizerAddr,
-			APIKey:     os.Getenv("ASERTO_AUTHORIZER_API_KEY"),
-			CACertPath: os.ExpandEnv(getEnv("ASERTO_AUTHORIZER_GRPC_CA_CERT_PATH", "ASERTO_GRPC_CA_CERT_PATH")),
-			TenantID:   os.Getenv("ASERTO_TENANT_ID"),
-		},
-		Directory: &ds.Config{
-			Config: &aserto.Config{
-				Address:    directoryAddr,
-				APIKey:     os.Getenv("ASERTO_DIRECTORY_API_KEY"),
-				CACertPath: os.ExpandEnv(getEnv("ASERTO_DIRECTORY_GRPC_CA_CERT_PATH", "ASERTO_GRPC_CA_CERT_PATH")),
-				TenantID:   os.Getenv("ASERTO_TENANT_ID"),
-			}},
-		PolicyName:   os.Getenv("ASERTO_POLICY_INSTANCE_NAME"),
-		PolicyRoot:   getEnvOr("ASERTO_POLICY_ROOT", "todoApp"),
-		OidcIssuer:   getEnvOr("ISSUER", "https://citadel.demo.aserto.com/dex"),
-		OidcAudience: getEnvOr("AUDIENCE", "citadel-app"),
-		OidcJwksURL:  getEnvOr("JWKS_URL", "https://citadel.demo.aserto.com/dex/keys"),
-		LogLevel:     logLevel,
+	if len(problems) > 0 {
+		return nil, problems
 	}
 
 	// Initialize logging.
@@ -66,12 +116,602 @@ func LoadOptions() (*Options, error) {
 
 	log.Info().
 		Str("authorizer", options.Authorizer.Address).
+		Str("authorizer_mode", options.AuthorizerMode).
 		Str("directory", options.Directory.Address).
+		Str("directory_mode", options.DirectoryMode).
 		Msg("options loaded")
 
+	for _, warning := range options.NonProduction() {
+		log.Warn().Msgf("NOT FOR PRODUCTION: %s", warning)
+	}
+
 	return options, nil
 }
 
+// ResolveOptions layers defaults, the config file, environment variables and command line flags
+// without validating the result. The flags must already be parsed.
+func ResolveOptions(flags *OptionFlags) (*Options, error) {
+	options, problems, err := resolveOptions(flags)
+	switch {
+	case err != nil:
+		return nil, err
+	case len(problems) > 0:
+		return nil, problems
+	}
+
+	return options, nil
+}
+
+// resolveOptions layers the options like ResolveOptions, and returns them along with the values that
+// couldn't be parsed, which are left unchanged. It only fails if the .env or config file can't be read.
+func resolveOptions(flags *OptionFlags) (*Options, ValidationError, error) {
+	if err := loadEnv(); err != nil {
+		return nil, nil, err
+	}
+
+	options := defaultOptions()
+
+	var problems ValidationError
+
+	if path := configFilePath(flags.configFile); path != "" {
+		fileProblems, err := loadConfigFile(path, options)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		problems.add(fileProblems)
+	}
+
+	problems.add(applyEnv(options))
+	problems.add(flags.apply(options))
+
+	if options.DevAuth.Enabled {
+		// Trust tokens minted by this server's development issuer.
+		options.OidcIssuer = devauth.IssuerName
+		options.OidcJwksURL = localURL(devauth.JWKSPath)
+
+		// Browser logins go through the development issuer's mock provider.
+		options.Session.AuthorizeURL = localURL(devauth.AuthorizePath)
+		options.Session.TokenURL = localURL(devauth.OAuthTokenPath)
+	}
+
+	return options, problems, nil
+}
+
+func defaultOptions() *Options {
+	return &Options{
+		Authorizer: &aserto.Config{Address: "localhost:8282"},
+		Directory: &ds.Config{
+			Config: &aserto.Config{Address: "localhost:9292"},
+		},
+		AuthorizerMode: ModeRemote,
+		DirectoryMode:  ModeRemote,
+		PolicyRoot:     "todoApp",
+		OidcIssuer:     "https://citadel.demo.aserto.com/dex",
+		OidcAudience:   "citadel-app",
+		OidcJwksURL:    "https://citadel.demo.aserto.com/dex/keys",
+		OidcClaims:     identity.DefaultClaimMapping(),
+		RouteScopes:    defaultRouteScopes(),
+		DecisionLog: &decisionlog.Config{
+			Sink:           decisionlog.SinkLog,
+			IncludeAllowed: true,
+		},
+		DecisionCache: &decisioncache.Config{
+			TTL:        5 * time.Second,
+			MaxEntries: 10000,
+		},
+		IdentityCache: &directory.IdentityCacheConfig{
+			Size:        1000,
+			TTL:         5 * time.Minute,
+			NegativeTTL: 30 * time.Second,
+		},
+		DevAuth: &devauth.Config{
+			KeyPath:  "dev-signing-key.pem",
+			TokenTTL: time.Hour,
+		},
+		Session: &session.Config{
+			ClientID:     "todo-go",
+			RedirectURL:  localURL(session.CallbackPath),
+			Scopes:       "openid profile email",
+			CookieName:   "todo_session",
+			CookieSecure: true,
+			TTL:          8 * time.Hour,
+		},
+		CORS: &cors.Config{
+			AllowedOrigins: []string{"http://localhost:3000"},
+			AllowedMethods: []string{"GET", "POST", "PUT", "DELETE"},
+			AllowedHeaders: []string{"Content-Type", "Authorization", "X-CSRF-Token", "Idempotency-Key"},
+			ExposedHeaders: []string{
+				"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After", "Idempotent-Replayed",
+			},
+			AllowCredentials: true,
+			MaxAge:           10 * time.Minute,
+		},
+		RateLimit: &ratelimit.Config{
+			Enabled:    true,
+			PerIP:      ratelimit.Limit{Requests: 600, Period: time.Minute},
+			PerSubject: ratelimit.Limit{Requests: 300, Period: time.Minute},
+			// A single proxy, such as a load balancer.
+			ForwardedHops: 1,
+			Routes: map[string]ratelimit.Limit{
+				"POST /v1/todos":        {Requests: 30, Period: time.Minute},
+				"POST /v1/todos:batch":  {Requests: 10, Period: time.Minute},
+				"POST /v1/todos/import": {Requests: 5, Period: time.Minute},
+			},
+		},
+		// Quotas are opt-in, so that upgrading doesn't reject todos that were allowed before.
+		Quota: &quota.Config{},
+		Events: &events.Config{
+			History:          1000,
+			SubscriberBuffer: 64,
+			Heartbeat:        15 * time.Second,
+		},
+		Webhooks: &webhooks.Config{
+			Timeout:        10 * time.Second,
+			MaxAttempts:    8,
+			InitialBackoff: 10 * time.Second,
+			MaxBackoff:     time.Hour,
+			DisableAfter:   20,
+		},
+		Idempotency: &idempotency.Config{
+			Enabled: true,
+			TTL:     24 * time.Hour,
+		},
+		MaxBodyBytes: 1 << 20,
+		GRPC: &GRPCConfig{
+			ListenAddress: "0.0.0.0:3002",
+		},
+		LogLevel: zerolog.InfoLevel,
+	}
+}
+
+// defaultRouteScopes requires the read scope for reads and the write scope for all changes, including
+// managing tokens, webhooks and caches.
+func defaultRouteScopes() map[string][]string {
+	read, write := []string{identity.ScopeRead}, []string{identity.ScopeWrite}
+
+	return map[string][]string{
+		"GET /v1/users/{userID}": read,
+
+		"GET /v1/todos":          read,
+		"POST /v1/todos":         write,
+		"GET /v1/todos/export":   read,
+		"POST /v1/todos/import":  write,
+		"PUT /v1/todos/{id}":     write,
+		"DELETE /v1/todos/{id}":  write,
+		"POST /v1/todos:batch":   write,
+		"GET /v1/events":         read,
+		"GET /v1/me/usage":       read,
+		"GET /v1/me/calendar":    read,
+		"POST /v1/me/calendar":   write,
+		"DELETE /v1/me/calendar": write,
+
+		"GET /v1/tokens":              read,
+		"POST /v1/tokens":             write,
+		"DELETE /v1/tokens/{tokenID}": write,
+
+		"GET /v1/webhooks":                        read,
+		"POST /v1/webhooks":                       write,
+		"GET /v1/webhooks/{webhookID}":            read,
+		"PUT /v1/webhooks/{webhookID}":            write,
+		"DELETE /v1/webhooks/{webhookID}":         write,
+		"GET /v1/webhooks/{webhookID}/deliveries": read,
+
+		"GET /v1/admin/cache/identities":    read,
+		"DELETE /v1/admin/cache/identities": write,
+	}
+}
+
+// configFilePath returns the config file to load, if any. An explicitly requested file takes precedence over
+// TODO_CONFIG_FILE, which takes precedence over config.yaml in the working directory.
+func configFilePath(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+
+	if path := os.Getenv("TODO_CONFIG_FILE"); path != "" {
+		return path
+	}
+
+	if _, err := os.Stat(defaultConfigFile); err == nil {
+		return defaultConfigFile
+	}
+
+	return ""
+}
+
+// applyEnv overrides options with values from environment variables that are set.
+func applyEnv(options *Options) []string {
+	var problems []string
+
+	setFromEnv(&options.Authorizer.Address, "ASERTO_AUTHORIZER_SERVICE_URL")
+	setFromEnv(&options.Authorizer.APIKey, "ASERTO_AUTHORIZER_API_KEY")
+	setFromEnv(&options.Authorizer.TenantID, "ASERTO_TENANT_ID")
+	setFromEnv(&options.Authorizer.CACertPath, "ASERTO_AUTHORIZER_GRPC_CA_CERT_PATH", "ASERTO_GRPC_CA_CERT_PATH")
+
+	setFromEnv(&options.Directory.Address, "ASERTO_DIRECTORY_SERVICE_URL")
+	setFromEnv(&options.Directory.APIKey, "ASERTO_DIRECTORY_API_KEY")
+	setFromEnv(&options.Directory.TenantID, "ASERTO_TENANT_ID")
+	setFromEnv(&options.Directory.CACertPath, "ASERTO_DIRECTORY_GRPC_CA_CERT_PATH", "ASERTO_GRPC_CA_CERT_PATH")
+
+	setFromEnv(&options.AuthorizerMode, "TODO_AUTHORIZER_MODE")
+	setFromEnv(&options.DirectoryMode, "TODO_DIRECTORY_MODE")
+
+	setFromEnv(&options.PolicyName, "ASERTO_POLICY_INSTANCE_NAME")
+	setFromEnv(&options.PolicyRoot, "ASERTO_POLICY_ROOT")
+
+	setFromEnv(&options.OidcIssuer, "ISSUER")
+	setFromEnv(&options.OidcAudience, "AUDIENCE")
+	setFromEnv(&options.OidcJwksURL, "JWKS_URL")
+	setFromEnv(&options.OidcClaims.Email, "TODO_OIDC_CLAIM_EMAIL")
+	setFromEnv(&options.OidcClaims.Name, "TODO_OIDC_CLAIM_NAME")
+	setFromEnv(&options.OidcClaims.Groups, "TODO_OIDC_CLAIM_GROUPS")
+	setFromEnv(&options.OidcClaims.Roles, "TODO_OIDC_CLAIM_ROLES")
+	setFromEnv(&options.OidcClaims.Scopes, "TODO_OIDC_CLAIM_SCOPES")
+	problems = append(problems, setBoolFromEnv(&options.OidcRequireScopes, "TODO_OIDC_REQUIRE_SCOPES")...)
+	problems = append(problems, setRouteScopesFromEnv(options.RouteScopes, "TODO_ROUTE_SCOPES")...)
+
+	setFromEnv(&options.DecisionLog.Sink, "TODO_DECISION_LOG_SINK")
+	setFromEnv(&options.DecisionLog.Path, "TODO_DECISION_LOG_PATH")
+	setFromEnv(&options.DecisionLog.URL, "TODO_DECISION_LOG_URL")
+	problems = append(problems, setBoolFromEnv(&options.DecisionLog.IncludeAllowed, "TODO_DECISION_LOG_INCLUDE_ALLOWED")...)
+
+	problems = append(problems, setDurationFromEnv(&options.DecisionCache.TTL, "TODO_DECISION_CACHE_TTL")...)
+	problems = append(problems, setIntFromEnv(&options.DecisionCache.MaxEntries, "TODO_DECISION_CACHE_MAX_ENTRIES")...)
+
+	problems = append(problems, setBoolFromEnv(&options.DevAuth.Enabled, "TODO_DEV_AUTH")...)
+	setFromEnv(&options.DevAuth.KeyPath, "TODO_DEV_AUTH_KEY_PATH")
+	problems = append(problems, setDurationFromEnv(&options.DevAuth.TokenTTL, "TODO_DEV_AUTH_TOKEN_TTL")...)
+
+	problems = append(problems, setBoolFromEnv(&options.Session.Enabled, "TODO_SESSION")...)
+	setFromEnv(&options.Session.AuthorizeURL, "TODO_SESSION_AUTHORIZE_URL")
+	setFromEnv(&options.Session.TokenURL, "TODO_SESSION_TOKEN_URL")
+	setFromEnv(&options.Session.EndSessionURL, "TODO_SESSION_END_SESSION_URL")
+	setFromEnv(&options.Session.ClientID, "TODO_SESSION_CLIENT_ID")
+	setFromEnv(&options.Session.ClientSecret, "TODO_SESSION_CLIENT_SECRET")
+	setFromEnv(&options.Session.RedirectURL, "TODO_SESSION_REDIRECT_URL")
+	setFromEnv(&options.Session.Scopes, "TODO_SESSION_SCOPES")
+	setFromEnv(&options.Session.CookieName, "TODO_SESSION_COOKIE_NAME")
+	problems = append(problems, setBoolFromEnv(&options.Session.CookieSecure, "TODO_SESSION_COOKIE_SECURE")...)
+	problems = append(problems, setDurationFromEnv(&options.Session.TTL, "TODO_SESSION_TTL")...)
+	setFromEnv(&options.Session.SecretKey, "TODO_SESSION_SECRET_KEY")
+
+	setListFromEnv(&options.CORS.AllowedOrigins, "TODO_CORS_ALLOWED_ORIGINS")
+	setListFromEnv(&options.CORS.AllowedMethods, "TODO_CORS_ALLOWED_METHODS")
+	setListFromEnv(&options.CORS.AllowedHeaders, "TODO_CORS_ALLOWED_HEADERS")
+	setListFromEnv(&options.CORS.ExposedHeaders, "TODO_CORS_EXPOSED_HEADERS")
+	problems = append(problems, setBoolFromEnv(&options.CORS.AllowCredentials, "TODO_CORS_ALLOW_CREDENTIALS")...)
+	problems = append(problems, setDurationFromEnv(&options.CORS.MaxAge, "TODO_CORS_MAX_AGE")...)
+
+	problems = append(problems, setBoolFromEnv(&options.RateLimit.Enabled, "TODO_RATE_LIMIT")...)
+	problems = append(problems, setLimitFromEnv(&options.RateLimit.PerIP, "TODO_RATE_LIMIT_PER_IP")...)
+	problems = append(problems, setLimitFromEnv(&options.RateLimit.PerSubject, "TODO_RATE_LIMIT_PER_SUBJECT")...)
+	problems = append(problems, setBoolFromEnv(&options.RateLimit.TrustForwardedFor, "TODO_RATE_LIMIT_TRUST_FORWARDED_FOR")...)
+	problems = append(problems, setIntFromEnv(&options.RateLimit.ForwardedHops, "TODO_RATE_LIMIT_FORWARDED_HOPS")...)
+
+	problems = append(problems, setIntFromEnv(&options.Quota.MaxTodos, "TODO_QUOTA_MAX_TODOS")...)
+	problems = append(problems, setIntFromEnv(&options.Quota.MaxTitleLength, "TODO_QUOTA_MAX_TITLE_LENGTH")...)
+
+	problems = append(problems, setIntFromEnv(&options.Events.History, "TODO_EVENTS_HISTORY")...)
+	problems = append(problems, setIntFromEnv(&options.Events.SubscriberBuffer, "TODO_EVENTS_SUBSCRIBER_BUFFER")...)
+	problems = append(problems, setDurationFromEnv(&options.Events.Heartbeat, "TODO_EVENTS_HEARTBEAT")...)
+
+	problems = append(problems, setDurationFromEnv(&options.Webhooks.Timeout, "TODO_WEBHOOKS_TIMEOUT")...)
+	problems = append(problems, setIntFromEnv(&options.Webhooks.MaxAttempts, "TODO_WEBHOOKS_MAX_ATTEMPTS")...)
+	problems = append(problems, setDurationFromEnv(&options.Webhooks.InitialBackoff, "TODO_WEBHOOKS_INITIAL_BACKOFF")...)
+	problems = append(problems, setDurationFromEnv(&options.Webhooks.MaxBackoff, "TODO_WEBHOOKS_MAX_BACKOFF")...)
+	problems = append(problems, setIntFromEnv(&options.Webhooks.DisableAfter, "TODO_WEBHOOKS_DISABLE_AFTER")...)
+	problems = append(problems, setBoolFromEnv(&options.Webhooks.AllowPrivateNetworks, "TODO_WEBHOOKS_ALLOW_PRIVATE_NETWORKS")...)
+
+	problems = append(problems, setBoolFromEnv(&options.Idempotency.Enabled, "TODO_IDEMPOTENCY")...)
+	problems = append(problems, setDurationFromEnv(&options.Idempotency.TTL, "TODO_IDEMPOTENCY_TTL")...)
+
+	problems = append(problems, setIntFromEnv(&options.MaxBodyBytes, "TODO_MAX_BODY_BYTES")...)
+
+	problems = append(problems, setBoolFromEnv(&options.GRPC.Enabled, "TODO_GRPC")...)
+	setFromEnv(&options.GRPC.ListenAddress, "TODO_GRPC_LISTEN_ADDRESS")
+
+	problems = append(problems, setIntFromEnv(&options.IdentityCache.Size, "TODO_IDENTITY_CACHE_SIZE")...)
+	problems = append(problems, setDurationFromEnv(&options.IdentityCache.TTL, "TODO_IDENTITY_CACHE_TTL")...)
+	problems = append(problems, setDurationFromEnv(&options.IdentityCache.NegativeTTL, "TODO_IDENTITY_CACHE_NEGATIVE_TTL")...)
+
+	if val := getEnv("ASERTO_LOG_LEVEL"); val != "" {
+		level, err := zerolog.ParseLevel(val)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("invalid log level [%s] in ASERTO_LOG_LEVEL", val))
+		} else {
+			options.LogLevel = level
+		}
+	}
+
+	options.Authorizer.CACertPath = os.ExpandEnv(options.Authorizer.CACertPath)
+	options.Directory.CACertPath = os.ExpandEnv(options.Directory.CACertPath)
+
+	return problems
+}
+
+// optionFlag binds a command line flag to an option.
+type optionFlag struct {
+	name  string
+	usage string
+	set   func(options *Options, value string) error
+}
+
+// boolOptionFlags can be set without a value, e.g. --dev-auth.
+var boolOptionFlags = map[string]bool{
+	"dev-auth":            true,
+	"grpc":                true,
+	"oidc-require-scopes": true,
+	"session":             true,
+}
+
+var optionFlagSpecs = []optionFlag{
+	{"authorizer-address", "authorizer service address", func(o *Options, v string) error {
+		o.Authorizer.Address = v
+		return nil
+	}},
+	{"authorizer-ca-cert", "authorizer CA certificate path", func(o *Options, v string) error {
+		o.Authorizer.CACertPath = v
+		return nil
+	}},
+	{"directory-address", "directory service address", func(o *Options, v string) error {
+		o.Directory.Address = v
+		return nil
+	}},
+	{"directory-ca-cert", "directory CA certificate path", func(o *Options, v string) error {
+		o.Directory.CACertPath = v
+		return nil
+	}},
+	{"authorizer-mode", "remote, or local to evaluate authorization rules in-process (development only)", func(o *Options, v string) error {
+		o.AuthorizerMode = v
+		return nil
+	}},
+	{"directory-mode", "remote, or memory to keep the directory in-process (development only)", func(o *Options, v string) error {
+		o.DirectoryMode = v
+		return nil
+	}},
+	{"tenant-id", "Aserto tenant ID", func(o *Options, v string) error {
+		o.Authorizer.TenantID = v
+		o.Directory.TenantID = v
+		return nil
+	}},
+	{"policy-name", "policy instance name", func(o *Options, v string) error {
+		o.PolicyName = v
+		return nil
+	}},
+	{"policy-root", "policy root package", func(o *Options, v string) error {
+		o.PolicyRoot = v
+		return nil
+	}},
+	{"oidc-issuer", "OIDC token issuer", func(o *Options, v string) error {
+		o.OidcIssuer = v
+		return nil
+	}},
+	{"oidc-audience", "OIDC token audience", func(o *Options, v string) error {
+		o.OidcAudience = v
+		return nil
+	}},
+	{"jwks-url", "OIDC JWKS URL", func(o *Options, v string) error {
+		o.OidcJwksURL = v
+		return nil
+	}},
+	{"oidc-require-scopes", "reject JWTs without a scope claim instead of granting them all scopes", func(o *Options, v string) error {
+		required, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.Errorf("invalid boolean [%s] in --oidc-require-scopes", v)
+		}
+		o.OidcRequireScopes = required
+		return nil
+	}},
+	{"decision-log-sink", "where to record authorization decisions (none, log, jsonl, webhook)", func(o *Options, v string) error {
+		o.DecisionLog.Sink = v
+		return nil
+	}},
+	{"decision-log-path", "file that the jsonl decision log sink appends to", func(o *Options, v string) error {
+		o.DecisionLog.Path = v
+		return nil
+	}},
+	{"decision-log-url", "URL that the webhook decision log sink posts to", func(o *Options, v string) error {
+		o.DecisionLog.URL = v
+		return nil
+	}},
+	{"decision-cache-ttl", "how long authorization decisions are cached (0 disables caching)", func(o *Options, v string) error {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			return errors.Errorf("invalid duration [%s] in --decision-cache-ttl", v)
+		}
+		o.DecisionCache.TTL = ttl
+		return nil
+	}},
+	{"dev-auth", "issue and trust development tokens signed by a local key (development only)", func(o *Options, v string) error {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.Errorf("invalid boolean [%s] in --dev-auth", v)
+		}
+		o.DevAuth.Enabled = enabled
+		return nil
+	}},
+	{"session", "enable browser login with the OIDC authorization code flow and session cookies", func(o *Options, v string) error {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.Errorf("invalid boolean [%s] in --session", v)
+		}
+		o.Session.Enabled = enabled
+		return nil
+	}},
+	{"cors-allowed-origins", "comma-separated origins allowed to make cross-origin requests, e.g. https://*.example.com", func(o *Options, v string) error {
+		o.CORS.AllowedOrigins = splitList(v)
+		return nil
+	}},
+	{"grpc", "serve the gRPC API", func(o *Options, v string) error {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.Errorf("invalid boolean [%s] in --grpc", v)
+		}
+		o.GRPC.Enabled = enabled
+		return nil
+	}},
+	{"grpc-listen-address", "host and port that the gRPC API listens on", func(o *Options, v string) error {
+		o.GRPC.ListenAddress = v
+		return nil
+	}},
+	{"log-level", "log level (trace, debug, info, warn, error)", func(o *Options, v string) error {
+		level, err := zerolog.ParseLevel(v)
+		if err != nil {
+			return errors.Errorf("invalid log level [%s] in --log-level", v)
+		}
+		o.LogLevel = level
+		return nil
+	}},
+}
+
+// OptionFlags is a flag set that includes a flag for each option. Commands can register their own flags
+// on it before parsing.
+type OptionFlags struct {
+	*flag.FlagSet
+
+	configFile string
+	values     map[string]*string
+}
+
+func NewOptionFlags(name string) *OptionFlags {
+	flags := &OptionFlags{
+		FlagSet: flag.NewFlagSet(name, flag.ContinueOnError),
+		values:  map[string]*string{},
+	}
+
+	flags.StringVar(&flags.configFile, "config", "", "path to a YAML config file")
+
+	for _, spec := range optionFlagSpecs {
+		value := &optionValue{isBool: boolOptionFlags[spec.name]}
+		flags.Var(value, spec.name, spec.usage)
+		flags.values[spec.name] = &value.value
+	}
+
+	return flags
+}
+
+// optionValue holds the raw value of an option flag until it is applied.
+type optionValue struct {
+	value  string
+	isBool bool
+}
+
+func (v *optionValue) String() string { return v.value }
+
+func (v *optionValue) Set(s string) error {
+	v.value = s
+	return nil
+}
+
+// IsBoolFlag lets boolean flags be set without a value.
+func (v *optionValue) IsBoolFlag() bool { return v.isBool }
+
+// apply overrides options with the values of flags that were explicitly set.
+func (f *OptionFlags) apply(options *Options) []string {
+	var problems []string
+
+	f.Visit(func(fl *flag.Flag) {
+		for _, spec := range optionFlagSpecs {
+			if spec.name != fl.Name {
+				continue
+			}
+
+			if err := spec.set(options, *f.values[spec.name]); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+	})
+
+	return problems
+}
+
+// NonProduction returns a warning for each development-only mode that is enabled.
+func (o *Options) NonProduction() []string {
+	var warnings []string
+
+	if o.AuthorizerMode == ModeLocal {
+		warnings = append(warnings, "local authorizer: authorization rules are evaluated in-process, not by the todo policy")
+	}
+
+	if o.DirectoryMode == ModeMemory {
+		warnings = append(warnings, "in-memory directory: users and relations are lost when the server stops")
+	}
+
+	if o.DevAuth.Enabled {
+		warnings = append(warnings, "development auth: anyone can mint tokens at "+devauth.TokenPath)
+	}
+
+	if o.Webhooks.AllowPrivateNetworks {
+		warnings = append(warnings, "webhooks on private networks: users can make the server send requests to internal services")
+	}
+
+	if o.Session.Enabled && o.Session.SecretKey == "" {
+		warnings = append(warnings, "random session key: browser sessions are lost when the server restarts")
+	}
+
+	return warnings
+}
+
+// Redacted returns a copy of the options with secrets masked, suitable for display.
+func (o *Options) Redacted() *Options {
+	redacted := *o
+
+	authorizer := *o.Authorizer
+	authorizer.APIKey = redact(authorizer.APIKey)
+	authorizer.Token = redact(authorizer.Token)
+	redacted.Authorizer = &authorizer
+
+	dirConfig := *o.Directory.Config
+	dirConfig.APIKey = redact(dirConfig.APIKey)
+	dirConfig.Token = redact(dirConfig.Token)
+	redacted.Directory = &ds.Config{Config: &dirConfig}
+
+	decisionLog := *o.DecisionLog
+	decisionLog.URL = redactURL(decisionLog.URL)
+	redacted.DecisionLog = &decisionLog
+
+	sessionConfig := *o.Session
+	sessionConfig.ClientSecret = redact(sessionConfig.ClientSecret)
+	sessionConfig.SecretKey = redact(sessionConfig.SecretKey)
+	redacted.Session = &sessionConfig
+
+	return &redacted
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+
+	return "********"
+}
+
+// redactURL masks the password of a URL's user info, which may carry webhook credentials.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "********")
+	}
+
+	return u.String()
+}
+
+// ValidationError lists every problem found in a set of options.
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e, "\n  - ")
+}
+
+func (e *ValidationError) add(problems []string) {
+	*e = append(*e, problems...)
+}
+
 func loadEnv() error {
 	if _, err := os.Stat(".env"); errors.Is(err, os.ErrNotExist) {
 		return nil
@@ -86,11 +726,125 @@ func initLogging(level zerolog.Level) {
 	zerolog.SetGlobalLevel(level)
 }
 
-func getEnvOr(v, defaultValue string) string {
+// setFromEnv sets target to the value of the first non-empty environment variable in vars.
+func setFromEnv(target *string, vars ...string) {
+	if val := getEnv(vars...); val != "" {
+		*target = val
+	}
+}
+
+// setListFromEnv sets target to the comma-separated values of the environment variable v, if set.
+func setListFromEnv(target *[]string, v string) {
 	if val := os.Getenv(v); val != "" {
-		return val
+		*target = splitList(val)
+	}
+}
+
+// splitList splits a comma-separated list, dropping empty items.
+func splitList(val string) []string {
+	var items []string
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
-	return defaultValue
+
+	return items
+}
+
+// setBoolFromEnv sets target to the boolean value of the environment variable v, if set.
+func setBoolFromEnv(target *bool, v string) []string {
+	val := os.Getenv(v)
+	if val == "" {
+		return nil
+	}
+
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return []string{fmt.Sprintf("invalid boolean [%s] in %s", val, v)}
+	}
+
+	*target = b
+
+	return nil
+}
+
+// setDurationFromEnv sets target to the duration value of the environment variable v, if set.
+func setDurationFromEnv(target *time.Duration, v string) []string {
+	val := os.Getenv(v)
+	if val == "" {
+		return nil
+	}
+
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return []string{fmt.Sprintf("invalid duration [%s] in %s", val, v)}
+	}
+
+	*target = d
+
+	return nil
+}
+
+// setLimitFromEnv sets target to the rate limit in the environment variable v, if set.
+func setLimitFromEnv(target *ratelimit.Limit, v string) []string {
+	val := os.Getenv(v)
+	if val == "" {
+		return nil
+	}
+
+	limit, err := ratelimit.ParseLimit(val)
+	if err != nil {
+		return []string{fmt.Sprintf("%s in %s", err, v)}
+	}
+
+	*target = limit
+
+	return nil
+}
+
+// setRouteScopesFromEnv sets the scopes of the routes in the environment variable v, if set, and leaves
+// other routes alone. Routes are separated by semicolons and scopes by commas, e.g.
+// "GET /v1/events=todos:read;POST /v1/todos=todos:read,todos:write".
+func setRouteScopesFromEnv(target map[string][]string, v string) []string {
+	val := os.Getenv(v)
+	if val == "" {
+		return nil
+	}
+
+	var problems []string
+	for _, entry := range strings.Split(val, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		route, scopes, ok := strings.Cut(entry, "=")
+		if !ok {
+			problems = append(problems, fmt.Sprintf("route scopes [%s] in %s must look like \"POST /v1/todos=todos:write\"", entry, v))
+			continue
+		}
+
+		target[strings.TrimSpace(route)] = splitList(scopes)
+	}
+
+	return problems
+}
+
+// setIntFromEnv sets target to the integer value of the environment variable v, if set.
+func setIntFromEnv(target *int, v string) []string {
+	val := os.Getenv(v)
+	if val == "" {
+		return nil
+	}
+
+	i, err := strconv.Atoi(val)
+	if err != nil {
+		return []string{fmt.Sprintf("invalid integer [%s] in %s", val, v)}
+	}
+
+	*target = i
+
+	return nil
 }
 
 func getEnv(vars ...string) string {
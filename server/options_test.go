@@ -0,0 +1,52 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"todo-go/identity"
+)
+
+func TestRouteScopes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	config := "route_scopes:\n  GET /v1/events: [todos:read, todos:write]\n  GET /v1/me/usage: []\n"
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	options := defaultOptions()
+	if problems, err := loadConfigFile(path, options); err != nil || len(problems) > 0 {
+		t.Fatalf("failed to load config file: %v %v", err, problems)
+	}
+
+	t.Setenv("TODO_ROUTE_SCOPES", "POST /v1/todos=todos:read, todos:write;")
+	if problems := applyEnv(options); len(problems) > 0 {
+		t.Fatalf("failed to apply environment: %v", problems)
+	}
+
+	for route, want := range map[string][]string{
+		"GET /v1/events":   identity.KnownScopes,
+		"GET /v1/me/usage": {},
+		"POST /v1/todos":   identity.KnownScopes,
+		"GET /v1/todos":    {identity.ScopeRead},
+	} {
+		if got := options.RouteScopes[route]; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got scopes %v, want %v", route, got, want)
+		}
+	}
+
+	if problems := validateRouteScopes(options.RouteScopes); len(problems) > 0 {
+		t.Errorf("valid route scopes have problems: %v", problems)
+	}
+
+	problems := validateRouteScopes(map[string][]string{
+		"GET /v1/todo":  {identity.ScopeRead},
+		"GET /v1/todos": {"todos:admin"},
+	})
+	if len(problems) != 2 || !strings.Contains(problems[0], "todos:admin") || !strings.Contains(problems[1], "GET /v1/todo]") {
+		t.Errorf("got problems %v, want an unknown route and an unknown scope", problems)
+	}
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"todo-go/directory"
+	"todo-go/identity"
+	"todo-go/quota"
+	"todo-go/store"
+	"todo-go/validation"
+
+	dsc "github.com/aserto-dev/go-directory/aserto/directory/common/v3"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// usage reports one quota. A nil limit is unlimited.
+type usage struct {
+	Used  int  `json:"used"`
+	Limit *int `json:"limit"`
+}
+
+// GetUsage reports the caller's usage against their quotas.
+func (s *Server) GetUsage(w http.ResponseWriter, r *http.Request) {
+	caller, user, err := s.callerUser(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limits := s.quotaFor(r.Context(), caller, user)
+
+	count, err := s.Store.CountTodos(user.Id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"todos":          usage{Used: count, Limit: limitOrNil(limits.MaxTodos)},
+		"maxTitleLength": limitOrNil(limits.MaxTitleLength),
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
+// callerUser returns the caller and their directory user.
+func (s *Server) callerUser(ctx context.Context) (*identity.Principal, *dsc.Object, error) {
+	caller := identity.FromContext(ctx)
+	if caller == nil {
+		return nil, nil, errors.New("context does not contain a subject value")
+	}
+
+	user, err := s.Directory.UserFromIdentity(ctx, caller.Subject)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return caller, user, nil
+}
+
+// quotaFor returns the limits that apply to user, taking overrides from the user and from the caller's
+// groups into account. Title lengths are capped at maxTitleLength even if the quota is unlimited or higher.
+func (s *Server) quotaFor(ctx context.Context, caller *identity.Principal, user *dsc.Object) quota.Config {
+	var groups []*structpb.Struct
+
+	for _, groupID := range caller.Groups {
+		group, err := s.Directory.GetGroup(ctx, groupID)
+		switch {
+		case err == nil:
+			groups = append(groups, group.Properties)
+		case errors.Is(err, directory.ErrNotFound):
+		default:
+			log.Warn().Err(err).Str("group", groupID).Msg("ignoring group quota overrides")
+		}
+	}
+
+	limits := s.options.Quota.Resolve(user.Properties, groups...)
+	if limits.MaxTitleLength == 0 || limits.MaxTitleLength > maxTitleLength {
+		limits.MaxTitleLength = maxTitleLength
+	}
+
+	return limits
+}
+
+// checkTitle returns a validation error if title exceeds the title length limit.
+func checkTitle(limits quota.Config, title string) error {
+	if !limits.TitleFits(title) {
+		return validation.Fields(validation.FieldError{
+			Field:   "title",
+			Code:    "max",
+			Message: fmt.Sprintf("title must have at most %d characters", limits.MaxTitleLength),
+		})
+	}
+
+	return nil
+}
+
+// quotaError is returned when a user already owns as many todos as they may.
+type quotaError struct {
+	limit int
+}
+
+func (e *quotaError) Error() string {
+	return fmt.Sprintf("todo quota exceeded: at most %d todos are allowed", e.limit)
+}
+
+// storeQuotaError returns a quotaError for store.ErrTodoLimit, and other errors as they are.
+func storeQuotaError(err error, limit int) error {
+	if errors.Is(err, store.ErrTodoLimit) {
+		return &quotaError{limit: limit}
+	}
+
+	return err
+}
+
+func limitOrNil(limit int) *int {
+	if limit == 0 {
+		return nil
+	}
+
+	return &limit
+}
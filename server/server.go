@@ -3,15 +3,16 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"net"
 	"net/http"
 	"time"
 
-	"todo-go/directory"
+	"todo-go/cors"
+	"todo-go/events"
 	"todo-go/identity"
 	"todo-go/store"
 
 	dsc "github.com/aserto-dev/go-directory/aserto/directory/common/v3"
-	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
@@ -19,26 +20,28 @@ import (
 
 const listenAddr = "0.0.0.0:3001"
 
+// localURL returns the URL of path on this server, as reachable from the local host.
+func localURL(path string) string {
+	_, port, _ := net.SplitHostPort(listenAddr)
+	return "http://127.0.0.1:" + port + path
+}
+
 type Server struct {
 	Store     *store.Store
-	Directory *directory.Directory
-
-	srv *http.Server
+	Directory Directory
+	// Events publishes changes to todos.
+	Events *events.Hub
+	// AuthorizeTodo decides the actions that callers may take on the todos in responses, and the todo events
+	// they receive. Without it, todos are reported without permissions and no events are streamed.
+	AuthorizeTodo TodoAuthorizer
+
+	options *Options
+	srv     *http.Server
 }
 
-func New(options *Options) (*Server, error) {
-	// Initialize the Todo Store
-	db, err := store.NewStore()
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to create store")
-	}
-
-	// Create a directory client
-	dir, err := directory.NewDirectory(options.Directory)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to create directory connection")
-	}
-
+// New creates a server that uses the given store and directory. The server takes ownership of both
+// and closes them in Close.
+func New(options *Options, db *store.Store, dir Directory) *Server {
 	srv := &http.Server{
 		Addr:              listenAddr,
 		ReadTimeout:       1 * time.Second,
@@ -47,13 +50,18 @@ func New(options *Options) (*Server, error) {
 		ReadHeaderTimeout: 2 * time.Second,
 	}
 
-	return &Server{Store: db, Directory: dir, srv: srv}, nil
+	hub := events.NewHub(options.Events)
+
+	// Event streams never go idle, so they must end for the server to shut down.
+	srv.RegisterOnShutdown(hub.Close)
+
+	return &Server{Store: db, Directory: dir, Events: hub, options: options, srv: srv}
 }
 
 func (s *Server) Start(handler http.Handler) {
 	log.Info().Str("listen_address", listenAddr).Msg("starting server")
 
-	s.srv.Handler = cors(handler)
+	s.srv.Handler = cors.New(s.options.CORS).Handler(limitBody(s.options.MaxBodyBytes, handler))
 
 	if err := s.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatal().Err(err).Msg("listen error")
@@ -81,6 +89,24 @@ func (s *Server) Close() {
 	}
 }
 
+// Health reports that the server is up, along with the authorizer and directory modes in use.
+// Development-only modes are flagged as non-production.
+func (s *Server) Health(w http.ResponseWriter, r *http.Request) {
+	warnings := s.options.NonProduction()
+
+	w.Header().Add("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":        "ok",
+		"authorizer":    s.options.AuthorizerMode,
+		"directory":     s.options.DirectoryMode,
+		"nonProduction": len(warnings) > 0,
+		"warnings":      warnings,
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
 func (s *Server) GetUser(w http.ResponseWriter, r *http.Request) {
 	userID := mux.Vars(r)["userID"]
 
@@ -100,11 +126,9 @@ func (s *Server) GetUser(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) GetTodos(w http.ResponseWriter, r *http.Request) {
-	var todos []store.Todo
-
-	todos, err := s.Store.GetTodos()
+	todos, err := s.listTodos(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, err)
 		return
 	}
 
@@ -118,106 +142,84 @@ func (s *Server) GetTodos(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) InsertTodo(w http.ResponseWriter, r *http.Request) {
-	var todo store.Todo
-	jsonErr := json.NewDecoder(r.Body).Decode(&todo)
-	if jsonErr != nil {
-		http.Error(w, jsonErr.Error(), http.StatusBadRequest)
+	var req todoRequest
+	if !decodeRequest(w, r, &req) {
 		return
 	}
 
-	ownerIdentity := identity.ExtractSubject(r.Context())
-	if ownerIdentity == "" {
-		http.Error(w, "context does not contain a subject value", http.StatusExpectationFailed)
+	todo, err := s.createTodo(r.Context(), &req)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 
-	owner, err := s.Directory.UserFromIdentity(r.Context(), ownerIdentity)
-	if err != nil {
+	w.Header().Add("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(todo); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	todo.ID = uuid.New().String()
-	todo.OwnerID = owner.Id
+}
 
-	if err := s.Store.InsertTodo(&todo); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+func (s *Server) UpdateTodo(w http.ResponseWriter, r *http.Request) {
+	var req todoRequest
+	if !decodeRequest(w, r, &req) {
 		return
 	}
 
-	if err := s.Directory.AddTodo(r.Context(), &todo); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	todo, err := s.updateTodo(r.Context(), mux.Vars(r)["id"], &req)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 
+	w.Header().Add("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(todo); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 }
 
-func (s *Server) UpdateTodo(w http.ResponseWriter, r *http.Request) {
-	var todo store.Todo
-	if err := json.NewDecoder(r.Body).Decode(&todo); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+func (s *Server) DeleteTodo(w http.ResponseWriter, r *http.Request) {
+	if err := s.deleteTodo(r.Context(), mux.Vars(r)["id"]); err != nil {
+		writeError(w, err)
 		return
 	}
 
-	todo.ID = mux.Vars(r)["id"]
-
-	if err := s.Store.UpdateTodo(&todo); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
+	w.WriteHeader(200)
+}
 
-	if err := json.NewEncoder(w).Encode(todo); err != nil {
+func (s *Server) IdentityCacheStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.Directory.IdentityCacheStats()); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 }
 
-func (s *Server) DeleteTodo(w http.ResponseWriter, r *http.Request) {
-	id := mux.Vars(r)["id"]
-	if err := s.Directory.DeleteTodo(r.Context(), id); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
+func (s *Server) FlushIdentityCache(w http.ResponseWriter, r *http.Request) {
+	flushed := s.Directory.FlushIdentityCache()
+	log.Info().Int("entries", flushed).Msg("identity cache flushed")
 
-	if err := s.Store.DeleteTodo(id); err != nil {
+	w.Header().Add("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]int{"flushed": flushed}); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	w.WriteHeader(200)
 }
 
 func (s *Server) getUser(ctx context.Context, userID string) (*dsc.Object, error) {
-	callerPID := identity.ExtractSubject(ctx)
-	if callerPID == "" {
+	caller := identity.FromContext(ctx)
+	if caller == nil {
 		return nil, errors.New("missing caller identity in request context")
 	}
 
-	if userID == callerPID {
+	if userID == caller.Subject {
 		return s.Directory.UserFromIdentity(ctx, userID)
 	}
 
 	return s.Directory.GetUser(ctx, userID)
 }
 
-func cors(h http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		origin := r.Header.Get("Origin")
-		w.Header().Set("Access-Control-Allow-Origin", origin)
-		if r.Method == "OPTIONS" {
-			w.Header().Set("Access-Control-Allow-Credentials", "true")
-			w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,DELETE")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-CSRF-Token, Authorization")
-			return
-		}
-
-		h.ServeHTTP(w, r)
-	})
-}
-
 func userAsMap(user *dsc.Object) map[string]interface{} {
 	userMap := user.Properties.AsMap()
 	userMap["key"] = user.Id
@@ -0,0 +1,370 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"todo-go/directory"
+	"todo-go/identity"
+	"todo-go/store"
+	"todo-go/validation"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	rick  = "rick@the-citadel.com"
+	morty = "morty@the-citadel.com"
+)
+
+// newTestServer returns a server backed by an in-memory store and directory, with two users who may create
+// todos.
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	db, err := store.NewMemoryStore()
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	dir, _ := directory.NewMemoryDirectory(&directory.IdentityCacheConfig{})
+
+	for _, user := range []directory.User{
+		{ID: rick, DisplayName: "Rick Sanchez", Identity: rick, Creator: true},
+		{ID: morty, DisplayName: "Morty Smith", Identity: morty, Creator: true},
+	} {
+		if err := dir.AddUser(context.Background(), &user); err != nil {
+			t.Fatalf("failed to add user [%s]: %v", user.ID, err)
+		}
+	}
+
+	srv := New(defaultOptions(), db, dir)
+	srv.AuthorizeTodo = ownerPolicy(dir)
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+// ownerPolicy authorizes like the default policy, under which users may read and create todos, and owners may
+// update and delete theirs.
+func ownerPolicy(dir Directory) TodoAuthorizer {
+	return func(ctx context.Context, action TodoAction, id string) (bool, error) {
+		if action == TodoRead || action == TodoCreate {
+			return true, nil
+		}
+
+		owned, err := dir.OwnedTodoIDs(ctx, identity.FromContext(ctx).Subject)
+		return owned[id], err
+	}
+}
+
+// serve calls handler with a request from subject and returns the response.
+func serve(handler http.HandlerFunc, subject, method, target, body string, vars map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r = r.WithContext(identity.WithPrincipal(r.Context(), &identity.Principal{Subject: subject}))
+
+	if vars != nil {
+		r = mux.SetURLVars(r, vars)
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	return w
+}
+
+func decode[T any](t *testing.T, w *httptest.ResponseRecorder) T {
+	t.Helper()
+
+	var v T
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+		t.Fatalf("failed to decode response [%s]: %v", w.Body.String(), err)
+	}
+
+	return v
+}
+
+func createTestTodo(t *testing.T, srv *Server, subject, body string) *todoResponse {
+	t.Helper()
+
+	w := serve(srv.InsertTodo, subject, "POST", "/v1/todos", body, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create: got status %d: %s", w.Code, w.Body.String())
+	}
+
+	return decode[*todoResponse](t, w)
+}
+
+func listTestTodos(t *testing.T, srv *Server, subject string) []*todoResponse {
+	t.Helper()
+
+	w := serve(srv.GetTodos, subject, "GET", "/v1/todos", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("list: got status %d: %s", w.Code, w.Body.String())
+	}
+
+	return decode[[]*todoResponse](t, w)
+}
+
+func TestCreateAndListTodos(t *testing.T) {
+	srv := newTestServer(t)
+
+	created := createTestTodo(t, srv, rick, `{"title": "Build a portal gun", "dueAt": "2026-11-01T09:00:00+02:00"}`)
+
+	switch {
+	case created.ID == "":
+		t.Error("created todo has no ID")
+	case created.OwnerID != rick || created.OwnerName != "Rick Sanchez":
+		t.Errorf("got owner [%s] [%s], want the caller", created.OwnerID, created.OwnerName)
+	case created.DueAt == nil || created.DueAt.Format("2006-01-02T15:04:05Z07:00") != "2026-11-01T07:00:00Z":
+		t.Errorf("got due date %v, want it in UTC", created.DueAt)
+	case !created.Permissions.Update || !created.Permissions.Delete:
+		t.Errorf("owner can't change their todo: %+v", created.Permissions)
+	}
+
+	todos := listTestTodos(t, srv, morty)
+	if len(todos) != 1 || todos[0].ID != created.ID {
+		t.Fatalf("got %d todos, want the created one", len(todos))
+	}
+
+	if todos[0].Permissions.Update || todos[0].Permissions.Delete {
+		t.Errorf("non-owner may change the todo: %+v", todos[0].Permissions)
+	}
+}
+
+func TestTodoPermissionsFollowPolicy(t *testing.T) {
+	srv := newTestServer(t)
+	created := createTestTodo(t, srv, rick, `{"title": "Build a portal gun"}`)
+
+	// The policy lets anyone update todos, but only admins delete them.
+	srv.AuthorizeTodo = func(_ context.Context, action TodoAction, _ string) (bool, error) {
+		return action == TodoUpdate, nil
+	}
+
+	todos := listTestTodos(t, srv, morty)
+	if len(todos) != 1 || !todos[0].Permissions.Update || todos[0].Permissions.Delete {
+		t.Errorf("got todos %+v, want the policy's permissions", todos)
+	}
+
+	// Permissions are hints, so failed decisions deny them without failing the request.
+	srv.AuthorizeTodo = func(context.Context, TodoAction, string) (bool, error) {
+		return true, errors.New("authorizer unavailable")
+	}
+
+	w := serve(srv.GetTodos, rick, "GET", "/v1/todos", "", nil)
+	if todos := decode[[]*todoResponse](t, w); w.Code != http.StatusOK || todos[0].ID != created.ID ||
+		todos[0].Permissions.Update || todos[0].Permissions.Delete {
+		t.Errorf("got status %d and todos %+v, want the todo without permissions", w.Code, todos)
+	}
+}
+
+func TestCreateTodoValidation(t *testing.T) {
+	srv := newTestServer(t)
+
+	for _, tc := range []struct {
+		name  string
+		body  string
+		field string
+	}{
+		{"missing title", `{"completed": true}`, "title"},
+		{"blank title", `{"title": "  "}`, "title"},
+		{"server-assigned ID", `{"id": "x", "title": "Buy milk"}`, "id"},
+		{"wrong type", `{"title": 5}`, "title"},
+		{"unknown field", `{"title": "Buy milk", "notes": ""}`, "notes"},
+		{"invalid due date", `{"title": "Buy milk", "dueAt": "tomorrow"}`, "dueAt"},
+		{"long title", `{"title": "` + strings.Repeat("a", 1025) + `"}`, "title"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := serve(srv.InsertTodo, rick, "POST", "/v1/todos", tc.body, nil)
+			if w.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("got status %d, want 422: %s", w.Code, w.Body.String())
+			}
+
+			resp := decode[struct {
+				Fields []struct{ Field string }
+			}](t, w)
+
+			if len(resp.Fields) != 1 || resp.Fields[0].Field != tc.field {
+				t.Errorf("got fields %+v, want [%s]", resp.Fields, tc.field)
+			}
+		})
+	}
+
+	if todos := listTestTodos(t, srv, rick); len(todos) != 0 {
+		t.Errorf("invalid requests created %d todos", len(todos))
+	}
+}
+
+func TestTitleLengthCeiling(t *testing.T) {
+	srv := newTestServer(t)
+	srv.options.Quota.MaxTitleLength = 0
+
+	createTestTodo(t, srv, rick, `{"title": "`+strings.Repeat("a", 1024)+`"}`)
+
+	w := serve(srv.InsertTodo, rick, "POST", "/v1/todos", `{"title": "`+strings.Repeat("a", 1025)+`"}`, nil)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("create with an unlimited quota and a long title: got status %d, want 422", w.Code)
+	}
+
+	w = serve(srv.GetUsage, rick, "GET", "/v1/me/usage", "", nil)
+	if usage := decode[struct{ MaxTitleLength int }](t, w); usage.MaxTitleLength != 1024 {
+		t.Errorf("got max title length %d, want the ceiling", usage.MaxTitleLength)
+	}
+}
+
+func TestUpdateTodo(t *testing.T) {
+	srv := newTestServer(t)
+
+	created := createTestTodo(t, srv, rick, `{"title": "Buy milk", "dueAt": "2026-11-01T09:00:00Z"}`)
+	vars := map[string]string{"id": created.ID}
+
+	w := serve(srv.UpdateTodo, rick, "PUT", "/v1/todos/"+created.ID, `{"title": "Buy bread", "completed": true}`, vars)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: got status %d: %s", w.Code, w.Body.String())
+	}
+
+	updated := decode[*todoResponse](t, w)
+	if updated.Title != "Buy bread" || !updated.Completed || updated.DueAt != nil || updated.OwnerID != rick {
+		t.Errorf("got %+v, want the new title and completion, no due date and the same owner", updated)
+	}
+
+	stored, err := srv.Store.GetTodo(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored.Sequence != 1 {
+		t.Errorf("got sequence %d after one update, want 1", stored.Sequence)
+	}
+
+	w = serve(srv.UpdateTodo, rick, "PUT", "/v1/todos/missing", `{"title": "Buy bread"}`, map[string]string{"id": "missing"})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("update of a missing todo: got status %d, want 404", w.Code)
+	}
+
+	w = serve(srv.UpdateTodo, rick, "PUT", "/v1/todos/"+created.ID, `{"title": ""}`, vars)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("invalid update: got status %d, want 422", w.Code)
+	}
+}
+
+func TestDeleteTodo(t *testing.T) {
+	srv := newTestServer(t)
+
+	kept := createTestTodo(t, srv, rick, `{"title": "Build a portal gun"}`)
+	deleted := createTestTodo(t, srv, rick, `{"title": "Pick up Morty from school"}`)
+
+	w := serve(srv.DeleteTodo, rick, "DELETE", "/v1/todos/"+deleted.ID, "", map[string]string{"id": deleted.ID})
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete: got status %d: %s", w.Code, w.Body.String())
+	}
+
+	todos := listTestTodos(t, srv, rick)
+	if len(todos) != 1 || todos[0].ID != kept.ID {
+		t.Fatalf("got %d todos after delete, want only the other one", len(todos))
+	}
+
+	owned, err := srv.Directory.OwnedTodoIDs(context.Background(), rick)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if owned[deleted.ID] || !owned[kept.ID] {
+		t.Errorf("got owned todos %v, want the owner relation of the deleted todo removed", owned)
+	}
+}
+
+func TestCreateTodoQuota(t *testing.T) {
+	srv := newTestServer(t)
+	srv.options.Quota.MaxTodos = 1
+
+	createTestTodo(t, srv, rick, `{"title": "Build a portal gun"}`)
+
+	w := serve(srv.InsertTodo, rick, "POST", "/v1/todos", `{"title": "Pick up Morty from school"}`, nil)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("create over quota: got status %d, want 403", w.Code)
+	}
+
+	// Quotas are per owner.
+	createTestTodo(t, srv, morty, `{"title": "Finish homework"}`)
+}
+
+func TestQuotasAreOptIn(t *testing.T) {
+	srv := newTestServer(t)
+
+	// Titles that were allowed before quotas existed are still allowed, up to the ceiling.
+	createTestTodo(t, srv, rick, `{"title": "`+strings.Repeat("a", maxTitleLength)+`"}`)
+
+	w := serve(srv.GetUsage, rick, "GET", "/v1/me/usage", "", nil)
+	if usage := decode[struct{ Todos struct{ Limit *int } }](t, w); usage.Todos.Limit != nil {
+		t.Errorf("got a todo limit of %d by default, want none", *usage.Todos.Limit)
+	}
+}
+
+func TestCreateTodoQuotaConcurrently(t *testing.T) {
+	srv := newTestServer(t)
+	srv.options.Quota.MaxTodos = 3
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serve(srv.InsertTodo, rick, "POST", "/v1/todos", `{"title": "Buy milk"}`, nil)
+		}()
+	}
+	wg.Wait()
+
+	if count, err := srv.Store.CountTodos(rick); err != nil || count != 3 {
+		t.Errorf("got %d todos (%v), want the quota of 3", count, err)
+	}
+}
+
+func TestBatchTodosQuota(t *testing.T) {
+	srv := newTestServer(t)
+
+	existing := createTestTodo(t, srv, rick, `{"title": "Build a portal gun"}`)
+
+	// The batch was checked against the quota before another request created a todo.
+	batch := &store.TodoBatch{Inserts: []store.Todo{{ID: "new", OwnerID: rick, Title: "Buy milk"}}, MaxTodos: 2}
+	createTestTodo(t, srv, rick, `{"title": "Buy bread"}`)
+
+	if err := srv.Store.ApplyTodoBatch(batch); !errors.Is(err, store.ErrTodoLimit) {
+		t.Fatalf("got %v, want ErrTodoLimit", err)
+	}
+
+	if todo, err := srv.Store.GetTodo("new"); err != nil || todo != nil {
+		t.Errorf("batch over quota was applied: %+v %v", todo, err)
+	}
+
+	// Deleting in the same batch makes room.
+	batch.Deletes = []string{existing.ID}
+	if err := srv.Store.ApplyTodoBatch(batch); err != nil {
+		t.Errorf("batch within quota: %v", err)
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want int
+	}{
+		{validation.Fields(validation.FieldError{Field: "title"}), http.StatusUnprocessableEntity},
+		{&quotaError{limit: 1}, http.StatusForbidden},
+		{errNotAuthorized, http.StatusForbidden},
+		{errDuplicateOperation, http.StatusConflict},
+		{errTodoNotFound, http.StatusNotFound},
+		// Backend failures must not be stored as idempotent responses.
+		{errors.New("database is locked"), http.StatusInternalServerError},
+	} {
+		if got := httpStatus(tc.err); got != tc.want {
+			t.Errorf("%v: got status %d, want %d", tc.err, got, tc.want)
+		}
+	}
+}
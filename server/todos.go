@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"todo-go/directory"
+	"todo-go/events"
+	"todo-go/store"
+	"todo-go/validation"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// The operations in this file are shared by the HTTP handlers and the gRPC service. Authorization happens
+// before they are called.
+
+var (
+	// errTodoNotFound is returned when a todo doesn't exist.
+	errTodoNotFound = errors.New("todo not found")
+	// errUserNotFound is returned when a todo is shared with a user who isn't in the directory.
+	errUserNotFound = errors.New("user not found")
+)
+
+// listTodos returns all todos, as seen by the caller.
+func (s *Server) listTodos(ctx context.Context) ([]*todoResponse, error) {
+	if _, _, err := s.callerUser(ctx); err != nil {
+		return nil, err
+	}
+
+	todos, err := s.Store.GetTodos()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.todoResponses(ctx, todos), nil
+}
+
+// getTodo returns the todo with the given ID, as seen by the caller.
+func (s *Server) getTodo(ctx context.Context, id string) (*todoResponse, error) {
+	if _, _, err := s.callerUser(ctx); err != nil {
+		return nil, err
+	}
+
+	todo, err := s.Store.GetTodo(id)
+	switch {
+	case err != nil:
+		return nil, err
+	case todo == nil:
+		return nil, errTodoNotFound
+	}
+
+	return s.todoResponse(ctx, todo), nil
+}
+
+// createTodo creates a todo owned by the caller, within their quotas.
+func (s *Server) createTodo(ctx context.Context, req *todoRequest) (*todoResponse, error) {
+	caller, owner, err := s.callerUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := s.quotaFor(ctx, caller, owner)
+	if err := checkTitle(limits, req.Title); err != nil {
+		return nil, err
+	}
+
+	todo := req.toTodo(uuid.New().String(), owner.Id)
+
+	if err := s.Store.InsertTodoWithinLimit(&todo, limits.MaxTodos); err != nil {
+		return nil, storeQuotaError(err, limits.MaxTodos)
+	}
+
+	if err := s.Directory.AddTodo(ctx, &todo); err != nil {
+		return nil, err
+	}
+
+	resp := toTodoResponse(&todo, owner.DisplayName, s.todoPermissions(ctx, []store.Todo{todo})[0])
+	s.publish(events.TodoCreated, resp.ID, toTodoEvent(resp))
+
+	return resp, nil
+}
+
+// updateTodo replaces the title, completion and due date of the todo with the given ID.
+func (s *Server) updateTodo(ctx context.Context, id string, req *todoRequest) (*todoResponse, error) {
+	caller, user, err := s.callerUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkTitle(s.quotaFor(ctx, caller, user), req.Title); err != nil {
+		return nil, err
+	}
+
+	previous, err := s.Store.GetTodo(id)
+	switch {
+	case err != nil:
+		return nil, err
+	case previous == nil:
+		return nil, errTodoNotFound
+	}
+
+	todo := req.toTodo(id, "")
+	if err := s.Store.UpdateTodo(&todo); err != nil {
+		return nil, err
+	}
+
+	updated, err := s.Store.GetTodo(id)
+	switch {
+	case err != nil:
+		return nil, err
+	case updated == nil:
+		return nil, errTodoNotFound
+	}
+
+	resp := s.todoResponse(ctx, updated)
+
+	s.publish(events.TodoUpdated, id, toTodoEvent(resp))
+	if resp.Completed && !previous.Completed {
+		s.publish(events.TodoCompleted, id, toTodoEvent(resp))
+	}
+
+	return resp, nil
+}
+
+// deleteTodo deletes the todo with the given ID and its relations.
+func (s *Server) deleteTodo(ctx context.Context, id string) error {
+	if err := s.Directory.DeleteTodo(ctx, id); err != nil {
+		return err
+	}
+
+	if err := s.Store.DeleteTodo(id); err != nil {
+		return err
+	}
+
+	s.publish(events.TodoDeleted, id, map[string]string{"id": id})
+
+	return nil
+}
+
+// shareTodo makes the user with the given ID an owner of the todo.
+func (s *Server) shareTodo(ctx context.Context, id, userID string) error {
+	todo, err := s.Store.GetTodo(id)
+	switch {
+	case err != nil:
+		return err
+	case todo == nil:
+		return errTodoNotFound
+	}
+
+	_, err = s.Directory.GetUser(ctx, userID)
+	switch {
+	case errors.Is(err, directory.ErrNotFound):
+		return errors.Wrapf(errUserNotFound, "can't share with [%s]", userID)
+	case err != nil:
+		return err
+	}
+
+	return s.Directory.ShareTodo(ctx, id, userID)
+}
+
+// httpStatus returns the HTTP status that reports err. Errors that aren't the client's fault, such as store
+// and directory failures, are reported as 500, so that retries reach the server instead of a stored response.
+func httpStatus(err error) int {
+	var invalid *validation.Error
+	var quotaErr *quotaError
+
+	switch {
+	case errors.As(err, &invalid):
+		return http.StatusUnprocessableEntity
+	case errors.As(err, &quotaErr), errors.Is(err, errNotAuthorized):
+		return http.StatusForbidden
+	case errors.Is(err, errDuplicateOperation):
+		return http.StatusConflict
+	case errors.Is(err, errTodoNotFound), errors.Is(err, errUserNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeError reports err with the status that httpStatus returns for it.
+func writeError(w http.ResponseWriter, err error) {
+	var invalid *validation.Error
+	if errors.As(err, &invalid) {
+		validation.WriteError(w, err)
+		return
+	}
+
+	status := httpStatus(err)
+	if status >= http.StatusInternalServerError {
+		log.Err(err).Msg("request failed")
+	}
+
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"todo-go/identity"
+	"todo-go/pat"
+	"todo-go/store"
+	"todo-go/validation"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+type createAccessTokenRequest struct {
+	Name string `json:"name" validate:"required,max=100"`
+	// Scopes lists identity.KnownScopes that the caller's token grants. It defaults to all of those.
+	Scopes []string `json:"scopes" validate:"oneof=todos:read todos:write"`
+	// ExpiresIn is a duration such as "720h". Tokens without it never expire.
+	ExpiresIn string `json:"expiresIn"`
+}
+
+type accessTokenResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	// Token is only returned when the token is created.
+	Token string `json:"token,omitempty"`
+}
+
+func toAccessTokenResponse(token *store.AccessToken) *accessTokenResponse {
+	return &accessTokenResponse{
+		ID:         token.ID,
+		Name:       token.Name,
+		Scopes:     token.ScopeList(),
+		CreatedAt:  token.CreatedAt,
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+		RevokedAt:  token.RevokedAt,
+	}
+}
+
+// CreateAccessToken issues a personal access token to the caller. The token is returned once and only its
+// hash is stored. Tokens can't grant scopes that the caller's own token doesn't, and default to the known
+// scopes that it does. Callers authenticated by an access token can't create more of them.
+func (s *Server) CreateAccessToken(w http.ResponseWriter, r *http.Request) {
+	caller := identity.FromContext(r.Context())
+	if caller == nil {
+		http.Error(w, "context does not contain a subject value", http.StatusExpectationFailed)
+		return
+	}
+
+	if caller.AuthMethod == identity.AuthMethodPAT {
+		http.Error(w, "access tokens can't be used to create access tokens", http.StatusForbidden)
+		return
+	}
+
+	subject := caller.Subject
+
+	var req createAccessTokenRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	if len(req.Scopes) == 0 {
+		for _, scope := range identity.KnownScopes {
+			if caller.HasScope(scope) {
+				req.Scopes = append(req.Scopes, scope)
+			}
+		}
+	}
+
+	if missing := caller.MissingScopes(req.Scopes...); len(missing) > 0 {
+		validation.WriteError(w, validation.Fields(validation.FieldError{
+			Field:   "scopes",
+			Code:    "not_granted",
+			Message: fmt.Sprintf("scopes can't include %s, which the caller's token doesn't grant", strings.Join(missing, ", ")),
+		}))
+		return
+	}
+
+	now := time.Now().UTC()
+
+	var expiresAt *time.Time
+	if req.ExpiresIn != "" {
+		ttl, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || ttl <= 0 {
+			validation.WriteError(w, validation.Fields(validation.FieldError{
+				Field:   "expiresIn",
+				Code:    "duration",
+				Message: fmt.Sprintf("expiresIn must be a positive duration such as 720h, not [%s]", req.ExpiresIn),
+			}))
+			return
+		}
+
+		expiry := now.Add(ttl)
+		expiresAt = &expiry
+	}
+
+	secret, hash, err := pat.Generate()
+	if err != nil {
+		log.Err(err).Msg("failed to generate access token")
+		http.Error(w, "failed to generate access token", http.StatusInternalServerError)
+		return
+	}
+
+	token := &store.AccessToken{
+		ID:        uuid.New().String(),
+		Subject:   subject,
+		Name:      req.Name,
+		Hash:      hash,
+		Scopes:    strings.Join(req.Scopes, " "),
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}
+
+	if err := s.Store.InsertAccessToken(token); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Info().Str("subject", subject).Str("token_id", token.ID).Strs("scopes", req.Scopes).Msg("access token created")
+
+	resp := toAccessTokenResponse(token)
+	resp.Token = secret
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
+// ListAccessTokens lists the caller's personal access tokens, including revoked and expired ones.
+func (s *Server) ListAccessTokens(w http.ResponseWriter, r *http.Request) {
+	subject := identity.ExtractSubject(r.Context())
+	if subject == "" {
+		http.Error(w, "context does not contain a subject value", http.StatusExpectationFailed)
+		return
+	}
+
+	tokens, err := s.Store.ListAccessTokens(subject)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := make([]*accessTokenResponse, 0, len(tokens))
+	for i := range tokens {
+		resp = append(resp, toAccessTokenResponse(&tokens[i]))
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
+// RevokeAccessToken revokes one of the caller's personal access tokens.
+func (s *Server) RevokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	subject := identity.ExtractSubject(r.Context())
+	if subject == "" {
+		http.Error(w, "context does not contain a subject value", http.StatusExpectationFailed)
+		return
+	}
+
+	id := mux.Vars(r)["tokenID"]
+
+	revoked, err := s.Store.RevokeAccessToken(id, subject, time.Now().UTC())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !revoked {
+		http.Error(w, "access token not found", http.StatusNotFound)
+		return
+	}
+
+	log.Info().Str("subject", subject).Str("token_id", id).Msg("access token revoked")
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"todo-go/identity"
+)
+
+func TestCreateAccessTokenScopes(t *testing.T) {
+	srv := newTestServer(t)
+
+	create := func(scopes []string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/v1/tokens", strings.NewReader(body))
+		r = r.WithContext(identity.WithPrincipal(r.Context(), &identity.Principal{Subject: rick, Scopes: scopes}))
+
+		w := httptest.NewRecorder()
+		srv.CreateAccessToken(w, r)
+
+		return w
+	}
+
+	w := create([]string{identity.ScopeWrite}, `{"name": "CI"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: got status %d: %s", w.Code, w.Body.String())
+	}
+
+	if token := decode[*accessTokenResponse](t, w); len(token.Scopes) != 1 || token.Scopes[0] != identity.ScopeWrite {
+		t.Errorf("got scopes %v, want only the caller's", token.Scopes)
+	}
+
+	w = create([]string{identity.ScopeWrite}, `{"name": "CI", "scopes": ["todos:read", "todos:write"]}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("create with a scope the caller lacks: got status %d, want 422", w.Code)
+	}
+
+	w = create(identity.KnownScopes, `{"name": "CI", "scopes": ["todos:read"]}`)
+	if w.Code != http.StatusCreated {
+		t.Errorf("create with a subset of the caller's scopes: got status %d: %s", w.Code, w.Body.String())
+	}
+}
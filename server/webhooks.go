@@ -0,0 +1,325 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"todo-go/identity"
+	"todo-go/store"
+	"todo-go/validation"
+	"todo-go/webhooks"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+// webhookDeliveryLogSize is the number of recent deliveries returned by the delivery log.
+const webhookDeliveryLogSize = 100
+
+type webhookRequest struct {
+	URL string `json:"url" validate:"required,max=2048"`
+	// Events lists the event types to deliver. All events are delivered if it is empty.
+	Events []string `json:"events" validate:"oneof=todo.created todo.updated todo.completed todo.deleted"`
+	// Enabled enables or disables the webhook. New webhooks are enabled unless it is false. If it is omitted
+	// from an update, the webhook stays as it is.
+	Enabled *bool `json:"enabled"`
+}
+
+// validateURL checks that the request's URL is an absolute http or https URL. Whether it may be delivered to
+// is decided when it is dialed.
+func (req *webhookRequest) validateURL() error {
+	u, err := url.Parse(req.URL)
+	if err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.User == nil {
+		return nil
+	}
+
+	return validation.Fields(validation.FieldError{
+		Field:   "url",
+		Code:    "url",
+		Message: fmt.Sprintf("url must be an absolute http or https URL without credentials, not [%s]", req.URL),
+	})
+}
+
+type webhookResponse struct {
+	ID     string   `json:"id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// Enabled is false if the owner disabled the webhook, or it was disabled after repeated failures.
+	Enabled             bool       `json:"enabled"`
+	DisabledAt          *time.Time `json:"disabledAt,omitempty"`
+	DisabledReason      string     `json:"disabledReason,omitempty"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	CreatedAt           time.Time  `json:"createdAt"`
+	UpdatedAt           time.Time  `json:"updatedAt"`
+	// Secret is only returned when the webhook is created.
+	Secret string `json:"secret,omitempty"`
+}
+
+func toWebhookResponse(hook *store.Webhook) *webhookResponse {
+	return &webhookResponse{
+		ID:                  hook.ID,
+		URL:                 hook.URL,
+		Events:              append([]string{}, hook.EventList()...),
+		Enabled:             hook.DisabledAt == nil,
+		DisabledAt:          hook.DisabledAt,
+		DisabledReason:      hook.DisabledReason,
+		ConsecutiveFailures: hook.ConsecutiveFailures,
+		CreatedAt:           hook.CreatedAt,
+		UpdatedAt:           hook.UpdatedAt,
+	}
+}
+
+type webhookDeliveryResponse struct {
+	ID            string     `json:"id"`
+	EventID       uint64     `json:"eventId"`
+	Event         string     `json:"event"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	LastAttemptAt *time.Time `json:"lastAttemptAt,omitempty"`
+	// NextAttemptAt is set while the delivery is pending.
+	NextAttemptAt  *time.Time `json:"nextAttemptAt,omitempty"`
+	ResponseStatus int        `json:"responseStatus,omitempty"`
+	Error          string     `json:"error,omitempty"`
+}
+
+func toWebhookDeliveryResponse(d *store.WebhookDelivery) *webhookDeliveryResponse {
+	return &webhookDeliveryResponse{
+		ID:             d.ID,
+		EventID:        d.EventID,
+		Event:          d.EventType,
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		CreatedAt:      d.CreatedAt,
+		LastAttemptAt:  d.LastAttemptAt,
+		NextAttemptAt:  d.NextAttemptAt,
+		ResponseStatus: d.ResponseStatus,
+		Error:          d.Error,
+	}
+}
+
+// CreateWebhook registers a webhook for the caller. Its signing secret is only returned in the response.
+func (s *Server) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	subject := identity.ExtractSubject(r.Context())
+	if subject == "" {
+		http.Error(w, "context does not contain a subject value", http.StatusExpectationFailed)
+		return
+	}
+
+	var req webhookRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	if err := req.validateURL(); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	secret, err := webhooks.GenerateSecret()
+	if err != nil {
+		log.Err(err).Msg("failed to generate webhook secret")
+		http.Error(w, "failed to generate webhook secret", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC()
+	hook := &store.Webhook{
+		ID:        uuid.New().String(),
+		Subject:   subject,
+		URL:       req.URL,
+		Secret:    secret,
+		Events:    strings.Join(req.Events, " "),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if req.Enabled != nil && !*req.Enabled {
+		hook.DisabledAt = &now
+		hook.DisabledReason = "disabled by owner"
+	}
+
+	if err := s.Store.InsertWebhook(hook); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Info().Str("subject", subject).Str("webhook_id", hook.ID).Str("url", hook.URL).Msg("webhook created")
+
+	resp := toWebhookResponse(hook)
+	resp.Secret = secret
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
+// ListWebhooks lists the caller's webhooks.
+func (s *Server) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	subject := identity.ExtractSubject(r.Context())
+	if subject == "" {
+		http.Error(w, "context does not contain a subject value", http.StatusExpectationFailed)
+		return
+	}
+
+	hooks, err := s.Store.ListWebhooks(subject)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := make([]*webhookResponse, 0, len(hooks))
+	for i := range hooks {
+		resp = append(resp, toWebhookResponse(&hooks[i]))
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
+// GetWebhook returns one of the caller's webhooks.
+func (s *Server) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := s.callerWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(toWebhookResponse(hook)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
+// UpdateWebhook replaces the URL and events of one of the caller's webhooks, and enables or disables it.
+// Enabling a webhook that was disabled after repeated failures resets its failure count, but doesn't retry
+// the deliveries that failed.
+func (s *Server) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	if err := req.validateURL(); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	hook, ok := s.callerWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now().UTC()
+	hook.URL = req.URL
+	hook.Events = strings.Join(req.Events, " ")
+	hook.UpdatedAt = now
+
+	switch {
+	case req.Enabled == nil:
+	case *req.Enabled:
+		hook.DisabledAt = nil
+		hook.DisabledReason = ""
+	case hook.DisabledAt == nil:
+		hook.DisabledAt = &now
+		hook.DisabledReason = "disabled by owner"
+	}
+
+	if err := s.Store.UpdateWebhook(hook); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Info().Str("subject", hook.Subject).Str("webhook_id", hook.ID).Bool("enabled", hook.DisabledAt == nil).
+		Msg("webhook updated")
+
+	w.Header().Add("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(toWebhookResponse(hook)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
+// DeleteWebhook deletes one of the caller's webhooks and its delivery log.
+func (s *Server) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	subject := identity.ExtractSubject(r.Context())
+	if subject == "" {
+		http.Error(w, "context does not contain a subject value", http.StatusExpectationFailed)
+		return
+	}
+
+	id := mux.Vars(r)["webhookID"]
+
+	deleted, err := s.Store.DeleteWebhook(id, subject)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !deleted {
+		http.Error(w, "webhook not found", http.StatusNotFound)
+		return
+	}
+
+	log.Info().Str("subject", subject).Str("webhook_id", id).Msg("webhook deleted")
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// ListWebhookDeliveries returns the most recent deliveries to one of the caller's webhooks, newest first.
+func (s *Server) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	hook, ok := s.callerWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := s.Store.ListWebhookDeliveries(hook.ID, webhookDeliveryLogSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := make([]*webhookDeliveryResponse, 0, len(deliveries))
+	for i := range deliveries {
+		resp = append(resp, toWebhookDeliveryResponse(&deliveries[i]))
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
+// callerWebhook returns the webhook named by the request's path if it belongs to the caller. Otherwise it
+// writes an error response and returns false.
+func (s *Server) callerWebhook(w http.ResponseWriter, r *http.Request) (*store.Webhook, bool) {
+	subject := identity.ExtractSubject(r.Context())
+	if subject == "" {
+		http.Error(w, "context does not contain a subject value", http.StatusExpectationFailed)
+		return nil, false
+	}
+
+	hook, err := s.Store.GetWebhook(mux.Vars(r)["webhookID"], subject)
+	switch {
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	case hook == nil:
+		http.Error(w, "webhook not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return hook, true
+}
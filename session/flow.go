@@ -0,0 +1,238 @@
+package session
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"todo-go/identity"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// loginState is kept in the login cookie between the redirect to the provider and the callback.
+type loginState struct {
+	State    string `json:"state"`
+	Verifier string `json:"verifier"`
+	Nonce    string `json:"nonce"`
+	ReturnTo string `json:"return_to"`
+}
+
+// tokenResponse is the provider's reply to a code exchange.
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Login starts the authorization code flow. The optional return_to parameter is a local path to return to
+// after login.
+func (m *Manager) Login(w http.ResponseWriter, r *http.Request) {
+	state := &loginState{ReturnTo: localPath(r.URL.Query().Get("return_to"))}
+
+	for _, value := range []*string{&state.State, &state.Verifier, &state.Nonce} {
+		var err error
+		if *value, err = randomString(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	sealed, err := m.cookies.seal(m.loginCookieName(), state)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	m.setCookie(w, m.loginCookieName(), sealed, "/auth", loginTTL, true)
+
+	authorizeURL, err := url.Parse(m.cfg.AuthorizeURL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	challenge := sha256.Sum256([]byte(state.Verifier))
+
+	q := authorizeURL.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", m.cfg.ClientID)
+	q.Set("redirect_uri", m.cfg.RedirectURL)
+	q.Set("scope", m.cfg.Scopes)
+	q.Set("state", state.State)
+	q.Set("nonce", state.Nonce)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+
+	if hint := r.URL.Query().Get("login_hint"); hint != "" {
+		q.Set("login_hint", hint)
+	}
+
+	authorizeURL.RawQuery = q.Encode()
+
+	http.Redirect(w, r, authorizeURL.String(), http.StatusFound)
+}
+
+// Callback completes the flow: it exchanges the code, verifies the ID token and sets the session cookie.
+func (m *Manager) Callback(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(m.loginCookieName())
+	if err != nil {
+		http.Error(w, "login was not started or has expired", http.StatusBadRequest)
+		return
+	}
+
+	m.clearCookie(w, m.loginCookieName(), "/auth", true)
+
+	var state loginState
+	if err := m.cookies.open(m.loginCookieName(), cookie.Value, &state); err != nil {
+		http.Error(w, "invalid login state", http.StatusBadRequest)
+		return
+	}
+
+	q := r.URL.Query()
+	if providerErr := q.Get("error"); providerErr != "" {
+		http.Error(w, "login failed: "+providerErr+" "+q.Get("error_description"), http.StatusUnauthorized)
+		return
+	}
+
+	if q.Get("state") == "" || q.Get("state") != state.State {
+		http.Error(w, "login state mismatch", http.StatusBadRequest)
+		return
+	}
+
+	principal, err := m.exchange(r, q.Get("code"), &state)
+	if err != nil {
+		log.Err(err).Msg("login failed")
+		http.Error(w, "login failed: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	csrf, err := randomString()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s := &Session{Principal: principal, CSRFToken: csrf, ExpiresAt: time.Now().Add(m.cfg.TTL)}
+
+	sealed, err := m.cookies.seal(m.cfg.CookieName, s)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	m.setCookie(w, m.cfg.CookieName, sealed, "/", m.cfg.TTL, true)
+	// The CSRF cookie is readable by scripts, which echo it in the CSRF header.
+	m.setCookie(w, m.csrfCookieName(), csrf, "/", m.cfg.TTL, false)
+
+	log.Info().Str("subject", principal.Subject).Msg("browser session started")
+
+	http.Redirect(w, r, state.ReturnTo, http.StatusFound)
+}
+
+// Logout clears the session cookies and redirects to the provider's end session endpoint, if any.
+// It requires the CSRF header when a session is present.
+func (m *Manager) Logout(w http.ResponseWriter, r *http.Request) {
+	if s := m.FromRequest(r); s != nil && !m.CheckCSRF(r, s) {
+		http.Error(w, "missing or invalid "+CSRFHeader+" header", http.StatusForbidden)
+		return
+	}
+
+	m.clearCookie(w, m.cfg.CookieName, "/", true)
+	m.clearCookie(w, m.csrfCookieName(), "/", false)
+
+	target := "/"
+	if m.cfg.EndSessionURL != "" {
+		target = m.cfg.EndSessionURL
+	}
+
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// exchange redeems the authorization code and returns the principal described by the verified ID token.
+func (m *Manager) exchange(r *http.Request, code string, state *loginState) (*identity.Principal, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {m.cfg.RedirectURL},
+		"client_id":     {m.cfg.ClientID},
+		"code_verifier": {state.Verifier},
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, m.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	if m.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(m.cfg.ClientID), url.QueryEscape(m.cfg.ClientSecret))
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "code exchange failed")
+	}
+	defer resp.Body.Close()
+
+	var tokens tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, errors.Wrapf(err, "invalid code exchange response (status %d)", resp.StatusCode)
+	}
+
+	if tokens.Error != "" {
+		return nil, errors.Errorf("code exchange failed: %s %s", tokens.Error, tokens.ErrorDescription)
+	}
+
+	keys, err := m.keys.Get(r.Context(), m.jwksURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch JWKs from [%s]", m.jwksURL)
+	}
+
+	idToken, err := jwt.ParseString(tokens.IDToken,
+		jwt.WithKeySet(keys),
+		jwt.WithAudience(m.cfg.ClientID),
+		jwt.WithIssuer(m.issuer),
+		jwt.WithClaimValue("nonce", state.Nonce),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid ID token")
+	}
+
+	claims, err := idToken.AsMap(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	principal := m.principal(claims)
+	principal.AuthMethod = identity.AuthMethodSession
+
+	return principal, nil
+}
+
+// localPath returns p if it is a path on this server, and "/" otherwise, to avoid open redirects.
+func localPath(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, "/\\") {
+		return "/"
+	}
+
+	return p
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
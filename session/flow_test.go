@@ -0,0 +1,166 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"todo-go/devauth"
+	"todo-go/identity"
+)
+
+// testProvider is an OIDC provider whose token endpoint returns ID tokens with the nonce in nonce, or with
+// the nonce of the authorization request if it is empty.
+type testProvider struct {
+	*httptest.Server
+	nonce string
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	t.Helper()
+
+	issuer, err := devauth.LoadOrCreate(
+		&devauth.Config{KeyPath: filepath.Join(t.TempDir(), "key.pem"), TokenTTL: time.Minute}, "todo-app",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &testProvider{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(devauth.JWKSPath, issuer.JWKS)
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		idToken, err := issuer.Mint(&devauth.TokenRequest{
+			Subject: "rick@the-citadel.com", Claims: map[string]any{"nonce": p.nonce},
+		})
+		if err != nil {
+			t.Error(err)
+		}
+
+		_ = json.NewEncoder(w).Encode(&tokenResponse{IDToken: idToken})
+	})
+
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+
+	return p
+}
+
+func TestCallback(t *testing.T) {
+	provider := newTestProvider(t)
+
+	m, err := NewManager(context.Background(), &Config{
+		AuthorizeURL: provider.URL + "/authorize",
+		TokenURL:     provider.URL + "/token",
+		ClientID:     "todo-app",
+		RedirectURL:  "https://todo.example.com" + CallbackPath,
+		CookieName:   "todo_session",
+		TTL:          time.Hour,
+	}, devauth.IssuerName, provider.URL+devauth.JWKSPath, func(claims map[string]interface{}) *identity.Principal {
+		return &identity.Principal{Subject: claims["sub"].(string)}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		state  func(state string) string
+		nonce  func(nonce string) string
+		status int
+	}{
+		{"valid", same, same, http.StatusFound},
+		{"missing state", func(string) string { return "" }, same, http.StatusBadRequest},
+		{"state mismatch", func(state string) string { return state + "x" }, same, http.StatusBadRequest},
+		{"nonce mismatch", same, func(nonce string) string { return nonce + "x" }, http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			m.Login(w, httptest.NewRequest("GET", LoginPath+"?return_to=/todos", nil))
+
+			redirect, err := url.Parse(w.Header().Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			provider.nonce = tc.nonce(redirect.Query().Get("nonce"))
+
+			r := httptest.NewRequest("GET", CallbackPath+"?code=code&state="+tc.state(redirect.Query().Get("state")), nil)
+			for _, cookie := range w.Result().Cookies() {
+				r.AddCookie(cookie)
+			}
+
+			w = httptest.NewRecorder()
+			m.Callback(w, r)
+
+			if w.Code != tc.status {
+				t.Fatalf("got status %d: %s, want %d", w.Code, w.Body.String(), tc.status)
+			}
+
+			if tc.status != http.StatusFound {
+				return
+			}
+
+			if location := w.Header().Get("Location"); location != "/todos" {
+				t.Errorf("got redirect to [%s], want return_to", location)
+			}
+
+			r = httptest.NewRequest("GET", "/v1/todos", nil)
+			for _, cookie := range w.Result().Cookies() {
+				r.AddCookie(cookie)
+			}
+
+			if s := m.FromRequest(r); s == nil || s.Principal.Subject != "rick@the-citadel.com" ||
+				s.Principal.AuthMethod != identity.AuthMethodSession {
+				t.Errorf("got session %+v, want one for the ID token's subject", s)
+			}
+		})
+	}
+}
+
+func same(s string) string { return s }
+
+func TestLogoutRequiresCSRF(t *testing.T) {
+	m := newTestManager(t)
+	s := &Session{Principal: &identity.Principal{Subject: "rick"}, CSRFToken: "csrf", ExpiresAt: time.Now().Add(time.Hour)}
+
+	w := httptest.NewRecorder()
+	m.Logout(w, withCookie(t, m, "POST", "todo_session", "todo_session", s))
+
+	if w.Code != http.StatusForbidden || len(w.Result().Cookies()) != 0 {
+		t.Errorf("got status %d, want the session kept without a CSRF token", w.Code)
+	}
+
+	r := withCookie(t, m, "POST", "todo_session", "todo_session", s)
+	r.Header.Set(CSRFHeader, "csrf")
+
+	w = httptest.NewRecorder()
+	m.Logout(w, r)
+
+	if w.Code != http.StatusSeeOther || len(w.Result().Cookies()) != 2 {
+		t.Errorf("got status %d, want the session cleared", w.Code)
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	for p, want := range map[string]string{
+		"/todos?filter=open":    "/todos?filter=open",
+		"/":                     "/",
+		"":                      "/",
+		"//evil.example":        "/",
+		"/\\evil.example":       "/",
+		"https://evil.example/": "/",
+		"evil.example":          "/",
+		"javascript:alert(1)":   "/",
+	} {
+		if got := localPath(p); got != want {
+			t.Errorf("localPath(%q) = %q, want %q", p, got, want)
+		}
+	}
+}
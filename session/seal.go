@@ -0,0 +1,98 @@
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+const keySize = 32
+
+// sealer encrypts and authenticates cookie values with AES-256-GCM.
+type sealer struct {
+	aead cipher.AEAD
+}
+
+// newSealer uses the base64-encoded key, or a random key if it is empty.
+func newSealer(encodedKey string) (*sealer, error) {
+	key := make([]byte, keySize)
+
+	if encodedKey == "" {
+		if _, err := rand.Read(key); err != nil {
+			return nil, errors.Wrap(err, "failed to generate session key")
+		}
+	} else {
+		var err error
+		if key, err = DecodeKey(encodedKey); err != nil {
+			return nil, err
+		}
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sealer{aead: aead}, nil
+}
+
+// DecodeKey decodes a base64-encoded session key and checks its size.
+func DecodeKey(encodedKey string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "session key is not valid base64")
+	}
+
+	if len(key) != keySize {
+		return nil, errors.Errorf("session key must be %d bytes, got %d", keySize, len(key))
+	}
+
+	return key, nil
+}
+
+// seal encodes v as JSON and encrypts it. The name is authenticated too, so a value sealed for one cookie
+// can't be replayed in another.
+func (s *sealer) seal(name string, v interface{}) (string, error) {
+	plaintext, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := s.aead.Seal(nonce, nonce, plaintext, []byte(name))
+
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+func (s *sealer) open(name, value string, v interface{}) error {
+	sealed, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return err
+	}
+
+	if len(sealed) < s.aead.NonceSize() {
+		return errors.New("sealed value is too short")
+	}
+
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(plaintext, v)
+}
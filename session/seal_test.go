@@ -0,0 +1,62 @@
+package session
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestSealer(t *testing.T) {
+	s, err := newSealer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := s.seal("todo_session", &Session{CSRFToken: "csrf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var opened Session
+	if err := s.open("todo_session", sealed, &opened); err != nil || opened.CSRFToken != "csrf" {
+		t.Fatalf("got %+v, %v, want the sealed session", opened, err)
+	}
+
+	raw, _ := base64.RawURLEncoding.DecodeString(sealed)
+	raw[len(raw)-1] ^= 1
+	tampered := base64.RawURLEncoding.EncodeToString(raw)
+
+	other, err := newSealer(base64.StdEncoding.EncodeToString(make([]byte, keySize)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		sealer *sealer
+		cookie string
+		value  string
+	}{
+		{"tampered", s, "todo_session", tampered},
+		// The cookie name is authenticated, so a value can't be moved to another cookie.
+		{"renamed", s, "todo_session_login", sealed},
+		{"other key", other, "todo_session", sealed},
+		{"truncated", s, "todo_session", sealed[:8]},
+		{"not base64", s, "todo_session", "!!!"},
+	} {
+		if err := tc.sealer.open(tc.cookie, tc.value, &Session{}); err == nil {
+			t.Errorf("%s: the value was opened", tc.name)
+		}
+	}
+}
+
+func TestDecodeKey(t *testing.T) {
+	for key, valid := range map[string]bool{
+		base64.StdEncoding.EncodeToString(make([]byte, keySize)):   true,
+		base64.StdEncoding.EncodeToString(make([]byte, keySize-1)): false,
+		"not base64": false,
+	} {
+		if _, err := DecodeKey(key); (err == nil) != valid {
+			t.Errorf("%s: got error %v, want valid %t", key, err, valid)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"todo-go/identity"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+
+	cookies, err := newSealer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Manager{cfg: &Config{CookieName: "todo_session", TTL: time.Hour}, cookies: cookies}
+}
+
+// withCookie returns a request with a cookie holding v sealed for the cookie named sealedFor.
+func withCookie(t *testing.T, m *Manager, method, name, sealedFor string, v interface{}) *http.Request {
+	t.Helper()
+
+	sealed, err := m.cookies.seal(sealedFor, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(method, "/v1/todos", nil)
+	r.AddCookie(&http.Cookie{Name: name, Value: sealed})
+
+	return r
+}
+
+func TestFromRequest(t *testing.T) {
+	m := newTestManager(t)
+
+	valid := &Session{
+		Principal: &identity.Principal{Subject: "rick@the-citadel.com"}, CSRFToken: "csrf",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+
+	if s := m.FromRequest(withCookie(t, m, "GET", "todo_session", "todo_session", valid)); s == nil ||
+		s.Principal.Subject != "rick@the-citadel.com" {
+		t.Fatalf("got session %+v, want the sealed one", s)
+	}
+
+	expired := *valid
+	expired.ExpiresAt = time.Now().Add(-time.Second)
+
+	for name, r := range map[string]*http.Request{
+		"no cookie": httptest.NewRequest("GET", "/v1/todos", nil),
+		"expired":   withCookie(t, m, "GET", "todo_session", "todo_session", &expired),
+		"no principal": withCookie(t, m, "GET", "todo_session", "todo_session",
+			&Session{CSRFToken: "csrf", ExpiresAt: valid.ExpiresAt}),
+		// A value sealed for the login cookie can't be used as a session.
+		"sealed for another cookie": withCookie(t, m, "GET", "todo_session", m.loginCookieName(), valid),
+	} {
+		if s := m.FromRequest(r); s != nil {
+			t.Errorf("%s: got session %+v, want none", name, s)
+		}
+	}
+}
+
+func TestCheckCSRF(t *testing.T) {
+	m := newTestManager(t)
+	s := &Session{CSRFToken: "csrf"}
+
+	for _, tc := range []struct {
+		method string
+		token  string
+		want   bool
+	}{
+		{"GET", "", true},
+		{"HEAD", "", true},
+		{"OPTIONS", "", true},
+		{"POST", "", false},
+		{"POST", "wrong", false},
+		{"PUT", "csr", false},
+		{"DELETE", "csrf", true},
+		{"POST", "csrf", true},
+	} {
+		r := httptest.NewRequest(tc.method, "/v1/todos", nil)
+		if tc.token != "" {
+			r.Header.Set(CSRFHeader, tc.token)
+		}
+
+		if got := m.CheckCSRF(r, s); got != tc.want {
+			t.Errorf("%s with token [%s]: got %t, want %t", tc.method, tc.token, got, tc.want)
+		}
+	}
+}
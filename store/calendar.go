@@ -0,0 +1,83 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/blockloop/scan"
+)
+
+const createCalendarFeedsTableSQL = `CREATE TABLE IF NOT EXISTS calendar_feeds (
+	Subject TEXT PRIMARY KEY,
+	Hash TEXT NOT NULL UNIQUE,
+	CreatedAt TIMESTAMP NOT NULL,
+	LastUsedAt TIMESTAMP
+);`
+
+// CalendarFeed is a user's calendar feed. Each user has at most one. The feed token itself is never stored,
+// only its hash.
+type CalendarFeed struct {
+	Subject    string
+	Hash       string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
+
+const calendarFeedColumns = "Subject, Hash, CreatedAt, LastUsedAt"
+
+// SetCalendarFeed creates the feed of feed.Subject, or replaces its token, which revokes the previous one.
+func (s *Store) SetCalendarFeed(feed *CalendarFeed) error {
+	_, err := s.DB.Exec(
+		`INSERT INTO calendar_feeds (Subject, Hash, CreatedAt) VALUES (?, ?, ?)
+		ON CONFLICT (Subject) DO UPDATE SET Hash=excluded.Hash, CreatedAt=excluded.CreatedAt, LastUsedAt=NULL`,
+		feed.Subject, feed.Hash, feed.CreatedAt,
+	)
+
+	return err
+}
+
+// GetCalendarFeed returns the feed of subject, or nil if they have none.
+func (s *Store) GetCalendarFeed(subject string) (*CalendarFeed, error) {
+	return s.queryCalendarFeed("SELECT "+calendarFeedColumns+" FROM calendar_feeds WHERE Subject = ?", subject)
+}
+
+// GetCalendarFeedByHash returns the feed whose token has the given hash, or nil if there is none.
+func (s *Store) GetCalendarFeedByHash(hash string) (*CalendarFeed, error) {
+	return s.queryCalendarFeed("SELECT "+calendarFeedColumns+" FROM calendar_feeds WHERE Hash = ?", hash)
+}
+
+// DeleteCalendarFeed deletes the feed of subject, which revokes its token. It reports whether there was one.
+func (s *Store) DeleteCalendarFeed(subject string) (bool, error) {
+	res, err := s.DB.Exec(`DELETE FROM calendar_feeds WHERE Subject=?`, subject)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+
+	return n > 0, err
+}
+
+// TouchCalendarFeed records when the feed of subject was last fetched.
+func (s *Store) TouchCalendarFeed(subject string, now time.Time) error {
+	_, err := s.DB.Exec(`UPDATE calendar_feeds SET LastUsedAt=? WHERE Subject=?`, now, subject)
+	return err
+}
+
+func (s *Store) queryCalendarFeed(query string, args ...interface{}) (*CalendarFeed, error) {
+	rows, err := s.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var feeds []CalendarFeed
+	if err := scan.Rows(&feeds, rows); err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	if len(feeds) == 0 {
+		return nil, nil
+	}
+
+	return &feeds[0], nil
+}
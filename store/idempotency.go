@@ -0,0 +1,103 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/blockloop/scan"
+	"github.com/pkg/errors"
+)
+
+const createIdempotencyKeysTableSQL = `CREATE TABLE IF NOT EXISTS idempotency_keys (
+	Subject TEXT NOT NULL,
+	IdempotencyKey TEXT NOT NULL,
+	Fingerprint TEXT NOT NULL,
+	Status INTEGER NOT NULL DEFAULT 0,
+	ContentType TEXT NOT NULL DEFAULT '',
+	Body BLOB,
+	CreatedAt TIMESTAMP NOT NULL,
+	ExpiresAt TIMESTAMP NOT NULL,
+	PRIMARY KEY (Subject, IdempotencyKey)
+);
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires ON idempotency_keys (ExpiresAt);`
+
+// IdempotencyKey records the first request that a caller made with an idempotency key, and its response.
+type IdempotencyKey struct {
+	Subject        string
+	IdempotencyKey string
+	// Fingerprint identifies the request, so that a key can't be reused for a different one.
+	Fingerprint string
+	// Status is the response status. It is zero while the request is in flight.
+	Status      int
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// InFlight reports whether the request that claimed the key hasn't completed yet.
+func (k *IdempotencyKey) InFlight() bool {
+	return k.Status == 0
+}
+
+const idempotencyKeyColumns = "Subject, IdempotencyKey, Fingerprint, Status, ContentType, Body, CreatedAt, ExpiresAt"
+
+// ClaimIdempotencyKey claims a key for an in-flight request, after deleting the keys that expired by now.
+// If the caller already holds the key, it claims nothing and returns the existing record.
+func (s *Store) ClaimIdempotencyKey(key *IdempotencyKey, now time.Time) (*IdempotencyKey, error) {
+	if _, err := s.DB.Exec(`DELETE FROM idempotency_keys WHERE ExpiresAt <= ?`, now); err != nil {
+		return nil, err
+	}
+
+	res, err := s.DB.Exec(
+		`INSERT INTO idempotency_keys (Subject, IdempotencyKey, Fingerprint, CreatedAt, ExpiresAt) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (Subject, IdempotencyKey) DO NOTHING`,
+		key.Subject, key.IdempotencyKey, key.Fingerprint, key.CreatedAt, key.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return nil, err
+	}
+
+	rows, err := s.DB.Query(
+		"SELECT "+idempotencyKeyColumns+" FROM idempotency_keys WHERE Subject = ? AND IdempotencyKey = ?",
+		key.Subject, key.IdempotencyKey,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []IdempotencyKey
+	if err := scan.Rows(&keys, rows); err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("idempotency key was released while it was claimed")
+	}
+
+	return &keys[0], nil
+}
+
+// CompleteIdempotencyKey records the response to the request that claimed a key, and when it expires.
+func (s *Store) CompleteIdempotencyKey(key *IdempotencyKey) error {
+	_, err := s.DB.Exec(
+		`UPDATE idempotency_keys SET Status=?, ContentType=?, Body=?, ExpiresAt=?
+		WHERE Subject=? AND IdempotencyKey=? AND Status=0`,
+		key.Status, key.ContentType, key.Body, key.ExpiresAt, key.Subject, key.IdempotencyKey,
+	)
+
+	return err
+}
+
+// ReleaseIdempotencyKey deletes a key that is still in flight, so that the request can be retried.
+func (s *Store) ReleaseIdempotencyKey(subject, key string) error {
+	_, err := s.DB.Exec(
+		`DELETE FROM idempotency_keys WHERE Subject=? AND IdempotencyKey=? AND Status=0`, subject, key,
+	)
+
+	return err
+}
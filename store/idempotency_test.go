@@ -0,0 +1,45 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIdempotencyKeyExpiry(t *testing.T) {
+	s, err := NewMemoryStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	now := time.Now().UTC()
+	claim := func(at time.Time, fingerprint string) (*IdempotencyKey, error) {
+		return s.ClaimIdempotencyKey(&IdempotencyKey{
+			Subject: "rick", IdempotencyKey: "key", Fingerprint: fingerprint, CreatedAt: at, ExpiresAt: at.Add(time.Minute),
+		}, at)
+	}
+
+	if existing, err := claim(now, "first"); err != nil || existing != nil {
+		t.Fatalf("got %+v, %v for the first claim, want it claimed", existing, err)
+	}
+
+	if err := s.CompleteIdempotencyKey(&IdempotencyKey{
+		Subject: "rick", IdempotencyKey: "key", Status: 201, Body: []byte("{}"), ExpiresAt: now.Add(time.Hour),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Completed keys aren't released, and are returned until they expire.
+	if err := s.ReleaseIdempotencyKey("rick", "key"); err != nil {
+		t.Fatal(err)
+	}
+
+	if existing, err := claim(now.Add(59*time.Minute), "second"); err != nil || existing == nil ||
+		existing.Fingerprint != "first" || existing.Status != 201 {
+		t.Fatalf("got %+v, %v before expiry, want the completed key", existing, err)
+	}
+
+	if existing, err := claim(now.Add(time.Hour), "second"); err != nil || existing != nil {
+		t.Fatalf("got %+v, %v after expiry, want the key claimed again", existing, err)
+	}
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"database/sql"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// migrations holds the schema changes applied to the database, in order.
+// The schema version stored in the database is the number of migrations applied.
+// New migrations must be appended; existing ones must never be edited.
+var migrations = []string{
+	createTodoTableSQL,
+	createAccessTokensTableSQL,
+	createWebhooksTablesSQL,
+	createIdempotencyKeysTableSQL,
+	addTodoDueDatesSQL,
+	createCalendarFeedsTableSQL,
+}
+
+// SchemaVersion returns the number of migrations applied to the database.
+func (s *Store) SchemaVersion() (int, error) {
+	return schemaVersion(s.DB)
+}
+
+// LatestSchemaVersion returns the schema version this build of the store expects.
+func LatestSchemaVersion() int {
+	return len(migrations)
+}
+
+// Migrate applies all pending migrations and returns the schema versions before and after.
+func (s *Store) Migrate() (from, to int, err error) {
+	return migrate(s.DB)
+}
+
+func migrate(db *sql.DB) (int, int, error) {
+	from, err := schemaVersion(db)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if from > len(migrations) {
+		return from, from, errors.Errorf("database schema version %d is newer than supported version %d", from, len(migrations))
+	}
+
+	for version := from; version < len(migrations); version++ {
+		log.Trace().Int("version", version+1).Msg("applying migration")
+
+		if err := applyMigration(db, version); err != nil {
+			return from, version, errors.Wrapf(err, "migration %d failed", version+1)
+		}
+	}
+
+	return from, len(migrations), nil
+}
+
+func applyMigration(db *sql.DB, version int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec(migrations[version]); err != nil {
+		return err
+	}
+
+	// PRAGMA statements don't accept bound parameters.
+	if _, err := tx.Exec(pragmaUserVersion(version + 1)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func schemaVersion(db *sql.DB) (int, error) {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return 0, errors.Wrap(err, "failed to read schema version")
+	}
+
+	return version, nil
+}
+
+func pragmaUserVersion(version int) string {
+	return "PRAGMA user_version = " + strconv.Itoa(version)
+}
@@ -4,6 +4,7 @@ package store
 import (
 	"database/sql"
 	"os"
+	"time"
 
 	"github.com/blockloop/scan"
 	"github.com/pkg/errors"
@@ -21,13 +22,39 @@ const createTodoTableSQL = `CREATE TABLE IF NOT EXISTS todos (
 	OwnerID TEXT NOT NULL
 );`
 
+// addTodoDueDatesSQL adds due dates to todos, and the revision and time of their last change, which calendar
+// feeds report. Existing todos are treated as changed when the migration runs.
+const addTodoDueDatesSQL = `ALTER TABLE todos ADD COLUMN DueAt TIMESTAMP;
+ALTER TABLE todos ADD COLUMN Sequence INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE todos ADD COLUMN UpdatedAt TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00';
+UPDATE todos SET UpdatedAt = CURRENT_TIMESTAMP;`
+
 type Todo struct {
 	ID        string
 	OwnerID   string
 	Title     string
 	Completed bool
+	DueAt     *time.Time
+	// Sequence is the revision of the todo. It starts at 0 and is incremented by each update.
+	Sequence  int
+	UpdatedAt time.Time
 }
 
+const todoColumns = "ID, OwnerID, Title, Completed, DueAt, Sequence, UpdatedAt"
+
+const (
+	insertTodoSQL = `INSERT INTO todos (ID, OwnerID, Title, Completed, DueAt, Sequence, UpdatedAt) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	// insertTodoWithinLimitSQL counts the owner's todos and inserts in one statement, so concurrent inserts
+	// can't both see room for one more todo.
+	insertTodoWithinLimitSQL = `INSERT INTO todos (ID, OwnerID, Title, Completed, DueAt, Sequence, UpdatedAt)
+	SELECT ?, ?, ?, ?, ?, ?, ? WHERE (SELECT COUNT(*) FROM todos WHERE OwnerID=?) < ?`
+	countTodosSQL = `SELECT COUNT(*) FROM todos WHERE OwnerID=?`
+	updateTodoSQL = `UPDATE todos SET Title=?, Completed=?, DueAt=?, UpdatedAt=?, Sequence=Sequence+1 WHERE ID=?`
+)
+
+// ErrTodoLimit is returned when inserting todos would leave their owner with more todos than allowed.
+var ErrTodoLimit = errors.New("owner has reached the maximum number of todos")
+
 type Store struct {
 	DB *sql.DB
 }
@@ -41,7 +68,9 @@ func (s *Store) GetTodos() ([]Todo, error) {
 }
 
 func (s *Store) InsertTodo(todo *Todo) error {
-	_, err := s.DB.Exec(`INSERT INTO todos (ID, OwnerID, Title, Completed) VALUES (?, ?, ?, ?)`, todo.ID, todo.OwnerID, todo.Title, todo.Completed)
+	_, err := s.DB.Exec(
+		insertTodoSQL, todo.ID, todo.OwnerID, todo.Title, todo.Completed, todo.DueAt, todo.Sequence, todo.UpdatedAt,
+	)
 
 	if err != nil {
 		return err
@@ -50,6 +79,33 @@ func (s *Store) InsertTodo(todo *Todo) error {
 	return nil
 }
 
+// InsertTodoWithinLimit inserts a todo unless its owner already owns maxTodos todos, in which case it returns
+// ErrTodoLimit. Zero maxTodos is unlimited.
+func (s *Store) InsertTodoWithinLimit(todo *Todo, maxTodos int) error {
+	if maxTodos == 0 {
+		return s.InsertTodo(todo)
+	}
+
+	res, err := s.DB.Exec(
+		insertTodoWithinLimitSQL,
+		todo.ID, todo.OwnerID, todo.Title, todo.Completed, todo.DueAt, todo.Sequence, todo.UpdatedAt,
+		todo.OwnerID, maxTodos,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	switch {
+	case err != nil:
+		return err
+	case n == 0:
+		return ErrTodoLimit
+	}
+
+	return nil
+}
+
 func (s *Store) GetTodo(id string) (*Todo, error) {
 	todos, err := s.loadTodos(id)
 	if err != nil {
@@ -63,8 +119,9 @@ func (s *Store) GetTodo(id string) (*Todo, error) {
 	return &todos[0], nil
 }
 
+// UpdateTodo replaces the title, completion and due date of a todo, and increments its sequence.
 func (s *Store) UpdateTodo(todo *Todo) error {
-	_, err := s.DB.Exec(`UPDATE todos SET  Title=?, Completed=? WHERE ID=?`, todo.Title, todo.Completed, todo.ID)
+	_, err := s.DB.Exec(updateTodoSQL, todo.Title, todo.Completed, todo.DueAt, todo.UpdatedAt, todo.ID)
 
 	if err != nil {
 		return err
@@ -73,6 +130,14 @@ func (s *Store) UpdateTodo(todo *Todo) error {
 	return nil
 }
 
+// CountTodos returns the number of todos owned by ownerID.
+func (s *Store) CountTodos(ownerID string) (int, error) {
+	var count int
+	err := s.DB.QueryRow(countTodosSQL, ownerID).Scan(&count)
+
+	return count, err
+}
+
 func (s *Store) DeleteTodo(id string) error {
 	_, err := s.DB.Exec(`DELETE FROM todos WHERE ID=?`, id)
 
@@ -83,8 +148,76 @@ func (s *Store) DeleteTodo(id string) error {
 	return nil
 }
 
+// TodoBatch is a set of changes to todos that are applied together.
+type TodoBatch struct {
+	Inserts []Todo
+	// Updates replace the title, completion and due date of existing todos.
+	Updates []Todo
+	Deletes []string
+	// MaxTodos is the most todos that the owners of inserted todos may own after the batch. Zero is unlimited.
+	MaxTodos int
+}
+
+// ApplyTodoBatch applies all changes in the batch in a single transaction, or none of them. If the batch
+// leaves the owner of an inserted todo with more than MaxTodos todos, nothing is applied and ErrTodoLimit is
+// returned.
+func (s *Store) ApplyTodoBatch(batch *TodoBatch) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for i := range batch.Inserts {
+		todo := &batch.Inserts[i]
+		if _, err := tx.Exec(
+			insertTodoSQL, todo.ID, todo.OwnerID, todo.Title, todo.Completed, todo.DueAt, todo.Sequence, todo.UpdatedAt,
+		); err != nil {
+			return errors.Wrapf(err, "failed to insert todo [%s]", todo.ID)
+		}
+	}
+
+	for i := range batch.Updates {
+		todo := &batch.Updates[i]
+		if _, err := tx.Exec(
+			updateTodoSQL, todo.Title, todo.Completed, todo.DueAt, todo.UpdatedAt, todo.ID,
+		); err != nil {
+			return errors.Wrapf(err, "failed to update todo [%s]", todo.ID)
+		}
+	}
+
+	for _, id := range batch.Deletes {
+		if _, err := tx.Exec(`DELETE FROM todos WHERE ID=?`, id); err != nil {
+			return errors.Wrapf(err, "failed to delete todo [%s]", id)
+		}
+	}
+
+	if batch.MaxTodos > 0 {
+		checked := map[string]bool{}
+		for i := range batch.Inserts {
+			owner := batch.Inserts[i].OwnerID
+			if checked[owner] {
+				continue
+			}
+
+			checked[owner] = true
+
+			var count int
+			if err := tx.QueryRow(countTodosSQL, owner).Scan(&count); err != nil {
+				return errors.Wrapf(err, "failed to count todos of [%s]", owner)
+			}
+
+			if count > batch.MaxTodos {
+				return ErrTodoLimit
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
 func (s *Store) loadTodos(id string) ([]Todo, error) {
-	query := "SELECT ID, OwnerID, Title, Completed FROM todos"
+	query := "SELECT " + todoColumns + " FROM todos"
 	args := []interface{}{}
 
 	if id != "" {
@@ -110,7 +243,38 @@ func (s *Store) loadTodos(id string) ([]Todo, error) {
 	return todos, nil
 }
 
+// NewStore opens the database and applies any pending migrations.
 func NewStore() (*Store, error) {
+	s := OpenStore()
+
+	if _, _, err := s.Migrate(); err != nil {
+		_ = s.Close()
+		return nil, errors.Wrap(err, "failed to migrate database")
+	}
+	return s, nil
+}
+
+// NewMemoryStore returns a migrated store backed by a private in-memory database.
+func NewMemoryStore() (*Store, error) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+
+	// Each connection to ":memory:" opens a separate database.
+	db.SetMaxOpenConns(1)
+
+	s := &Store{DB: db}
+	if _, _, err := s.Migrate(); err != nil {
+		_ = s.Close()
+		return nil, errors.Wrap(err, "failed to migrate database")
+	}
+
+	return s, nil
+}
+
+// OpenStore opens the database, creating it if necessary, without applying migrations.
+func OpenStore() *Store {
 	log.Trace().Msg("Creating todo.db...")
 	if _, fileExistsError := os.Stat(dbPath); os.IsNotExist(fileExistsError) {
 		file, err := os.Create(dbPath)
@@ -123,24 +287,5 @@ func NewStore() (*Store, error) {
 
 	sqliteDatabase, _ := sql.Open("sqlite3", dbPath) // Open the created SQLite File
 
-	createTodosTableErr := createTodosTable(sqliteDatabase)
-	if createTodosTableErr != nil {
-		return nil, createTodosTableErr
-	}
-	return &Store{DB: sqliteDatabase}, nil
-}
-
-func createTodosTable(db *sql.DB) error {
-	log.Trace().Msg("Create todos table...")
-
-	statement, err := db.Prepare(createTodoTableSQL) // Prepare SQL Statement
-	if err != nil {
-		return errors.Wrap(err, "failed to prepare sql statement")
-	}
-
-	if _, err := statement.Exec(); err != nil {
-		return errors.Wrap(err, "failed to create todos table")
-	}
-	log.Trace().Msg("todos table created")
-	return nil
+	return &Store{DB: sqliteDatabase}
 }
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/blockloop/scan"
+)
+
+const createAccessTokensTableSQL = `CREATE TABLE IF NOT EXISTS access_tokens (
+	ID TEXT PRIMARY KEY,
+	Subject TEXT NOT NULL,
+	Name TEXT NOT NULL,
+	Hash TEXT NOT NULL UNIQUE,
+	Scopes TEXT NOT NULL,
+	CreatedAt TIMESTAMP NOT NULL,
+	ExpiresAt TIMESTAMP,
+	LastUsedAt TIMESTAMP,
+	RevokedAt TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS access_tokens_subject ON access_tokens (Subject);`
+
+// AccessToken is a personal access token. The token itself is never stored, only its hash.
+type AccessToken struct {
+	ID      string
+	Subject string
+	Name    string
+	Hash    string
+	// Scopes is a space-separated list of granted scopes.
+	Scopes     string
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+// ScopeList returns the granted scopes.
+func (t *AccessToken) ScopeList() []string {
+	return strings.Fields(t.Scopes)
+}
+
+// HasScope reports whether the token grants scope.
+func (t *AccessToken) HasScope(scope string) bool {
+	for _, s := range t.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Active reports whether the token is neither revoked nor expired at time now.
+func (t *AccessToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || now.Before(*t.ExpiresAt))
+}
+
+const accessTokenColumns = "ID, Subject, Name, Hash, Scopes, CreatedAt, ExpiresAt, LastUsedAt, RevokedAt"
+
+func (s *Store) InsertAccessToken(token *AccessToken) error {
+	_, err := s.DB.Exec(
+		`INSERT INTO access_tokens (ID, Subject, Name, Hash, Scopes, CreatedAt, ExpiresAt) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		token.ID, token.Subject, token.Name, token.Hash, token.Scopes, token.CreatedAt, token.ExpiresAt,
+	)
+
+	return err
+}
+
+// GetAccessTokenByHash returns the token with the given hash, or nil if there is none.
+func (s *Store) GetAccessTokenByHash(hash string) (*AccessToken, error) {
+	tokens, err := s.queryAccessTokens("SELECT "+accessTokenColumns+" FROM access_tokens WHERE Hash = ?", hash)
+	if err != nil || len(tokens) == 0 {
+		return nil, err
+	}
+
+	return &tokens[0], nil
+}
+
+// ListAccessTokens returns the tokens that belong to subject, newest first.
+func (s *Store) ListAccessTokens(subject string) ([]AccessToken, error) {
+	return s.queryAccessTokens(
+		"SELECT "+accessTokenColumns+" FROM access_tokens WHERE Subject = ? ORDER BY CreatedAt DESC", subject,
+	)
+}
+
+// RevokeAccessToken revokes the token with the given ID if it belongs to subject.
+// It reports whether a matching, unrevoked token was found.
+func (s *Store) RevokeAccessToken(id, subject string, now time.Time) (bool, error) {
+	res, err := s.DB.Exec(
+		`UPDATE access_tokens SET RevokedAt=? WHERE ID=? AND Subject=? AND RevokedAt IS NULL`, now, id, subject,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+
+	return n > 0, err
+}
+
+// TouchAccessToken records when a token was last used.
+func (s *Store) TouchAccessToken(id string, now time.Time) error {
+	_, err := s.DB.Exec(`UPDATE access_tokens SET LastUsedAt=? WHERE ID=?`, now, id)
+	return err
+}
+
+func (s *Store) queryAccessTokens(query string, args ...interface{}) ([]AccessToken, error) {
+	rows, err := s.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []AccessToken
+	if err := scan.Rows(&tokens, rows); err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	return tokens, nil
+}
@@ -0,0 +1,357 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/blockloop/scan"
+)
+
+const createWebhooksTablesSQL = `CREATE TABLE IF NOT EXISTS webhooks (
+	ID TEXT PRIMARY KEY,
+	Subject TEXT NOT NULL,
+	URL TEXT NOT NULL,
+	Secret TEXT NOT NULL,
+	Events TEXT NOT NULL,
+	CreatedAt TIMESTAMP NOT NULL,
+	UpdatedAt TIMESTAMP NOT NULL,
+	ConsecutiveFailures INTEGER NOT NULL DEFAULT 0,
+	DisabledAt TIMESTAMP,
+	DisabledReason TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS webhooks_subject ON webhooks (Subject);
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+	ID TEXT PRIMARY KEY,
+	WebhookID TEXT NOT NULL REFERENCES webhooks (ID) ON DELETE CASCADE,
+	EventID INTEGER NOT NULL,
+	EventType TEXT NOT NULL,
+	Payload TEXT NOT NULL,
+	Status TEXT NOT NULL,
+	Attempts INTEGER NOT NULL DEFAULT 0,
+	CreatedAt TIMESTAMP NOT NULL,
+	NextAttemptAt TIMESTAMP,
+	LastAttemptAt TIMESTAMP,
+	ResponseStatus INTEGER NOT NULL DEFAULT 0,
+	Error TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook ON webhook_deliveries (WebhookID, CreatedAt);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_pending ON webhook_deliveries (Status, NextAttemptAt);`
+
+// Delivery statuses.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook is an endpoint that a user registered to receive todo events.
+type Webhook struct {
+	ID      string
+	Subject string
+	URL     string
+	// Secret is the key that payloads are signed with.
+	Secret string
+	// Events is a space-separated list of the event types to deliver. All events are delivered if it is empty.
+	Events    string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// ConsecutiveFailures counts the failed delivery attempts since the last successful one.
+	ConsecutiveFailures int
+	// DisabledAt is set when the webhook is disabled, by its owner or after repeated failures.
+	DisabledAt     *time.Time
+	DisabledReason string
+}
+
+// EventList returns the event types the webhook subscribes to. It is empty if the webhook receives all events.
+func (w *Webhook) EventList() []string {
+	return strings.Fields(w.Events)
+}
+
+// Wants reports whether the webhook subscribes to events of the given type.
+func (w *Webhook) Wants(eventType string) bool {
+	events := w.EventList()
+	if len(events) == 0 {
+		return true
+	}
+
+	for _, e := range events {
+		if e == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WebhookDelivery is an event queued for, or delivered to, a webhook.
+type WebhookDelivery struct {
+	ID        string
+	WebhookID string
+	EventID   uint64
+	EventType string
+	// Payload is the request body, so that retries send the same content.
+	Payload       string
+	Status        string
+	Attempts      int
+	CreatedAt     time.Time
+	NextAttemptAt *time.Time
+	LastAttemptAt *time.Time
+	// ResponseStatus is the HTTP status of the last attempt, or zero if there was no response.
+	ResponseStatus int
+	Error          string
+}
+
+const webhookColumns = "ID, Subject, URL, Secret, Events, CreatedAt, UpdatedAt, ConsecutiveFailures, DisabledAt, DisabledReason"
+
+const webhookDeliveryColumns = "ID, WebhookID, EventID, EventType, Payload, Status, Attempts, CreatedAt, NextAttemptAt, " +
+	"LastAttemptAt, ResponseStatus, Error"
+
+func (s *Store) InsertWebhook(hook *Webhook) error {
+	_, err := s.DB.Exec(
+		`INSERT INTO webhooks (ID, Subject, URL, Secret, Events, CreatedAt, UpdatedAt, DisabledAt, DisabledReason)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		hook.ID, hook.Subject, hook.URL, hook.Secret, hook.Events, hook.CreatedAt, hook.UpdatedAt, hook.DisabledAt,
+		hook.DisabledReason,
+	)
+
+	return err
+}
+
+// GetWebhook returns the webhook with the given ID if it belongs to subject, or nil if there is none.
+func (s *Store) GetWebhook(id, subject string) (*Webhook, error) {
+	hooks, err := s.queryWebhooks("SELECT "+webhookColumns+" FROM webhooks WHERE ID = ? AND Subject = ?", id, subject)
+	if err != nil || len(hooks) == 0 {
+		return nil, err
+	}
+
+	return &hooks[0], nil
+}
+
+// GetWebhookByID returns the webhook with the given ID, whoever it belongs to, or nil if there is none.
+func (s *Store) GetWebhookByID(id string) (*Webhook, error) {
+	hooks, err := s.queryWebhooks("SELECT "+webhookColumns+" FROM webhooks WHERE ID = ?", id)
+	if err != nil || len(hooks) == 0 {
+		return nil, err
+	}
+
+	return &hooks[0], nil
+}
+
+// ListWebhooks returns the webhooks that belong to subject, oldest first.
+func (s *Store) ListWebhooks(subject string) ([]Webhook, error) {
+	return s.queryWebhooks("SELECT "+webhookColumns+" FROM webhooks WHERE Subject = ? ORDER BY CreatedAt", subject)
+}
+
+// ListEnabledWebhooks returns all webhooks that aren't disabled.
+func (s *Store) ListEnabledWebhooks() ([]Webhook, error) {
+	return s.queryWebhooks("SELECT " + webhookColumns + " FROM webhooks WHERE DisabledAt IS NULL")
+}
+
+// UpdateWebhook saves the URL, events and state of a webhook. Enabling a webhook resets its failure count.
+// Disabling it fails its pending deliveries.
+func (s *Store) UpdateWebhook(hook *Webhook) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if hook.DisabledAt == nil {
+		hook.ConsecutiveFailures = 0
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE webhooks SET URL=?, Events=?, UpdatedAt=?, ConsecutiveFailures=?, DisabledAt=?, DisabledReason=?
+		WHERE ID=? AND Subject=?`,
+		hook.URL, hook.Events, hook.UpdatedAt, hook.ConsecutiveFailures, hook.DisabledAt, hook.DisabledReason,
+		hook.ID, hook.Subject,
+	); err != nil {
+		return err
+	}
+
+	if hook.DisabledAt != nil {
+		if err := failPendingDeliveries(tx, hook.ID, "webhook disabled"); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteWebhook deletes the webhook with the given ID, and its deliveries, if it belongs to subject.
+// It reports whether the webhook was found.
+func (s *Store) DeleteWebhook(id, subject string) (bool, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.Exec(`DELETE FROM webhooks WHERE ID=? AND Subject=?`, id, subject)
+	if err != nil {
+		return false, err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+
+	// SQLite only enforces foreign keys if they are enabled on the connection.
+	if _, err := tx.Exec(`DELETE FROM webhook_deliveries WHERE WebhookID=?`, id); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// RecordWebhookResult updates the failure count of a webhook after a delivery attempt. After disableAfter
+// consecutive failures the webhook is disabled and its pending deliveries fail. It reports whether the
+// webhook was disabled.
+func (s *Store) RecordWebhookResult(id string, succeeded bool, disableAfter int, now time.Time) (bool, error) {
+	if succeeded {
+		_, err := s.DB.Exec(`UPDATE webhooks SET ConsecutiveFailures=0 WHERE ID=?`, id)
+		return false, err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec(`UPDATE webhooks SET ConsecutiveFailures=ConsecutiveFailures+1 WHERE ID=?`, id); err != nil {
+		return false, err
+	}
+
+	res, err := tx.Exec(
+		`UPDATE webhooks SET DisabledAt=?, DisabledReason=? WHERE ID=? AND DisabledAt IS NULL AND ConsecutiveFailures>=?`,
+		now, "too many failed deliveries", id, disableAfter,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if n > 0 {
+		if err := failPendingDeliveries(tx, id, "webhook disabled after too many failed deliveries"); err != nil {
+			return false, err
+		}
+	}
+
+	return n > 0, tx.Commit()
+}
+
+// InsertWebhookDeliveries queues deliveries in a single transaction.
+func (s *Store) InsertWebhookDeliveries(deliveries []WebhookDelivery) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for i := range deliveries {
+		d := &deliveries[i]
+		if _, err := tx.Exec(
+			`INSERT INTO webhook_deliveries (ID, WebhookID, EventID, EventType, Payload, Status, CreatedAt, NextAttemptAt)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			d.ID, d.WebhookID, d.EventID, d.EventType, d.Payload, d.Status, d.CreatedAt, d.NextAttemptAt,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DueWebhookDeliveries returns up to limit pending deliveries to enabled webhooks that are due at time now,
+// oldest first.
+func (s *Store) DueWebhookDeliveries(now time.Time, limit int) ([]WebhookDelivery, error) {
+	return s.queryWebhookDeliveries(
+		`SELECT `+prefixColumns("d", webhookDeliveryColumns)+`
+		FROM webhook_deliveries d JOIN webhooks w ON w.ID = d.WebhookID
+		WHERE d.Status = ? AND d.NextAttemptAt <= ? AND w.DisabledAt IS NULL
+		ORDER BY d.NextAttemptAt, d.EventID LIMIT ?`,
+		DeliveryPending, now, limit,
+	)
+}
+
+// ListWebhookDeliveries returns up to limit of the most recent deliveries to a webhook, newest first.
+func (s *Store) ListWebhookDeliveries(webhookID string, limit int) ([]WebhookDelivery, error) {
+	return s.queryWebhookDeliveries(
+		"SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries WHERE WebhookID = ? ORDER BY CreatedAt DESC, EventID DESC LIMIT ?",
+		webhookID, limit,
+	)
+}
+
+// UpdateWebhookDelivery saves the outcome of a delivery attempt.
+func (s *Store) UpdateWebhookDelivery(d *WebhookDelivery) error {
+	_, err := s.DB.Exec(
+		`UPDATE webhook_deliveries SET Status=?, Attempts=?, NextAttemptAt=?, LastAttemptAt=?, ResponseStatus=?, Error=?
+		WHERE ID=?`,
+		d.Status, d.Attempts, d.NextAttemptAt, d.LastAttemptAt, d.ResponseStatus, d.Error, d.ID,
+	)
+
+	return err
+}
+
+// DeleteWebhookDeliveries deletes the completed deliveries created before cutoff and returns how many there were.
+func (s *Store) DeleteWebhookDeliveries(cutoff time.Time) (int64, error) {
+	res, err := s.DB.Exec(`DELETE FROM webhook_deliveries WHERE Status <> ? AND CreatedAt < ?`, DeliveryPending, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func failPendingDeliveries(tx *sql.Tx, webhookID, reason string) error {
+	_, err := tx.Exec(
+		`UPDATE webhook_deliveries SET Status=?, NextAttemptAt=NULL, Error=? WHERE WebhookID=? AND Status=?`,
+		DeliveryFailed, reason, webhookID, DeliveryPending,
+	)
+
+	return err
+}
+
+func (s *Store) queryWebhooks(query string, args ...interface{}) ([]Webhook, error) {
+	rows, err := s.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var hooks []Webhook
+	if err := scan.Rows(&hooks, rows); err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	return hooks, nil
+}
+
+func (s *Store) queryWebhookDeliveries(query string, args ...interface{}) ([]WebhookDelivery, error) {
+	rows, err := s.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var deliveries []WebhookDelivery
+	if err := scan.Rows(&deliveries, rows); err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// prefixColumns qualifies each column in a comma-separated list with a table alias.
+func prefixColumns(alias, columns string) string {
+	names := strings.Split(columns, ", ")
+	for i, name := range names {
+		names[i] = alias + "." + name
+	}
+
+	return strings.Join(names, ", ")
+}
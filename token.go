@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"todo-go/devauth"
+	"todo-go/server"
+
+	"github.com/pkg/errors"
+)
+
+// runToken mints a token signed by the development issuer's key. The server must run with the same key
+// (dev_auth.key_path) to accept it.
+func runToken(_ context.Context, args []string) error {
+	flags := server.NewOptionFlags("token")
+	subject := flags.String("sub", "", "subject (identity) of the token")
+	audience := flags.String("aud", "", "comma-separated audiences (defaults to the configured OIDC audience)")
+	ttl := flags.String("ttl", "", "token lifetime (defaults to dev_auth.token_ttl)")
+
+	options, err := loadOptions(flags, args)
+	if err != nil {
+		return err
+	}
+
+	if !options.DevAuth.Enabled {
+		return errors.New("development auth is disabled, enable it with --dev-auth")
+	}
+
+	issuer, err := devauth.LoadOrCreate(options.DevAuth, options.OidcAudience)
+	if err != nil {
+		return err
+	}
+
+	req := &devauth.TokenRequest{Subject: *subject, TTL: *ttl}
+	if *audience != "" {
+		req.Audience = strings.Split(*audience, ",")
+	}
+
+	token, err := issuer.Mint(req)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(token)
+
+	return nil
+}
@@ -0,0 +1,285 @@
+// Package validation decodes JSON request bodies strictly and checks them against rules declared in
+// `validate` struct tags. Rules are separated by commas:
+//
+//	required   the value must not be empty or, for strings, only whitespace
+//	absent     the value must be empty; used for fields that the server assigns
+//	min=N      strings have at least N characters, slices at least N items
+//	max=N      strings have at most N characters, slices at most N items
+//	oneof=a b  the value, or each item of a slice, must be one of the listed values
+//	rfc3339    strings must be empty or an RFC 3339 time, such as 2026-01-31T17:00:00Z
+//
+// Fields are reported by their JSON names.
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// FieldError describes a problem with one field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error lists the problems found in a request body. It is reported with status 422.
+type Error struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *Error) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		messages[i] = f.Message
+	}
+
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+// Fields returns an Error for the given problems, or nil if there are none.
+func Fields(problems ...FieldError) error {
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return &Error{Fields: problems}
+}
+
+// Decode reads a single JSON object from r's body into dst, rejecting unknown fields, and validates it.
+// Problems with individual fields are returned as *Error.
+func Decode(r *http.Request, dst interface{}) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		return decodeError(err)
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("request body must contain a single JSON object")
+	}
+
+	return Struct(dst)
+}
+
+// Unmarshal reads a JSON value that was already read into dst, like Decode, and validates it. Unlike Decode,
+// it ignores unknown fields, for documents written by other tools.
+func Unmarshal(data []byte, dst interface{}) error {
+	if err := json.Unmarshal(data, dst); err != nil {
+		return decodeError(err)
+	}
+
+	return Struct(dst)
+}
+
+func decodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return Fields(FieldError{
+			Field:   typeErr.Field,
+			Code:    "type",
+			Message: fmt.Sprintf("%s must be a %s", typeErr.Field, jsonType(typeErr.Type)),
+		})
+	}
+
+	if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		name, _ = strconv.Unquote(name)
+		return Fields(FieldError{Field: name, Code: "unknown", Message: fmt.Sprintf("%s is not a known field", name)})
+	}
+
+	if errors.Is(err, io.EOF) {
+		return errors.New("request body must not be empty")
+	}
+
+	return err
+}
+
+// WriteError responds with 413 if the body was too large, 422 with field details for validation errors, and
+// 400 otherwise.
+func WriteError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var invalid *Error
+	if !errors.As(err, &invalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":  "validation failed",
+		"fields": invalid.Fields,
+	})
+}
+
+// Struct checks the rules in the `validate` tags of v, which must be a struct or a pointer to one.
+func Struct(v interface{}) error {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	rt := rv.Type()
+
+	var problems []FieldError
+
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+
+		tag := field.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+
+		name := jsonName(field)
+		value := reflect.Indirect(rv.Field(i))
+
+		for _, rule := range strings.Split(tag, ",") {
+			if problem := check(name, rule, value); problem != nil {
+				problems = append(problems, *problem)
+				break
+			}
+		}
+	}
+
+	return Fields(problems...)
+}
+
+func check(name, rule string, value reflect.Value) *FieldError {
+	rule, arg, _ := strings.Cut(rule, "=")
+
+	switch rule {
+	case "required":
+		if isEmpty(value) {
+			return &FieldError{Field: name, Code: "required", Message: name + " is required"}
+		}
+	case "absent":
+		if !isEmpty(value) {
+			return &FieldError{Field: name, Code: "read_only", Message: name + " is assigned by the server"}
+		}
+	case "min", "max":
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			panic(fmt.Sprintf("validation: invalid %s rule on %s", rule, name))
+		}
+
+		size, unit := sizeOf(value)
+		if rule == "min" && size < n {
+			return &FieldError{Field: name, Code: "min", Message: fmt.Sprintf("%s must have at least %d %s", name, n, unit)}
+		}
+
+		if rule == "max" && size > n {
+			return &FieldError{Field: name, Code: "max", Message: fmt.Sprintf("%s must have at most %d %s", name, n, unit)}
+		}
+	case "oneof":
+		allowed := strings.Fields(arg)
+		for _, item := range items(value) {
+			if !contains(allowed, item) {
+				return &FieldError{
+					Field:   name,
+					Code:    "oneof",
+					Message: fmt.Sprintf("%s must be one of %s, not [%s]", name, strings.Join(allowed, ", "), item),
+				}
+			}
+		}
+	case "rfc3339":
+		if s := value.String(); s != "" {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				return &FieldError{
+					Field:   name,
+					Code:    "rfc3339",
+					Message: fmt.Sprintf("%s must be an RFC 3339 time such as 2026-01-31T17:00:00Z, not [%s]", name, s),
+				}
+			}
+		}
+	default:
+		panic(fmt.Sprintf("validation: unknown rule [%s] on %s", rule, name))
+	}
+
+	return nil
+}
+
+func isEmpty(value reflect.Value) bool {
+	if !value.IsValid() {
+		return true
+	}
+
+	if value.Kind() == reflect.String {
+		return strings.TrimSpace(value.String()) == ""
+	}
+
+	return value.IsZero() || (value.Kind() == reflect.Slice && value.Len() == 0)
+}
+
+func sizeOf(value reflect.Value) (int, string) {
+	switch value.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(value.String()), "characters"
+	case reflect.Slice:
+		return value.Len(), "items"
+	default:
+		return 0, ""
+	}
+}
+
+// items returns the string value, or the items of a string slice.
+func items(value reflect.Value) []string {
+	switch value.Kind() {
+	case reflect.String:
+		return []string{value.String()}
+	case reflect.Slice:
+		result := make([]string, value.Len())
+		for i := range result {
+			result[i] = value.Index(i).String()
+		}
+
+		return result
+	default:
+		return nil
+	}
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+
+	return name
+}
+
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	default:
+		return "number"
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,144 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"todo-go/store"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// SecretPrefix identifies webhook signing secrets.
+	SecretPrefix = "whsec_"
+
+	// SignatureHeader carries the signature of a delivery, as "t=<unix time>,v1=<hex HMAC-SHA256>". The HMAC
+	// is computed over "<unix time>.<body>" with the webhook's secret as the key.
+	SignatureHeader = "X-Todo-Signature"
+	// EventHeader carries the event type of a delivery.
+	EventHeader = "X-Todo-Event"
+	// DeliveryHeader carries the ID of a delivery, which is the same for each attempt.
+	DeliveryHeader = "X-Todo-Delivery"
+
+	secretSize = 32
+	// maxErrorBody is the amount of a failed response's body that is recorded in the delivery log.
+	maxErrorBody = 256
+)
+
+// GenerateSecret returns a new signing secret.
+func GenerateSecret() (string, error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return SecretPrefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// Sign returns the signature header value for body, sent at time t.
+func Sign(secret string, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// sender posts deliveries.
+type sender struct {
+	client *http.Client
+}
+
+func newSender(cfg *Config) *sender {
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivateNetworks {
+		dialer.Control = denyPrivateAddresses
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// Proxies would dial on our behalf, bypassing the address check.
+	transport.Proxy = nil
+
+	return &sender{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   cfg.Timeout,
+			// Redirects are reported as failures, so that a webhook can't be pointed elsewhere.
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+}
+
+// send makes one attempt to deliver to hook. It returns the response status, if there was a response, and
+// an error unless the endpoint responded with a 2xx status.
+func (s *sender) send(ctx context.Context, hook *store.Webhook, delivery *store.WebhookDelivery, now time.Time) (int, error) {
+	body := []byte(delivery.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "todo-go-webhooks")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(SignatureHeader, Sign(hook.Secret, now, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		msg := "webhook responded with " + resp.Status
+		if text := strings.TrimSpace(string(snippet)); text != "" {
+			msg += ": " + text
+		}
+
+		return resp.StatusCode, errors.New(msg)
+	}
+
+	// Drain the body so that the connection can be reused.
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	return resp.StatusCode, nil
+}
+
+// denyPrivateAddresses refuses connections to addresses that aren't publicly routable. It runs after name
+// resolution, so host names that resolve to such addresses are refused too.
+func denyPrivateAddresses(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return errors.Errorf("invalid address [%s]", address)
+	}
+
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return errors.Errorf("webhooks can't be delivered to non-public address [%s]", host)
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"todo-go/store"
+)
+
+func TestDenyPrivateAddresses(t *testing.T) {
+	for address, allowed := range map[string]bool{
+		"127.0.0.1:443":      false,
+		"[::1]:443":          false,
+		"10.1.2.3:443":       false,
+		"172.16.0.1:443":     false,
+		"192.168.1.1:443":    false,
+		"[fd00::1]:443":      false,
+		"169.254.169.254:80": false,
+		"[fe80::1]:443":      false,
+		"0.0.0.0:443":        false,
+		"224.0.0.1:443":      false,
+		"93.184.215.14:443":  true,
+		"[2606:4700::1]:443": true,
+	} {
+		if err := denyPrivateAddresses("tcp", address, nil); (err == nil) != allowed {
+			t.Errorf("%s: got error %v, want allowed %t", address, err, allowed)
+		}
+	}
+}
+
+func TestSenderRefusesHostsThatResolveToPrivateAddresses(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		t.Error("a webhook on a private address was delivered")
+	}))
+	defer ts.Close()
+
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+
+	// localhost resolves to a loopback address, which is only checked once it is dialed.
+	s := newSender(testConfig(false))
+	status, err := s.send(context.Background(), testWebhook("http://localhost:"+port), testDelivery(), time.Now())
+	if err == nil || !strings.Contains(err.Error(), "non-public address") {
+		t.Errorf("got status %d and error %v, want the address refused", status, err)
+	}
+}
+
+func TestSenderRefusesRedirects(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		t.Error("the redirect was followed")
+	}))
+	defer target.Close()
+
+	ts := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	defer ts.Close()
+
+	s := newSender(testConfig(true))
+	if status, err := s.send(context.Background(), testWebhook(ts.URL), testDelivery(), time.Now()); err == nil ||
+		status != http.StatusTemporaryRedirect {
+		t.Errorf("got status %d and error %v, want the redirect reported as a failure", status, err)
+	}
+}
+
+func TestSenderSignsDeliveries(t *testing.T) {
+	var header, body string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get(SignatureHeader)
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+	}))
+	defer ts.Close()
+
+	hook := testWebhook(ts.URL)
+	delivery := testDelivery()
+	now := time.Unix(1760812345, 0)
+
+	if _, err := newSender(testConfig(true)).send(context.Background(), hook, delivery, now); err != nil {
+		t.Fatal(err)
+	}
+
+	// Receivers verify the HMAC of "<timestamp>.<body>" with the webhook's secret.
+	mac := hmac.New(sha256.New, []byte(hook.Secret))
+	mac.Write([]byte(strconv.FormatInt(now.Unix(), 10) + "." + body))
+
+	if want := "t=1760812345,v1=" + hex.EncodeToString(mac.Sum(nil)); header != want || body != delivery.Payload {
+		t.Errorf("got signature [%s] for body [%s], want [%s] for the payload", header, body, want)
+	}
+}
+
+func testConfig(allowPrivateNetworks bool) *Config {
+	return &Config{
+		Timeout:              5 * time.Second,
+		MaxAttempts:          3,
+		InitialBackoff:       time.Second,
+		MaxBackoff:           10 * time.Second,
+		DisableAfter:         3,
+		AllowPrivateNetworks: allowPrivateNetworks,
+	}
+}
+
+func testWebhook(url string) *store.Webhook {
+	return &store.Webhook{
+		ID: "hook", Subject: "rick@the-citadel.com", URL: url, Secret: SecretPrefix + "portal-gun",
+		CreatedAt: time.Now().UTC(), UpdatedAt: time.Now().UTC(),
+	}
+}
+
+func testDelivery() *store.WebhookDelivery {
+	return &store.WebhookDelivery{
+		ID: "delivery", WebhookID: "hook", EventID: 1, EventType: "todo.created",
+		Payload: `{"event":"todo.created","eventId":1,"data":{"id":"todo"}}`, Status: store.DeliveryPending,
+		CreatedAt: time.Now().UTC(),
+	}
+}
@@ -0,0 +1,379 @@
+// Package webhooks delivers todo events to the endpoints that users register. Events are queued in the store
+// and delivered in the background, with retries and exponential backoff. Webhooks that keep failing are
+// disabled.
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"todo-go/events"
+	"todo-go/store"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// pollInterval is how often the store is checked for deliveries that are due.
+	pollInterval = time.Second
+	// batchSize is the number of due deliveries loaded at a time.
+	batchSize = 100
+	// concurrency is the number of deliveries attempted at the same time.
+	concurrency = 4
+	// retention is how long completed deliveries are kept in the delivery log.
+	retention = 7 * 24 * time.Hour
+	// pruneInterval is how often expired deliveries are deleted.
+	pruneInterval = time.Hour
+)
+
+// Config configures delivery.
+type Config struct {
+	// Timeout bounds each delivery attempt.
+	Timeout time.Duration
+	// MaxAttempts is the number of times a delivery is attempted before it fails.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry. It doubles with each retry, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// DisableAfter is the number of consecutive failed attempts after which a webhook is disabled.
+	DisableAfter int
+	// AllowPrivateNetworks allows webhooks on loopback, private and link-local addresses. Otherwise users
+	// could make the server send requests to internal services.
+	AllowPrivateNetworks bool
+}
+
+// Validate returns a problem for each invalid setting.
+func (c *Config) Validate() []string {
+	var problems []string
+
+	if c.Timeout <= 0 || c.InitialBackoff <= 0 || c.MaxBackoff < c.InitialBackoff {
+		problems = append(problems, "webhook timeout and backoffs must be positive, and the maximum backoff at least the initial one")
+	}
+
+	if c.MaxAttempts <= 0 || c.DisableAfter <= 0 {
+		problems = append(problems, "webhook max attempts and disable after must be positive")
+	}
+
+	return problems
+}
+
+// AccessCheck reports whether the owner of a webhook, identified by their subject, may receive events about
+// the todo with the given ID.
+type AccessCheck func(ctx context.Context, subject, todoID string) (bool, error)
+
+// Payload is the body of a delivery.
+type Payload struct {
+	Event   string          `json:"event"`
+	EventID uint64          `json:"eventId"`
+	Time    time.Time       `json:"time"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Dispatcher queues the events published by a hub for the webhooks that want them and delivers them.
+type Dispatcher struct {
+	cfg    *Config
+	store  *store.Store
+	hub    *events.Hub
+	access AccessCheck
+	sender *sender
+
+	wake   chan struct{}
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewDispatcher(cfg *Config, db *store.Store, hub *events.Hub, access AccessCheck) *Dispatcher {
+	return &Dispatcher{
+		cfg:    cfg,
+		store:  db,
+		hub:    hub,
+		access: access,
+		sender: newSender(cfg),
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Start starts queueing and delivering events in the background. Deliveries left pending when the server
+// stopped are resumed.
+func (d *Dispatcher) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+
+	d.wg.Add(2)
+	go d.enqueue(ctx)
+	go d.deliver(ctx)
+}
+
+// Close stops the dispatcher and waits for attempts in progress to finish. Events published afterwards aren't
+// queued.
+func (d *Dispatcher) Close() {
+	if d.cancel != nil {
+		d.cancel()
+	}
+
+	d.wg.Wait()
+}
+
+// enqueue subscribes to the hub and queues a delivery of each event for each webhook that wants it. If the
+// subscription falls behind, it resumes from the hub's history.
+func (d *Dispatcher) enqueue(ctx context.Context) {
+	defer d.wg.Done()
+
+	var lastID uint64
+
+	for {
+		sub, missed, ok := d.hub.Subscribe(lastID)
+		if !ok {
+			log.Warn().Uint64("last_event_id", lastID).Msg("webhook events were lost")
+		}
+
+		for _, event := range missed {
+			d.queue(ctx, event)
+			lastID = event.ID
+		}
+
+		if !d.consume(ctx, sub, &lastID) {
+			return
+		}
+	}
+}
+
+// consume queues the events of a subscription until it ends. It reports whether to resubscribe.
+func (d *Dispatcher) consume(ctx context.Context, sub *events.Subscription, lastID *uint64) bool {
+	defer sub.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case event, open := <-sub.Events():
+			if !open {
+				return sub.Lagged()
+			}
+
+			d.queue(ctx, event)
+			*lastID = event.ID
+		}
+	}
+}
+
+// queue stores a delivery of event for each enabled webhook that wants it and whose owner may receive events
+// about its todo.
+func (d *Dispatcher) queue(ctx context.Context, event events.Event) {
+	hooks, err := d.store.ListEnabledWebhooks()
+	if err != nil {
+		log.Err(err).Uint64("event_id", event.ID).Msg("failed to load webhooks")
+		return
+	}
+
+	payload, err := json.Marshal(&Payload{Event: event.Type, EventID: event.ID, Time: event.Time, Data: event.Data})
+	if err != nil {
+		log.Err(err).Uint64("event_id", event.ID).Msg("failed to encode webhook payload")
+		return
+	}
+
+	now := time.Now().UTC()
+	allowed := map[string]bool{}
+
+	var deliveries []store.WebhookDelivery
+	for i := range hooks {
+		hook := &hooks[i]
+		if !hook.Wants(event.Type) {
+			continue
+		}
+
+		may, checked := allowed[hook.Subject]
+		if !checked {
+			if may, err = d.access(ctx, hook.Subject, event.TodoID); err != nil {
+				log.Err(err).Str("subject", hook.Subject).Str("todo_id", event.TodoID).Msg("failed to authorize webhook owner")
+			}
+
+			allowed[hook.Subject] = may
+		}
+
+		if !may {
+			continue
+		}
+
+		deliveries = append(deliveries, store.WebhookDelivery{
+			ID:            uuid.New().String(),
+			WebhookID:     hook.ID,
+			EventID:       event.ID,
+			EventType:     event.Type,
+			Payload:       string(payload),
+			Status:        store.DeliveryPending,
+			CreatedAt:     now,
+			NextAttemptAt: &now,
+		})
+	}
+
+	if len(deliveries) == 0 {
+		return
+	}
+
+	if err := d.store.InsertWebhookDeliveries(deliveries); err != nil {
+		log.Err(err).Uint64("event_id", event.ID).Msg("failed to queue webhook deliveries")
+		return
+	}
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliver attempts the deliveries that are due whenever events are queued, and otherwise polls the store
+// for retries.
+func (d *Dispatcher) deliver(ctx context.Context) {
+	defer d.wg.Done()
+
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+
+	var pruned time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-poll.C:
+		case <-d.wake:
+		}
+
+		if time.Since(pruned) >= pruneInterval {
+			pruned = time.Now()
+			d.prune()
+		}
+
+		// A full batch suggests that more deliveries are due.
+		for more := true; more && ctx.Err() == nil; {
+			more = d.deliverDue(ctx) == batchSize
+		}
+	}
+}
+
+// deliverDue attempts a batch of due deliveries and returns its size.
+func (d *Dispatcher) deliverDue(ctx context.Context) int {
+	due, err := d.store.DueWebhookDeliveries(time.Now().UTC(), batchSize)
+	if err != nil {
+		log.Err(err).Msg("failed to load webhook deliveries")
+		return 0
+	}
+
+	hooks := map[string]*store.Webhook{}
+	slots := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for i := range due {
+		delivery := &due[i]
+
+		hook, err := d.webhook(hooks, delivery.WebhookID)
+		if err != nil {
+			log.Err(err).Str("webhook_id", delivery.WebhookID).Msg("failed to load webhook")
+			continue
+		}
+
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-slots; wg.Done() }()
+			d.attempt(ctx, hook, delivery)
+		}()
+	}
+
+	wg.Wait()
+
+	return len(due)
+}
+
+// webhook returns the webhook with the given ID, loading each one once per batch.
+func (d *Dispatcher) webhook(hooks map[string]*store.Webhook, id string) (*store.Webhook, error) {
+	if hook, ok := hooks[id]; ok {
+		return hook, nil
+	}
+
+	hook, err := d.store.GetWebhookByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if hook == nil {
+		return nil, errors.Errorf("webhook [%s] not found", id)
+	}
+
+	hooks[id] = hook
+
+	return hook, nil
+}
+
+// attempt makes one delivery attempt and records its outcome.
+func (d *Dispatcher) attempt(ctx context.Context, hook *store.Webhook, delivery *store.WebhookDelivery) {
+	now := time.Now().UTC()
+	status, err := d.sender.send(ctx, hook, delivery, now)
+	if ctx.Err() != nil {
+		// The server is stopping. The delivery is attempted again when it restarts.
+		return
+	}
+
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.ResponseStatus = status
+	delivery.Error = ""
+	delivery.NextAttemptAt = nil
+
+	logger := log.With().Str("webhook_id", hook.ID).Str("delivery_id", delivery.ID).Int("attempt", delivery.Attempts).Logger()
+
+	switch {
+	case err == nil:
+		delivery.Status = store.DeliverySucceeded
+	case delivery.Attempts >= d.cfg.MaxAttempts:
+		delivery.Status = store.DeliveryFailed
+		delivery.Error = err.Error()
+		logger.Warn().Err(err).Msg("webhook delivery failed")
+	default:
+		next := now.Add(d.backoff(delivery.Attempts))
+		delivery.NextAttemptAt = &next
+		delivery.Error = err.Error()
+		logger.Debug().Err(err).Time("next_attempt_at", next).Msg("webhook delivery attempt failed")
+	}
+
+	if err := d.store.UpdateWebhookDelivery(delivery); err != nil {
+		logger.Err(err).Msg("failed to record webhook delivery")
+	}
+
+	disabled, recordErr := d.store.RecordWebhookResult(hook.ID, err == nil, d.cfg.DisableAfter, now)
+	switch {
+	case recordErr != nil:
+		logger.Err(recordErr).Msg("failed to record webhook result")
+	case disabled:
+		logger.Warn().Str("subject", hook.Subject).Msg("webhook disabled after too many failed deliveries")
+	}
+}
+
+// backoff returns the delay before the next attempt after the given number of failed ones.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.cfg.InitialBackoff
+	for i := 1; i < attempts && delay < d.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > d.cfg.MaxBackoff {
+		delay = d.cfg.MaxBackoff
+	}
+
+	return delay
+}
+
+func (d *Dispatcher) prune() {
+	n, err := d.store.DeleteWebhookDeliveries(time.Now().UTC().Add(-retention))
+	switch {
+	case err != nil:
+		log.Err(err).Msg("failed to prune webhook deliveries")
+	case n > 0:
+		log.Debug().Int64("deliveries", n).Msg("pruned webhook deliveries")
+	}
+}
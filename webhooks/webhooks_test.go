@@ -0,0 +1,102 @@
+package webhooks
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"todo-go/events"
+	"todo-go/store"
+)
+
+func newTestDispatcher(t *testing.T, url string, access AccessCheck) (*Dispatcher, *store.Webhook) {
+	t.Helper()
+
+	db, err := store.NewMemoryStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	hook := testWebhook(url)
+	if err := db.InsertWebhook(hook); err != nil {
+		t.Fatal(err)
+	}
+
+	hub := events.NewHub(&events.Config{History: 10, SubscriberBuffer: 10, Heartbeat: time.Second})
+
+	return NewDispatcher(testConfig(true), db, hub, access), hook
+}
+
+func TestQueueChecksAccessToEachTodo(t *testing.T) {
+	access := func(_ context.Context, subject, todoID string) (bool, error) {
+		return subject == "rick@the-citadel.com" && todoID != "private", nil
+	}
+
+	d, hook := newTestDispatcher(t, "https://example.com/hook", access)
+
+	d.queue(context.Background(), events.Event{ID: 1, Type: events.TodoCreated, TodoID: "private", Data: []byte(`{}`)})
+	d.queue(context.Background(), events.Event{ID: 2, Type: events.TodoCreated, TodoID: "shared", Data: []byte(`{}`)})
+
+	deliveries, err := d.store.ListWebhookDeliveries(hook.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deliveries) != 1 || deliveries[0].EventID != 2 {
+		t.Errorf("got deliveries %+v, want only the event about the shared todo", deliveries)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := &Dispatcher{cfg: testConfig(false)}
+
+	// The backoff doubles from a second, up to ten seconds.
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		if got := d.backoff(i + 1); got != want {
+			t.Errorf("after %d attempts: got backoff %s, want %s", i+1, got, want)
+		}
+	}
+}
+
+func TestFailingWebhookIsRetriedAndDisabled(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "portal fluid low", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	allowAll := func(context.Context, string, string) (bool, error) { return true, nil }
+	d, hook := newTestDispatcher(t, ts.URL, allowAll)
+
+	delivery := testDelivery()
+	if err := d.store.InsertWebhookDeliveries([]store.WebhookDelivery{*delivery}); err != nil {
+		t.Fatal(err)
+	}
+
+	for attempt := 1; attempt <= d.cfg.MaxAttempts; attempt++ {
+		before := time.Now()
+		d.attempt(context.Background(), hook, delivery)
+
+		switch {
+		case delivery.Attempts != attempt || delivery.ResponseStatus != http.StatusServiceUnavailable:
+			t.Fatalf("attempt %d: got delivery %+v", attempt, delivery)
+		case attempt < d.cfg.MaxAttempts && (delivery.Status != store.DeliveryPending || delivery.NextAttemptAt == nil ||
+			delivery.NextAttemptAt.Before(before.Add(d.backoff(attempt)))):
+			t.Errorf("attempt %d: got status %s, next attempt at %v, want a retry after %s",
+				attempt, delivery.Status, delivery.NextAttemptAt, d.backoff(attempt))
+		case attempt == d.cfg.MaxAttempts && delivery.Status != store.DeliveryFailed:
+			t.Errorf("last attempt: got status %s, want failed", delivery.Status)
+		}
+	}
+
+	stored, err := d.store.GetWebhookByID(hook.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored.DisabledAt == nil || stored.ConsecutiveFailures != d.cfg.DisableAfter {
+		t.Errorf("got webhook %+v, want it disabled after %d failures", stored, d.cfg.DisableAfter)
+	}
+}